@@ -0,0 +1,318 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gianlucam76/webex_bot/metrics"
+	"github.com/gianlucam76/webex_bot/state"
+)
+
+const (
+	// An alert still firing is notified again only after cooldown has elapsed.
+	// Analyzers run weekly, so a firing alert is re-posted every other week.
+	cooldown = 13 * 24 * time.Hour
+
+	// IDSeparator separates analyzer and subject in an alert ID
+	IDSeparator = "/"
+)
+
+// Status is the status of an alert
+type Status string
+
+const (
+	// Firing means the condition was detected in last analyzer run
+	Firing Status = "firing"
+	// Resolved means the condition was not detected in last analyzer run
+	Resolved Status = "resolved"
+)
+
+// Alert represents a condition detected by an analyzer for a given subject
+// (test, report, pod)
+type Alert struct {
+	// Analyzer is the analyzer which detected the condition
+	Analyzer string `json:"analyzer"`
+	// Subject is what the alert is about (test, report, pod)
+	Subject string `json:"subject"`
+	// Status is the current status of the alert
+	Status Status `json:"status"`
+	// FirstSeen is the time the condition was first detected
+	FirstSeen time.Time `json:"firstSeen"`
+	// LastSeen is the last time the condition was detected
+	LastSeen time.Time `json:"lastSeen"`
+	// LastNotified is the last time a message was sent for this alert
+	LastNotified time.Time `json:"lastNotified,omitempty"`
+	// AckedBy is set when someone acknowledged the alert. An acknowledged alert
+	// is not notified again till it resolves.
+	AckedBy string `json:"ackedBy,omitempty"`
+	// SnoozedUntil, if set, prevents notifications till that time
+	SnoozedUntil time.Time `json:"snoozedUntil,omitempty"`
+}
+
+// errNoSuchAlert is returned when an alert is not known
+var errNoSuchAlert = errors.New("no such alert")
+
+var (
+	// alertsFilename is the file where alerts are persisted
+	alertsFilename = state.GetPath("alerts_state.json")
+
+	// alerts contains all known alerts. Key is alert ID.
+	alerts map[string]*Alert
+
+	// mux serializes access to alerts and alertsFilename
+	mux sync.Mutex
+)
+
+// ID returns the alert ID
+func (a *Alert) ID() string {
+	return GetID(a.Analyzer, a.Subject)
+}
+
+// GetID returns the ID of the alert for analyzer and subject
+func GetID(analyzer, subject string) string {
+	return fmt.Sprintf("%s%s%s", analyzer, IDSeparator, subject)
+}
+
+// Evaluate records which subjects analyzer found in alert state in its last run.
+// evaluated contains all subjects analyzer was able to evaluate. Firing alerts for
+// subjects not evaluated (i.e. data could not be fetched) are left untouched.
+// Returns:
+// - subjects that should be notified (new alerts, alerts firing again after being
+// resolved, or alerts still firing for which cooldown has elapsed and that are neither
+// acknowledged nor snoozed). Call MarkNotified once notification is delivered;
+// - subjects, previously notified, for which condition cleared.
+func Evaluate(analyzer string, evaluated, firing []string, logger logr.Logger) (notify, resolved []string, err error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if err = load(logger); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	notify = make([]string, 0)
+	resolved = make([]string, 0)
+
+	firingMap := make(map[string]bool)
+	for i := range firing {
+		firingMap[firing[i]] = true
+
+		id := GetID(analyzer, firing[i])
+		a, ok := alerts[id]
+		if !ok {
+			a = &Alert{Analyzer: analyzer, Subject: firing[i], Status: Firing, FirstSeen: now}
+			alerts[id] = a
+		} else if a.Status == Resolved {
+			// Condition is back. Acknowledgement was for previous occurrence.
+			a.Status = Firing
+			a.FirstSeen = now
+			a.AckedBy = ""
+			a.LastNotified = time.Time{}
+		}
+		a.LastSeen = now
+
+		if a.AckedBy != "" || now.Before(a.SnoozedUntil) {
+			logger.Info(fmt.Sprintf("Alert %s is acknowledged or snoozed", id))
+			continue
+		}
+
+		if a.LastNotified.IsZero() || now.Sub(a.LastNotified) >= cooldown {
+			notify = append(notify, firing[i])
+		} else {
+			logger.Info(fmt.Sprintf("Alert %s notified on %s. Skip it", id, a.LastNotified))
+		}
+	}
+
+	for i := range evaluated {
+		a, ok := alerts[GetID(analyzer, evaluated[i])]
+		if !ok || a.Status != Firing || firingMap[a.Subject] {
+			continue
+		}
+		a.Status = Resolved
+		if !a.LastNotified.IsZero() {
+			resolved = append(resolved, a.Subject)
+		}
+	}
+
+	sort.Strings(notify)
+	sort.Strings(resolved)
+
+	return notify, resolved, store(logger)
+}
+
+// MarkNotified records that alerts for analyzer and subjects were delivered.
+// Such alerts are not notified again till cooldown has elapsed.
+func MarkNotified(analyzer string, subjects []string, logger logr.Logger) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if err := load(logger); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range subjects {
+		if a, ok := alerts[GetID(analyzer, subjects[i])]; ok {
+			a.LastNotified = now
+		}
+	}
+
+	metrics.AlertsFired(analyzer, len(subjects))
+
+	return store(logger)
+}
+
+// Ack acknowledges an alert. Acknowledged alerts are not notified again till
+// they resolve.
+func Ack(id, by string, logger logr.Logger) (*Alert, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	a, err := get(id, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	a.AckedBy = by
+	return a, store(logger)
+}
+
+// Snooze prevents notifications for an alert till duration has elapsed.
+// Alert does not need to be firing. An alert which never fired can be snoozed
+// as well, using its full ID (<analyzer>/<subject>).
+func Snooze(id string, duration time.Duration, logger logr.Logger) (*Alert, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	a, err := get(id, logger)
+	if errors.Is(err, errNoSuchAlert) {
+		info := strings.SplitN(id, IDSeparator, 2)
+		if len(info) != 2 || info[0] == "" || info[1] == "" {
+			return nil, fmt.Errorf("%v. Use <analyzer>%s<subject> to snooze an alert before it fires", err, IDSeparator)
+		}
+		a = &Alert{Analyzer: info[0], Subject: info[1], Status: Resolved}
+		alerts[id] = a
+	} else if err != nil {
+		return nil, err
+	}
+
+	a.SnoozedUntil = time.Now().Add(duration)
+	return a, store(logger)
+}
+
+// GetFiring returns all currently firing alerts
+func GetFiring(logger logr.Logger) ([]Alert, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if err := load(logger); err != nil {
+		return nil, err
+	}
+
+	result := make([]Alert, 0)
+	for _, a := range alerts {
+		if a.Status == Firing {
+			result = append(result, *a)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID() < result[j].ID() })
+	return result, nil
+}
+
+// GetAll returns all known alerts, firing and resolved, most recently seen first
+func GetAll(logger logr.Logger) ([]Alert, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if err := load(logger); err != nil {
+		return nil, err
+	}
+
+	result := make([]Alert, 0, len(alerts))
+	for _, a := range alerts {
+		result = append(result, *a)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result, nil
+}
+
+// get returns the alert with passed id. If no alert has such an ID, and
+// id matches the subject of exactly one alert, such alert is returned.
+func get(id string, logger logr.Logger) (*Alert, error) {
+	if err := load(logger); err != nil {
+		return nil, err
+	}
+
+	if a, ok := alerts[id]; ok {
+		return a, nil
+	}
+
+	candidates := make([]string, 0)
+	for _, a := range alerts {
+		if a.Subject == id {
+			candidates = append(candidates, a.ID())
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%w %s", errNoSuchAlert, id)
+	case 1:
+		return alerts[candidates[0]], nil
+	default:
+		sort.Strings(candidates)
+		return nil, fmt.Errorf("more than one alert for %s: %s. Please use <analyzer>%s<subject>",
+			id, strings.Join(candidates, ", "), IDSeparator)
+	}
+}
+
+// load reads alerts from alertsFilename, if not done already
+func load(logger logr.Logger) error {
+	if alerts != nil {
+		return nil
+	}
+
+	tmpAlerts := make(map[string]*Alert)
+
+	if _, err := os.Stat(alertsFilename); err == nil {
+		content, err := os.ReadFile(alertsFilename)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to read file %s with alerts. Err: %v", alertsFilename, err))
+			return err
+		}
+
+		if err := json.Unmarshal(content, &tmpAlerts); err != nil {
+			logger.Info(fmt.Sprintf("Failed to parse file %s with alerts. Err: %v", alertsFilename, err))
+			return err
+		}
+	}
+
+	alerts = tmpAlerts
+	return nil
+}
+
+// store saves alerts to alertsFilename
+func store(logger logr.Logger) error {
+	content, err := json.MarshalIndent(alerts, "", "  ")
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to marshal alerts. Err: %v", err))
+		return err
+	}
+
+	if err := os.WriteFile(alertsFilename, content, 0600); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write file %s with alerts. Err: %v", alertsFilename, err))
+		return err
+	}
+
+	return nil
+}
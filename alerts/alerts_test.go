@@ -0,0 +1,210 @@
+package alerts
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// setup points the alert store to an empty file in a temporary directory
+func setup(t *testing.T) {
+	alertsFilename = filepath.Join(t.TempDir(), "alerts_state.json")
+	alerts = nil
+}
+
+func TestEvaluate(t *testing.T) {
+	const analyzer = "test-analyzer"
+
+	tests := []struct {
+		name             string
+		existing         map[string]*Alert
+		evaluated        []string
+		firing           []string
+		expectedNotify   []string
+		expectedResolved []string
+		expectedStatus   map[string]Status
+	}{
+		{
+			name:           "new alert is notified",
+			evaluated:      []string{"a", "b"},
+			firing:         []string{"a"},
+			expectedNotify: []string{"a"},
+			expectedStatus: map[string]Status{"a": Firing},
+		},
+		{
+			name: "alert notified within cooldown is not notified again",
+			existing: map[string]*Alert{
+				"a": {Status: Firing, LastNotified: time.Now().Add(-time.Hour)},
+			},
+			evaluated:      []string{"a"},
+			firing:         []string{"a"},
+			expectedStatus: map[string]Status{"a": Firing},
+		},
+		{
+			name: "alert notified before cooldown is notified again",
+			existing: map[string]*Alert{
+				"a": {Status: Firing, LastNotified: time.Now().Add(-cooldown)},
+			},
+			evaluated:      []string{"a"},
+			firing:         []string{"a"},
+			expectedNotify: []string{"a"},
+			expectedStatus: map[string]Status{"a": Firing},
+		},
+		{
+			name: "alert never delivered is notified again",
+			existing: map[string]*Alert{
+				"a": {Status: Firing},
+			},
+			evaluated:      []string{"a"},
+			firing:         []string{"a"},
+			expectedNotify: []string{"a"},
+			expectedStatus: map[string]Status{"a": Firing},
+		},
+		{
+			name: "acknowledged and snoozed alerts are not notified",
+			existing: map[string]*Alert{
+				"a": {Status: Firing, AckedBy: "user"},
+				"b": {Status: Firing, SnoozedUntil: time.Now().Add(time.Hour)},
+			},
+			evaluated:      []string{"a", "b"},
+			firing:         []string{"a", "b"},
+			expectedStatus: map[string]Status{"a": Firing, "b": Firing},
+		},
+		{
+			name: "notified alert which cleared is resolved",
+			existing: map[string]*Alert{
+				"a": {Status: Firing, LastNotified: time.Now().Add(-time.Hour)},
+				"b": {Status: Firing},
+			},
+			evaluated:        []string{"a", "b"},
+			expectedResolved: []string{"a"},
+			expectedStatus:   map[string]Status{"a": Resolved, "b": Resolved},
+		},
+		{
+			name: "alert not evaluated is left untouched",
+			existing: map[string]*Alert{
+				"a": {Status: Firing, LastNotified: time.Now().Add(-time.Hour)},
+			},
+			evaluated:      []string{"b"},
+			expectedStatus: map[string]Status{"a": Firing},
+		},
+		{
+			name: "resolved alert firing again is notified and acknowledgement is reset",
+			existing: map[string]*Alert{
+				"a": {Status: Resolved, AckedBy: "user", LastNotified: time.Now().Add(-time.Hour)},
+			},
+			evaluated:      []string{"a"},
+			firing:         []string{"a"},
+			expectedNotify: []string{"a"},
+			expectedStatus: map[string]Status{"a": Firing},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			alerts = make(map[string]*Alert)
+			for subject, a := range tt.existing {
+				a.Analyzer = analyzer
+				a.Subject = subject
+				alerts[a.ID()] = a
+			}
+
+			notify, resolved, err := Evaluate(analyzer, tt.evaluated, tt.firing, logr.Discard())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(notify) != len(tt.expectedNotify) || (len(notify) != 0 && !reflect.DeepEqual(notify, tt.expectedNotify)) {
+				t.Errorf("notify = %v, expected %v", notify, tt.expectedNotify)
+			}
+			if len(resolved) != len(tt.expectedResolved) ||
+				(len(resolved) != 0 && !reflect.DeepEqual(resolved, tt.expectedResolved)) {
+				t.Errorf("resolved = %v, expected %v", resolved, tt.expectedResolved)
+			}
+			for subject, status := range tt.expectedStatus {
+				if a := alerts[GetID(analyzer, subject)]; a == nil || a.Status != status {
+					t.Errorf("alert %s: expected status %s, got %+v", subject, status, a)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkNotified(t *testing.T) {
+	setup(t)
+
+	notify, _, err := Evaluate("analyzer", []string{"a"}, []string{"a"}, logr.Discard())
+	if err != nil || len(notify) != 1 {
+		t.Fatalf("unexpected result: %v %v", notify, err)
+	}
+
+	// Delivery failed: alert must be notified again
+	if notify, _, _ = Evaluate("analyzer", []string{"a"}, []string{"a"}, logr.Discard()); len(notify) != 1 {
+		t.Errorf("expected alert to be notified again, got %v", notify)
+	}
+
+	if err := MarkNotified("analyzer", notify, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if notify, _, _ = Evaluate("analyzer", []string{"a"}, []string{"a"}, logr.Discard()); len(notify) != 0 {
+		t.Errorf("expected alert not to be notified, got %v", notify)
+	}
+}
+
+func TestSnooze(t *testing.T) {
+	existing := []*Alert{
+		{Analyzer: "test-duration", Subject: "test1", Status: Firing},
+		{Analyzer: "test-duration", Subject: "shared", Status: Firing},
+		{Analyzer: "report-duration", Subject: "shared", Status: Resolved},
+	}
+
+	tests := []struct {
+		name          string
+		id            string
+		expectedID    string
+		expectedError string
+	}{
+		{name: "by ID", id: "test-duration/test1", expectedID: "test-duration/test1"},
+		{name: "by subject", id: "test1", expectedID: "test-duration/test1"},
+		{name: "resolved alert", id: "report-duration/shared", expectedID: "report-duration/shared"},
+		{name: "ambiguous subject", id: "shared",
+			expectedError: "report-duration/shared, test-duration/shared"},
+		{name: "alert never fired", id: "usage-variance/default:app", expectedID: "usage-variance/default:app"},
+		{name: "unknown subject", id: "unknown", expectedError: "no such alert"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			alerts = make(map[string]*Alert)
+			for i := range existing {
+				a := *existing[i]
+				alerts[a.ID()] = &a
+			}
+
+			a, err := Snooze(tt.id, time.Hour, logr.Discard())
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if len(alerts) != len(existing) {
+					t.Errorf("expected no alert to be created, got %d alerts", len(alerts))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a.ID() != tt.expectedID {
+				t.Errorf("snoozed %s, expected %s", a.ID(), tt.expectedID)
+			}
+			if !time.Now().Before(a.SnoozedUntil) {
+				t.Errorf("alert not snoozed: %v", a.SnoozedUntil)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package analyze
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/alerts"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/routing"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+// Names of the analyzers raising alerts
+const (
+	testDurationAnalyzer   = "test-duration"
+	reportDurationAnalyzer = "report-duration"
+	UsageVarianceAnalyzer  = "usage-variance"
+	memoryLimitAnalyzer    = "memory-limit"
+	memoryNoLimitAnalyzer  = "memory-no-limit"
+)
+
+const (
+	// AckText is the command used to acknowledge an alert
+	AckText = "ack"
+	// SnoozeText is the command used to snooze an alert
+	SnoozeText = "snooze"
+)
+
+// filterAlerts records in the alert store which subjects are currently in alert state for analyzer.
+// evaluated contains all subjects analyzer was able to evaluate.
+// plots contains, per subject in alert state, the generated plots.
+// Returns:
+// - the subjects that need to be notified;
+// - the subjects, previously notified, that are not in alert state anymore.
+// If alert store cannot be used, all subjects are notified.
+func filterAlerts(analyzer string, evaluated []string, plots map[string][]string,
+	logger logr.Logger) (notify, resolved []string) {
+	firing := make([]string, 0)
+	for subject := range plots {
+		firing = append(firing, subject)
+	}
+	sort.Strings(firing)
+
+	notify, resolved, err := alerts.Evaluate(analyzer, evaluated, firing, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to evaluate alerts for %s. Err: %v", analyzer, err))
+		return firing, nil
+	}
+
+	return notify, resolved
+}
+
+// sendAlerts groups subjects to notify per owner. To each owner it sends, using owner
+// preferred channel, textMessage along with the alert IDs and a grid, created in ws, with the plots.
+// subjectOwner contains, per subject, the owner username. Subjects with no owner are
+// sent to the room.
+// extra, if not nil, is invoked per owner and returns text to append to the alert and
+// files to send, one per message, after the alert.
+// Alerts are marked as notified only once delivered.
+func sendAlerts(ws *artifacts.Workspace, analyzer, textMessage string, notify []string, plots map[string][]string,
+	subjectOwner map[string]string, extra func(subjects []string) (string, []string),
+	logger logr.Logger) {
+	for ownerName, subjects := range routing.Group(notify, subjectOwner) {
+		files := make([]string, 0)
+		for i := range subjects {
+			files = append(files, plots[subjects[i]]...)
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		gridFileName, err := createGrid(files, ws.Path(fmt.Sprintf("%s_grid_%s.png", analyzer, ownerName)), logger)
+		if err != nil {
+			continue
+		}
+
+		text := textMessage
+		var attachments []string
+		if extra != nil {
+			var extraText string
+			extraText, attachments = extra(subjects)
+			text += extraText
+		}
+		text += getAlertFooter(analyzer, subjects)
+
+		owner := routing.GetOwner(ownerName, logger)
+		if err := routing.Notify(owner, text, []string{gridFileName}, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send alert. Err: %v", err))
+			continue
+		}
+
+		if err := alerts.MarkNotified(analyzer, subjects, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to mark alerts as notified. Err: %v", err))
+		}
+
+		// Webex accepts a single file per message
+		for i := range attachments {
+			if err := routing.Notify(owner, fmt.Sprintf("Attachment for %s alert: %s", analyzer, filepath.Base(attachments[i])),
+				[]string{attachments[i]}, logger); err != nil {
+				logger.Info(fmt.Sprintf("Failed to send attachment. Err: %v", err))
+			}
+		}
+	}
+}
+
+// getAlertFooter returns a message listing alert IDs and how to stop notifications
+func getAlertFooter(analyzer string, subjects []string) string {
+	textMessage := "  \nAlert IDs:  \n"
+	for i := range subjects {
+		textMessage += fmt.Sprintf("1. %s  \n", alerts.GetID(analyzer, subjects[i]))
+	}
+	textMessage += fmt.Sprintf("  \nSend \"%s <alert ID>\" to acknowledge an alert or \"%s <alert ID> <duration>\" to snooze it.  \n",
+		AckText, SnoozeText)
+	return textMessage
+}
+
+// sendResolvedNotice sends a message listing alerts that are not firing anymore
+func sendResolvedNotice(webexClient *webexteams.Client, roomID, analyzer string,
+	resolved []string, logger logr.Logger) {
+	if len(resolved) == 0 {
+		return
+	}
+
+	textMessage := "Good news ✅ Following alerts are now resolved:  \n"
+	for i := range resolved {
+		textMessage += fmt.Sprintf("1. %s  \n", alerts.GetID(analyzer, resolved[i]))
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
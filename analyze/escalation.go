@@ -0,0 +1,307 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/alerts"
+	"github.com/gianlucam76/webex_bot/routing"
+	"github.com/gianlucam76/webex_bot/utils"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+const (
+	// escalationAnalyzer is the analyzer name used for escalated issues in the alert store
+	escalationAnalyzer = "issue-escalation"
+
+	// Env variables configuring escalation policy
+	escalationDaysEnv        = "E2E_ESCALATION_DAYS"
+	escalationOccurrencesEnv = "E2E_ESCALATION_OCCURRENCES"
+	escalationPriorityEnv    = "E2E_ESCALATION_PRIORITY"
+	escalationExemptEnv      = "E2E_ESCALATION_EXEMPT_LABELS"
+
+	defaultEscalationDays        = 14
+	defaultEscalationOccurrences = 5
+	defaultEscalationPriority    = "P0"
+	defaultEscalationExempt      = "no-escalation"
+)
+
+// escalationPolicy defines when an open issue is escalated
+type escalationPolicy struct {
+	// Days is the number of days after which an open issue is escalated
+	Days int
+	// Occurrences is the number of times failure must be seen for issue to be escalated
+	Occurrences int
+	// Priority is the jira priority escalated issues are moved to
+	Priority string
+	// ExemptLabels contains labels which exempt an issue from escalation
+	ExemptLabels []string
+}
+
+// escalatedIssue is an open issue which matched escalation policy
+type escalatedIssue struct {
+	issue       *jira.Issue
+	age         int
+	occurrences int
+}
+
+// getEscalationPolicy returns the escalation policy. Defaults are overridden
+// by E2E_ESCALATION_* env variables.
+func getEscalationPolicy(logger logr.Logger) *escalationPolicy {
+	policy := &escalationPolicy{
+		Days:         defaultEscalationDays,
+		Occurrences:  defaultEscalationOccurrences,
+		Priority:     defaultEscalationPriority,
+		ExemptLabels: []string{defaultEscalationExempt},
+	}
+
+	if v, ok := os.LookupEnv(escalationDaysEnv); ok {
+		if days, err := strconv.Atoi(v); err == nil {
+			policy.Days = days
+		} else {
+			logger.Info(fmt.Sprintf("Invalid %s value %q. Err: %v", escalationDaysEnv, v, err))
+		}
+	}
+
+	if v, ok := os.LookupEnv(escalationOccurrencesEnv); ok {
+		if occurrences, err := strconv.Atoi(v); err == nil {
+			policy.Occurrences = occurrences
+		} else {
+			logger.Info(fmt.Sprintf("Invalid %s value %q. Err: %v", escalationOccurrencesEnv, v, err))
+		}
+	}
+
+	if v, ok := os.LookupEnv(escalationPriorityEnv); ok && v != "" {
+		policy.Priority = v
+	}
+
+	if v, ok := os.LookupEnv(escalationExemptEnv); ok {
+		policy.ExemptLabels = make([]string, 0)
+		for _, label := range strings.Split(v, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				policy.ExemptLabels = append(policy.ExemptLabels, label)
+			}
+		}
+	}
+
+	return policy
+}
+
+// getEscalatedIssues returns open issues matching escalation policy and the keys
+// of all open issues evaluated against it
+func getEscalatedIssues(ctx context.Context, jiraClient *jira.Client,
+	policy *escalationPolicy, logger logr.Logger) ([]escalatedIssue, []string, error) {
+	openIssues, err := utils.GetOpenIssues(ctx, jiraClient, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get open issues. Err: %v", err))
+		return nil, nil, err
+	}
+
+	result := make([]escalatedIssue, 0)
+	evaluated := make([]string, 0)
+	for i := range openIssues {
+		issue := &openIssues[i]
+		evaluated = append(evaluated, issue.Key)
+
+		if isExempt(issue, policy) {
+			logger.Info(fmt.Sprintf("Issue %s is exempt from escalation", issue.Key))
+			continue
+		}
+
+		age := int(time.Since(time.Time(issue.Fields.Created)).Hours() / 24)
+		occurrences := len(utils.GetAtomComments(issue, false))
+		if age > policy.Days || occurrences > policy.Occurrences {
+			result = append(result, escalatedIssue{issue: issue, age: age, occurrences: occurrences})
+		}
+	}
+
+	return result, evaluated, nil
+}
+
+// checkEscalations checks open issues against escalation policy. Issues open for too
+// long or seen too many times are moved to a higher priority and assignee and assignee's
+// manager are tagged.
+func checkEscalations(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client,
+	logger logr.Logger) {
+	policy := getEscalationPolicy(logger)
+
+	escalated, evaluated, err := getEscalatedIssues(ctx, jiraClient, policy, logger)
+	if err != nil {
+		return
+	}
+
+	keys := make([]string, len(escalated))
+	escalatedMap := make(map[string]escalatedIssue)
+	for i := range escalated {
+		keys[i] = escalated[i].issue.Key
+		escalatedMap[escalated[i].issue.Key] = escalated[i]
+	}
+
+	// Alert store prevents escalating same issue every day
+	notify, _, err := alerts.Evaluate(escalationAnalyzer, evaluated, keys, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to evaluate escalations. Err: %v", err))
+		return
+	}
+
+	for i := range notify {
+		e := escalatedMap[notify[i]]
+		raised, err := raisePriority(ctx, jiraClient, e.issue, policy.Priority, logger)
+
+		textMessage := fmt.Sprintf("⏫ %s escalated: open %d days, seen %d times (policy: more than %d days or %d times).  \n",
+			utils.GetIssueLink(e.issue.Key), e.age, e.occurrences, policy.Days, policy.Occurrences)
+		switch {
+		case err != nil:
+			textMessage += fmt.Sprintf("Failed to move priority to %s. Err: %v  \n", policy.Priority, err)
+		case raised:
+			textMessage += fmt.Sprintf("Priority moved to %s.  \n", policy.Priority)
+		default:
+			textMessage += fmt.Sprintf("Priority is already %s or higher.  \n", policy.Priority)
+		}
+		textMessage += getEscalationMentions(e.issue, logger)
+		textMessage += getAlertFooter(escalationAnalyzer, []string{e.issue.Key})
+
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+			continue
+		}
+
+		if err := alerts.MarkNotified(escalationAnalyzer, []string{e.issue.Key}, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to mark escalation as notified. Err: %v", err))
+		}
+	}
+}
+
+func sendEscalationDigest(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client,
+	logger logr.Logger) {
+	policy := getEscalationPolicy(logger)
+
+	escalated, _, err := getEscalatedIssues(ctx, jiraClient, policy, logger)
+	if err != nil {
+		return
+	}
+
+	if len(escalated) == 0 {
+		logger.Info("No escalated issues. Nothing to do.")
+		return
+	}
+
+	textMessage := fmt.Sprintf("Hello cloudstack team here is the weekly escalation digest (issues open more than %d days or seen more than %d times):  \n",
+		policy.Days, policy.Occurrences)
+	for i := range escalated {
+		assignee := ""
+		if escalated[i].issue.Fields.Assignee != nil {
+			assignee = escalated[i].issue.Fields.Assignee.Name
+		}
+		priority := ""
+		if escalated[i].issue.Fields.Priority != nil {
+			priority = escalated[i].issue.Fields.Priority.Name
+		}
+		textMessage += fmt.Sprintf("1. %s %s. Open %d days, seen %d times, priority %s. Assignee %s  \n",
+			utils.GetIssueLink(escalated[i].issue.Key), escalated[i].issue.Fields.Summary,
+			escalated[i].age, escalated[i].occurrences, priority, getAssigneeMention(assignee))
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// isExempt returns true if issue has any of the labels exempting it from escalation
+func isExempt(issue *jira.Issue, policy *escalationPolicy) bool {
+	for i := range issue.Fields.Labels {
+		for j := range policy.ExemptLabels {
+			if issue.Fields.Labels[i] == policy.ExemptLabels[j] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// raisePriority moves issue to priority, only if issue current priority is lower.
+// Returns true if priority was changed.
+func raisePriority(ctx context.Context, jiraClient *jira.Client, issue *jira.Issue,
+	priority string, logger logr.Logger) (bool, error) {
+	priorities, _, err := jiraClient.Priority.GetListWithContext(ctx)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get jira priorities. Err: %v", err))
+		return false, err
+	}
+
+	current := ""
+	if issue.Fields.Priority != nil {
+		current = issue.Fields.Priority.Name
+	}
+
+	lower, err := isLowerPriority(current, priority, priorities)
+	if err != nil || !lower {
+		return false, err
+	}
+
+	data := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"priority": map[string]string{"name": priority},
+		},
+	}
+	if _, err := jiraClient.Issue.UpdateIssueWithContext(ctx, issue.ID, data); err != nil {
+		logger.Info(fmt.Sprintf("Failed to update priority of issue %s. Err: %v", issue.Key, err))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// isLowerPriority returns true if current is lower than target. priorities are
+// ordered as returned by jira, highest first. An issue with no priority is considered
+// lower than any priority. An unknown priority is never considered lower, so it is left
+// untouched.
+func isLowerPriority(current, target string, priorities []jira.Priority) (bool, error) {
+	rank := make(map[string]int)
+	for i := range priorities {
+		rank[priorities[i].Name] = i
+	}
+
+	targetRank, ok := rank[target]
+	if !ok {
+		return false, fmt.Errorf("unknown priority %s", target)
+	}
+
+	if current == "" {
+		return true, nil
+	}
+
+	currentRank, ok := rank[current]
+	if !ok {
+		return false, nil
+	}
+
+	return currentRank > targetRank, nil
+}
+
+// getEscalationMentions returns the markdown tagging issue assignee and assignee's manager
+func getEscalationMentions(issue *jira.Issue, logger logr.Logger) string {
+	if issue.Fields.Assignee == nil {
+		return "Issue has no assignee.  \n"
+	}
+
+	owner := routing.GetOwner(issue.Fields.Assignee.Name, logger)
+	text := fmt.Sprintf("Assignee %s", owner.Mention())
+	if manager := routing.GetOwner(owner.Manager, logger); manager != nil {
+		text += fmt.Sprintf(" Manager %s", manager.Mention())
+	}
+
+	return text + "  \n"
+}
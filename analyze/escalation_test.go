@@ -0,0 +1,38 @@
+package analyze
+
+import (
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+func TestIsLowerPriority(t *testing.T) {
+	priorities := []jira.Priority{{Name: "P0"}, {Name: "P1"}, {Name: "P2"}, {Name: "P3"}}
+
+	tests := []struct {
+		name        string
+		current     string
+		target      string
+		expected    bool
+		expectError bool
+	}{
+		{name: "lower priority is raised", current: "P2", target: "P0", expected: true},
+		{name: "same priority", current: "P0", target: "P0"},
+		{name: "higher priority is not downgraded", current: "P0", target: "P1"},
+		{name: "no priority", current: "", target: "P1", expected: true},
+		{name: "unknown current priority", current: "Blocker", target: "P1"},
+		{name: "unknown target priority", current: "P2", target: "Critical", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isLowerPriority(tt.current, tt.target, priorities)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("isLowerPriority(%q, %q) = %v, expected %v", tt.current, tt.target, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package analyze
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	elastic "github.com/olivere/elastic/v7"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/metrics"
+	"github.com/gianlucam76/webex_bot/utils"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+// Datasets which can be exported
+const (
+	ExportResults   = "results"
+	ExportDurations = "durations"
+	ExportReports   = "reports"
+	ExportUsage     = "usage"
+)
+
+// Formats datasets can be exported in
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+)
+
+const (
+	// Default time range considered when exporting
+	defaultExportRange = 14 * 24 * time.Hour
+
+	// Maximum number of elastic DB entries exported
+	maxExportedEntries = 5000
+)
+
+// exportRangeRegex matches a time range like 30d or 12w
+var exportRangeRegex = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// ExportRequest describes a dataset to export
+type ExportRequest struct {
+	// What is the dataset to export (results, durations, reports or usage)
+	What string
+	// Filter restricts exported entries. It is a test name for results and durations,
+	// a report type for reports and a namespace for usage. Empty means no filter.
+	Filter string
+	// Range is how far back in time entries are exported
+	Range time.Duration
+	// Format is either csv or json
+	Format string
+}
+
+// GetExportDatasets returns the datasets which can be exported
+func GetExportDatasets() []string {
+	return []string{ExportResults, ExportDurations, ExportReports, ExportUsage}
+}
+
+// ParseExportRequest parses the arguments of an export command:
+// <what> [filter] [range] [format]. Range is in days (30d) or weeks (4w).
+func ParseExportRequest(args []string) (*ExportRequest, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing dataset. Valid ones are %s", strings.Join(GetExportDatasets(), ", "))
+	}
+
+	request := &ExportRequest{
+		What:   strings.ToLower(args[0]),
+		Range:  defaultExportRange,
+		Format: ExportCSV,
+	}
+
+	valid := false
+	for _, d := range GetExportDatasets() {
+		if d == request.What {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("unknown dataset %q. Valid ones are %s", args[0], strings.Join(GetExportDatasets(), ", "))
+	}
+
+	for _, arg := range args[1:] {
+		lower := strings.ToLower(arg)
+		if lower == ExportCSV || lower == ExportJSON {
+			request.Format = lower
+		} else if m := exportRangeRegex.FindStringSubmatch(lower); m != nil {
+			value, err := strconv.Atoi(m[1])
+			if err != nil || value == 0 {
+				return nil, fmt.Errorf("invalid range %q", arg)
+			}
+			days := value
+			if m[2] == "w" {
+				days = 7 * value
+			}
+			request.Range = time.Duration(days) * 24 * time.Hour
+		} else if request.Filter == "" {
+			request.Filter = arg
+		} else {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	return request, nil
+}
+
+// Export returns the requested dataset, in CSV or JSON format, as an in-memory
+// attachment along with the number of exported entries. Truncated is set when more
+// than maxExportedEntries entries matched and only the most recent ones were exported.
+func Export(ctx context.Context, request *ExportRequest,
+	logger logr.Logger) (attachment *webex_utils.Attachment, entries int, truncated bool, err error) {
+	var header []string
+	var rows [][]string
+	var data interface{}
+
+	since := time.Now().Add(-request.Range)
+	switch request.What {
+	case ExportResults, ExportDurations:
+		var results []es_utils.Result
+		results, truncated, err = getExportResults(ctx, request, since, logger)
+		header = []string{"environment", "run", "test", "result", "startTime", "durationInMinutes", "maintainer"}
+		for i := range results {
+			rows = append(rows, []string{results[i].Environment, strconv.Itoa(results[i].Run), results[i].Name,
+				results[i].Result, results[i].StartTime.Format(time.RFC3339),
+				strconv.FormatFloat(results[i].DurationInMinutes, 'f', 2, 64), results[i].Maintainer})
+		}
+		data = results
+	case ExportReports:
+		var reports []es_utils.Report
+		reports, truncated, err = getExportReports(ctx, request, since, logger)
+		header = []string{"environment", "run", "type", "subType", "name", "createdTime", "durationInMinutes"}
+		for i := range reports {
+			rows = append(rows, []string{reports[i].Environment, strconv.Itoa(reports[i].Run), reports[i].Type,
+				reports[i].SubType, reports[i].Name, reports[i].CreatedTime.Format(time.RFC3339),
+				strconv.FormatFloat(reports[i].DurationInMinutes, 'f', 2, 64)})
+		}
+		data = reports
+	case ExportUsage:
+		var usage []es_utils.UsageReport
+		usage, truncated, err = getExportUsage(ctx, request, since, logger)
+		header = []string{"environment", "run", "pod", "createdTime", "memoryKi", "memoryLimitKi", "cpuMilli", "cpuLimitMilli"}
+		for i := range usage {
+			rows = append(rows, []string{usage[i].Environment, strconv.Itoa(usage[i].Run), usage[i].Name,
+				usage[i].CreatedTime.Format(time.RFC3339),
+				strconv.FormatInt(usage[i].Memory, 10), strconv.FormatInt(usage[i].MemoryLimit, 10),
+				strconv.FormatInt(usage[i].CPU, 10), strconv.FormatInt(usage[i].CPULimit, 10)})
+		}
+		data = usage
+	default:
+		err = fmt.Errorf("unknown dataset %q", request.What)
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	attachment = &webex_utils.Attachment{
+		Name: fmt.Sprintf("export_%s_%s.%s", request.What, time.Now().Format("20060102"), request.Format),
+	}
+	if request.Format == ExportJSON {
+		attachment.Content, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		attachment.Content, err = encodeCSV(header, rows)
+	}
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to encode %s. Err: %v", request.What, err))
+		return nil, 0, false, err
+	}
+
+	return attachment, len(rows), truncated, nil
+}
+
+// getExportResults returns test results started after since. For durations dataset
+// only passed tests are returned.
+func getExportResults(ctx context.Context, request *ExportRequest, since time.Time,
+	logger logr.Logger) ([]es_utils.Result, bool, error) {
+	var filters []elastic.Query
+	if request.What == ExportDurations {
+		// durations are only meaningful for passed tests
+		filters = append(filters, elastic.NewMatchQuery("result", "passed"))
+	}
+	if request.Filter != "" {
+		filters = append(filters, elastic.NewTermQuery("name.keyword", request.Filter))
+	}
+
+	searchResult, truncated, err := searchSince(ctx, utils.ResultsIndex, "startTime", since, filters, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get results. Err: %v", err))
+		return nil, false, err
+	}
+
+	results := make([]es_utils.Result, 0)
+	var rtyp es_utils.Result
+	for _, item := range searchResult.Each(reflect.TypeOf(rtyp)) {
+		results = append(results, item.(es_utils.Result))
+	}
+
+	return results, truncated, nil
+}
+
+// getExportReports returns reports created after since
+func getExportReports(ctx context.Context, request *ExportRequest, since time.Time,
+	logger logr.Logger) ([]es_utils.Report, bool, error) {
+	var filters []elastic.Query
+	if request.Filter != "" {
+		filters = append(filters, elastic.NewMatchQuery("type", request.Filter))
+	}
+
+	searchResult, truncated, err := searchSince(ctx, utils.ReportsIndex, "createdTime", since, filters, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get reports. Err: %v", err))
+		return nil, false, err
+	}
+
+	reports := make([]es_utils.Report, 0)
+	var rtyp es_utils.Report
+	for _, item := range searchResult.Each(reflect.TypeOf(rtyp)) {
+		reports = append(reports, item.(es_utils.Report))
+	}
+
+	return reports, truncated, nil
+}
+
+// getExportUsage returns usage reports created after since. If a namespace is
+// requested, only usage for pods in that namespace is returned.
+func getExportUsage(ctx context.Context, request *ExportRequest, since time.Time,
+	logger logr.Logger) ([]es_utils.UsageReport, bool, error) {
+	var filters []elastic.Query
+	if request.Filter != "" {
+		// pod names are in the form namespace:name
+		filters = append(filters, elastic.NewPrefixQuery("name.keyword", request.Filter+":"))
+	}
+
+	searchResult, truncated, err := searchSince(ctx, utils.UsageIndex, "createdTime", since, filters, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get usage reports. Err: %v", err))
+		return nil, false, err
+	}
+
+	usage := make([]es_utils.UsageReport, 0)
+	var rtyp es_utils.UsageReport
+	for _, item := range searchResult.Each(reflect.TypeOf(rtyp)) {
+		usage = append(usage, item.(es_utils.UsageReport))
+	}
+
+	return usage, truncated, nil
+}
+
+// searchSince returns, most recent first, at most maxExportedEntries entries of index
+// whose timeField is after since and which match all filters. It also returns whether
+// more entries matched than were returned.
+func searchSince(ctx context.Context, index, timeField string, since time.Time,
+	filters []elastic.Query, logger logr.Logger) (*elastic.SearchResult, bool, error) {
+	c, err := es_utils.GetClient(utils.ElasticURL)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get client. Err: %v", err))
+		metrics.DependencyError(metrics.Elastic)
+		return nil, false, err
+	}
+
+	if err = es_utils.VerifyIndex(ctx, c, index); err != nil {
+		logger.Info(fmt.Sprintf("Failed to verify index %s. Err: %v", index, err))
+		metrics.DependencyError(metrics.Elastic)
+		return nil, false, err
+	}
+
+	query := elastic.NewBoolQuery().Filter(elastic.NewRangeQuery(timeField).Gt(since.Format(time.RFC3339)))
+	query.Filter(filters...)
+
+	searchResult, err := c.Search().Index(index).Query(query).Size(maxExportedEntries).
+		SortBy(elastic.NewFieldSort(timeField).Desc()).
+		Do(ctx)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to run query on %s. Err: %v", index, err))
+		metrics.DependencyError(metrics.Elastic)
+		return nil, false, err
+	}
+
+	return searchResult, searchResult.TotalHits() > int64(len(searchResult.Hits.Hits)), nil
+}
+
+// encodeCSV returns header and rows in CSV format
+func encodeCSV(header []string, rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
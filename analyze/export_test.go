@@ -0,0 +1,53 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExportRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected *ExportRequest
+	}{
+		{name: "no dataset"},
+		{name: "unknown dataset", args: []string{"logs"}},
+		{
+			name:     "defaults",
+			args:     []string{"Results"},
+			expected: &ExportRequest{What: ExportResults, Range: defaultExportRange, Format: ExportCSV},
+		},
+		{
+			name: "filter, range in weeks and format",
+			args: []string{"durations", "TestUpgrade", "4w", "JSON"},
+			expected: &ExportRequest{What: ExportDurations, Filter: "TestUpgrade",
+				Range: 28 * 24 * time.Hour, Format: ExportJSON},
+		},
+		{
+			name:     "range in days",
+			args:     []string{"usage", "30d", "kube-system"},
+			expected: &ExportRequest{What: ExportUsage, Filter: "kube-system", Range: 30 * 24 * time.Hour, Format: ExportCSV},
+		},
+		{name: "zero range", args: []string{"reports", "0d"}},
+		{name: "two filters", args: []string{"reports", "upgrade", "install"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExportRequest(tt.args)
+			if tt.expected == nil {
+				if err == nil {
+					t.Errorf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != *tt.expected {
+				t.Errorf("got %+v, expected %+v", *got, *tt.expected)
+			}
+		})
+	}
+}
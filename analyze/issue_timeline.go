@@ -0,0 +1,186 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/utils"
+)
+
+// jiraTimeLayout is the layout of times returned by jira for comments
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// Rows of the issue timeline chart
+const (
+	failedRow     float64 = 0
+	passedRow     float64 = 1
+	occurrenceRow float64 = 2
+)
+
+// issueTestRegexp extracts the test name from the description of issues filed by atom user
+var issueTestRegexp = regexp.MustCompile(`Test (\S+) failed`)
+
+// Occurrence is a failure reported by atom user on a jira issue
+type Occurrence struct {
+	// Time is when the comment was added
+	Time time.Time
+	// Environment is the environment (ucs or vcs) where failure happened, if known
+	Environment string
+	// Run is the run where failure happened, if known
+	Run string
+}
+
+// GetIssueOccurrences returns the failures atom user reported on issue, from first to last,
+// and the name of the test the issue was filed for (empty if not found).
+func GetIssueOccurrences(ctx context.Context, jiraClient *jira.Client, key string,
+	logger logr.Logger) (*jira.Issue, []Occurrence, string, error) {
+	issue, _, err := jiraClient.Issue.GetWithContext(ctx, key, nil)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get issue %s. Err: %v", key, err))
+		return nil, nil, "", err
+	}
+
+	occurrences := make([]Occurrence, 0)
+	for _, c := range utils.GetAtomComments(issue, false) {
+		created, err := time.Parse(jiraTimeLayout, c.Created)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to parse comment time %q. Err: %v", c.Created, err))
+			continue
+		}
+		env, run := utils.GetRunFromComment(c.Body)
+		occurrences = append(occurrences, Occurrence{Time: created, Environment: env, Run: run})
+	}
+
+	var testName string
+	if m := issueTestRegexp.FindStringSubmatch(issue.Fields.Description); m != nil {
+		testName = m[1]
+	}
+
+	return issue, occurrences, testName, nil
+}
+
+// CreateIssueTimeline creates a chart with issue occurrences over time. If testName
+// is not empty, chart also contains test pass/fail history.
+// Returns the name of the file, in ws, containing the chart.
+func CreateIssueTimeline(ctx context.Context, ws *artifacts.Workspace, key, testName string, occurrences []Occurrence,
+	logger logr.Logger) (string, error) {
+	logger.Info(fmt.Sprintf("Generate timeline for issue %s", key))
+
+	p := plot.New()
+	p.Title.Text = fmt.Sprintf("%s %s", key, testName)
+	p.X.Label.Text = "Time"
+	p.X.Tick.Marker = plot.TimeTicks{Format: "01/02"}
+	p.Y.Tick.Marker = plot.ConstantTicks([]plot.Tick{
+		{Value: failedRow, Label: "failed"},
+		{Value: passedRow, Label: "passed"},
+		{Value: occurrenceRow, Label: "jira"},
+	})
+	p.Y.Min = failedRow - 1
+	p.Y.Max = occurrenceRow + 1
+
+	occurrencePts := make(plotter.XYs, len(occurrences))
+	for i := range occurrences {
+		occurrencePts[i].X = float64(occurrences[i].Time.Unix())
+		occurrencePts[i].Y = occurrenceRow
+	}
+	if err := addTimelineRow(p, "Seen by atom", occurrencePts, draw.TriangleGlyph{},
+		color.RGBA{B: 255, A: 255}); err != nil {
+		logger.Info(fmt.Sprintf("Failed to add occurrences. Err: %v", err))
+		return "", err
+	}
+
+	if testName != "" {
+		passedPts, failedPts, err := getTestHistory(ctx, testName, logger)
+		if err == nil {
+			if err := addTimelineRow(p, "Passed", passedPts, draw.CircleGlyph{},
+				color.RGBA{G: 180, A: 255}); err != nil {
+				logger.Info(fmt.Sprintf("Failed to add passed results. Err: %v", err))
+				return "", err
+			}
+			if err := addTimelineRow(p, "Failed", failedPts, draw.CrossGlyph{},
+				color.RGBA{R: 255, A: 255}); err != nil {
+				logger.Info(fmt.Sprintf("Failed to add failed results. Err: %v", err))
+				return "", err
+			}
+		}
+	}
+
+	fileName := ws.Path(fmt.Sprintf("timeline_%s.png", key))
+	if err := p.Save(8*vg.Inch, 3*vg.Inch, fileName); err != nil {
+		logger.Info(fmt.Sprintf("Failed to save timeline. Err: %v", err))
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// addTimelineRow adds a row of points to the timeline chart
+func addTimelineRow(p *plot.Plot, name string, pts plotter.XYs, shape draw.GlyphDrawer,
+	c color.Color) error {
+	if len(pts) == 0 {
+		return nil
+	}
+
+	s, err := plotter.NewScatter(pts)
+	if err != nil {
+		return err
+	}
+	s.GlyphStyle.Shape = shape
+	s.GlyphStyle.Color = c
+	s.GlyphStyle.Radius = vg.Points(4)
+	p.Add(s)
+	p.Legend.Add(name, s)
+
+	return nil
+}
+
+// getTestHistory returns, for both ucs and vcs, start time of each run where test
+// passed and each run where test failed
+func getTestHistory(ctx context.Context, testName string,
+	logger logr.Logger) (passed, failed plotter.XYs, err error) {
+	searchResult, err := es_utils.GetResults(ctx, logger,
+		"",       // no specific run
+		testName, // for this specific test
+		false,    // any environment
+		false,    // any environment
+		false,    // no filter passed tests
+		false,    // no filter failed tests
+		false,    // no filter skipped tests
+		200)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get results for test %q. Error %v", testName, err))
+		return nil, nil, err
+	}
+
+	passed = make(plotter.XYs, 0)
+	failed = make(plotter.XYs, 0)
+	var rtyp es_utils.Result
+	for _, item := range searchResult.Each(reflect.TypeOf(rtyp)) {
+		r := item.(es_utils.Result)
+		if r.StartTime.IsZero() {
+			continue
+		}
+		x := float64(r.StartTime.Unix())
+		switch r.Result {
+		case "passed":
+			passed = append(passed, plotter.XY{X: x, Y: passedRow})
+		case "failed":
+			failed = append(failed, plotter.XY{X: x, Y: failedRow})
+		}
+	}
+
+	return passed, failed, nil
+}
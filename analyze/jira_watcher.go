@@ -0,0 +1,235 @@
+package analyze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/state"
+	"github.com/gianlucam76/webex_bot/utils"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+// jiraWatcherFilename is the file where jira watcher state is persisted
+var jiraWatcherFilename = state.GetPath("jira_watcher_state.json")
+
+const (
+	// How often, in minutes, jira issues are checked
+	jiraWatcherInterval = 15
+
+	// Resolved issues are remembered, to detect when they are reopened, for this long
+	resolvedRetention = 90 * 24 * time.Hour
+)
+
+// issueSnapshot is the last known state of an issue filed by atom user
+type issueSnapshot struct {
+	// Summary is the issue summary
+	Summary string `json:"summary"`
+	// Assignee is the issue assignee username
+	Assignee string `json:"assignee,omitempty"`
+	// Resolved is true if issue was last seen resolved or closed
+	Resolved bool `json:"resolved,omitempty"`
+	// ResolvedTime is when bot detected the issue was resolved
+	ResolvedTime time.Time `json:"resolvedTime,omitempty"`
+	// Occurrences is the number of comments atom user added to the issue
+	Occurrences int `json:"occurrences"`
+}
+
+// jiraWatcherMux serializes checks on jira issues
+var jiraWatcherMux sync.Mutex
+
+// checkJiraIssues compares the issues filed by atom user with the
+// previous check and sends a message when an issue is filed, reassigned, resolved,
+// reopened or when atom user reports a new occurrence of the failure.
+func checkJiraIssues(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client,
+	logger logr.Logger) {
+	jiraWatcherMux.Lock()
+	defer jiraWatcherMux.Unlock()
+
+	previous, err := loadJiraWatcherState(logger)
+	if err != nil {
+		return
+	}
+
+	openIssues, err := utils.GetOpenIssues(ctx, jiraClient, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get open issues. Err: %v", err))
+		return
+	}
+
+	current := make(map[string]*issueSnapshot)
+	events := make([]string, 0)
+
+	for i := range openIssues {
+		issue := &openIssues[i]
+		key := issue.Key
+
+		snapshot := getIssueSnapshot(issue)
+		current[key] = snapshot
+
+		if previous == nil {
+			continue
+		}
+
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			events = append(events, fmt.Sprintf("🆕 %s filed: %s. Assignee %s",
+				utils.GetIssueLink(key), snapshot.Summary, getAssigneeMention(snapshot.Assignee)))
+		case old.Resolved:
+			events = append(events, fmt.Sprintf("🔁 %s reopened. Assignee %s",
+				utils.GetIssueLink(key), getAssigneeMention(snapshot.Assignee)))
+		case old.Assignee != snapshot.Assignee:
+			events = append(events, fmt.Sprintf("👤 %s reassigned from %s to %s",
+				utils.GetIssueLink(key), old.Assignee, getAssigneeMention(snapshot.Assignee)))
+		}
+
+		if ok && snapshot.Occurrences > old.Occurrences {
+			events = append(events, getOccurrenceEvents(key, issue, old.Occurrences)...)
+		}
+	}
+
+	// Issues not open anymore
+	for key, old := range previous {
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		if old.Resolved {
+			if time.Since(old.ResolvedTime) < resolvedRetention {
+				current[key] = old
+			}
+			continue
+		}
+
+		issue, _, err := jiraClient.Issue.GetWithContext(ctx, key, nil)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to get issue %s. Err: %v", key, err))
+			current[key] = old
+			continue
+		}
+
+		if !isResolved(issue) {
+			// Issue does not match open issue query anymore for other reasons. Forget it.
+			continue
+		}
+
+		snapshot := getIssueSnapshot(issue)
+		snapshot.Resolved = true
+		snapshot.ResolvedTime = time.Now()
+		current[key] = snapshot
+
+		events = append(events, fmt.Sprintf("✅ %s %s", utils.GetIssueLink(key), issue.Fields.Status.Name))
+	}
+
+	storeJiraWatcherState(current, logger)
+
+	if len(events) == 0 {
+		return
+	}
+
+	textMessage := "Jira updates on e2e issues:  \n"
+	for i := range events {
+		textMessage += fmt.Sprintf("1. %s  \n", events[i])
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// getIssueSnapshot returns the snapshot of an open issue
+func getIssueSnapshot(issue *jira.Issue) *issueSnapshot {
+	snapshot := &issueSnapshot{
+		Summary:     issue.Fields.Summary,
+		Resolved:    isResolved(issue),
+		Occurrences: len(utils.GetAtomComments(issue, false)),
+	}
+	if issue.Fields.Assignee != nil {
+		snapshot.Assignee = issue.Fields.Assignee.Name
+	}
+	return snapshot
+}
+
+// getOccurrenceEvents returns an event per comment added by atom user
+// after the first reported ones
+func getOccurrenceEvents(key string, issue *jira.Issue, reported int) []string {
+	events := make([]string, 0)
+	comments := utils.GetAtomComments(issue, false)
+	for i := reported; i < len(comments); i++ {
+		env, run := utils.GetRunFromComment(comments[i].Body)
+		if env == "" || run == "" {
+			events = append(events, fmt.Sprintf("🔂 %s failed again", utils.GetIssueLink(key)))
+			continue
+		}
+
+		text := fmt.Sprintf("🔂 %s failed again in %s run %s", utils.GetIssueLink(key), env, run)
+		if runID, err := strconv.ParseInt(run, 10, 64); err == nil {
+			text = fmt.Sprintf("🔂 %s failed again in %s run [%d](%s)", utils.GetIssueLink(key), env, runID,
+				utils.GetRunLink(env == "vcs", runID))
+		}
+		events = append(events, text)
+	}
+	return events
+}
+
+// isResolved returns true if issue is either resolved or closed
+func isResolved(issue *jira.Issue) bool {
+	if issue.Fields == nil || issue.Fields.Status == nil {
+		return false
+	}
+	return issue.Fields.Status.Name == "Resolved" || issue.Fields.Status.Name == "Closed"
+}
+
+// getAssigneeMention returns the markdown to tag assignee
+func getAssigneeMention(assignee string) string {
+	if assignee == "" {
+		return "none"
+	}
+	return fmt.Sprintf("<@personEmail:%s@cisco.com|%s>", assignee, assignee)
+}
+
+// loadJiraWatcherState reads last issues snapshot from jiraWatcherFilename. Key is
+// the issue key. Returns a nil map if no snapshot was ever taken.
+func loadJiraWatcherState(logger logr.Logger) (map[string]*issueSnapshot, error) {
+	if _, err := os.Stat(jiraWatcherFilename); err != nil {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(jiraWatcherFilename)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read file %s. Err: %v", jiraWatcherFilename, err))
+		return nil, err
+	}
+
+	snapshots := make(map[string]*issueSnapshot)
+	if err := json.Unmarshal(content, &snapshots); err != nil {
+		logger.Info(fmt.Sprintf("Failed to parse file %s. Err: %v", jiraWatcherFilename, err))
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// storeJiraWatcherState saves issues snapshot to jiraWatcherFilename
+func storeJiraWatcherState(snapshots map[string]*issueSnapshot, logger logr.Logger) {
+	content, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to marshal jira watcher state. Err: %v", err))
+		return
+	}
+
+	if err := os.WriteFile(jiraWatcherFilename, content, 0600); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write file %s. Err: %v", jiraWatcherFilename, err))
+	}
+}
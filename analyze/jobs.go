@@ -0,0 +1,66 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/scheduler"
+)
+
+// jobJitter is the maximum random delay added to scheduled runs of an analyzer
+const jobJitter = 2 * time.Minute
+
+// ScheduleJobs registers all analyzers, along with removal of generated files left
+// behind, with the scheduler
+func ScheduleJobs(ctx context.Context, webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client, logger logr.Logger) {
+	for _, job := range GetJobs(ctx, webexClient, roomID, jiraClient, logger) {
+		_ = scheduler.Register(job, logger)
+	}
+}
+
+// GetJobs returns all scheduled analyzers. Running a job has the same effects as when
+// it runs on schedule: messages are sent and state (alerts, watchers) is updated.
+func GetJobs(ctx context.Context, webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client, logger logr.Logger) []scheduler.Job {
+	jobs := []scheduler.Job{
+		{Name: "weekly-stats", Schedule: "30 10 * * FRI", Description: "tests which failed the most in the last week",
+			Run: func() { sendStats(ctx, webexClient, roomID, logger) }},
+		{Name: "test-duration", Schedule: "30 11 * * MON", Description: "UCS tests with too variable duration",
+			Run: func() { evaluateUCSTest(ctx, webexClient, roomID, logger) }},
+		{Name: "report-duration", Schedule: "0 12 * * MON", Description: "UCS reports with too variable duration",
+			Run: func() { evaluateUCSReports(ctx, webexClient, roomID, logger) }},
+		{Name: "usage", Schedule: "0 11 * * TUE", Description: "UCS pods close to memory limit or with too variable usage",
+			Run: func() { evaluateUCSUsageReports(ctx, webexClient, roomID, logger) }},
+		{Name: "pie-charts", Schedule: "30 9 * * FRI", Description: "test duration pie charts",
+			Run: func() { sendDurationPieChart(ctx, webexClient, roomID, logger) }},
+		{Name: "open-issues", Schedule: "30 13 * * THU,SUN", Description: "currently open issues",
+			Run: func() { sendOpenIssue(ctx, webexClient, roomID, jiraClient, logger) }},
+		{Name: "jira-watcher", Schedule: fmt.Sprintf("@every %dm", jiraWatcherInterval), Description: "changes to issues filed by atom user",
+			Run: func() { checkJiraIssues(ctx, webexClient, roomID, jiraClient, logger) }},
+		{Name: "escalations", Schedule: "0 11 * * *", Description: "escalation of issues open for too long or seen too many times",
+			Run: func() { checkEscalations(ctx, webexClient, roomID, jiraClient, logger) }},
+		{Name: "escalation-digest", Schedule: "0 10 * * MON", Description: "digest of escalated issues",
+			Run: func() { sendEscalationDigest(ctx, webexClient, roomID, jiraClient, logger) }},
+		{Name: "workload", Schedule: "0 9 * * MON", Description: "open e2e issues per assignee in the active sprint",
+			Run: func() { sendWorkloadReport(ctx, webexClient, roomID, jiraClient, logger) }},
+		{Name: "trends", Schedule: "0 8 1 * *", Description: "monthly trend report",
+			Run: func() { sendTrendReport(ctx, webexClient, roomID, jiraClient, logger) }},
+		{Name: "run-watcher", Schedule: fmt.Sprintf("@every %dm", runWatcherInterval), Description: "summary of new UCS and VCS runs",
+			Run: func() { checkNewRuns(ctx, webexClient, roomID, logger) }},
+		{Name: "artifacts-gc", Schedule: "@hourly", Description: "removal of generated files left behind",
+			Run: func() { artifacts.RemoveStaleWorkspaces(logger) }},
+	}
+
+	for i := range jobs {
+		jobs[i].Jitter = jobJitter
+	}
+
+	return jobs
+}
@@ -0,0 +1,190 @@
+package analyze
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/go-logr/logr"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/text"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// Slices accounting for less than this percentage of total are not labelled on the chart
+const minLabelledPercentage = 4.0
+
+// PieSlice is a slice of a pie chart
+type PieSlice struct {
+	// Label is the legend entry for this slice
+	Label string
+	// Value is the value this slice represents
+	Value float64
+}
+
+// pieChart implements plot.Plotter drawing a pie or donut chart
+type pieChart struct {
+	slices []PieSlice
+	colors []color.Color
+	total  float64
+	// holeRatio is the inner radius as fraction of the outer one. Zero for a pie.
+	holeRatio float64
+	// labelStyle is the style used for percentage labels on slices
+	labelStyle text.Style
+}
+
+// pieThumbnail implements plot.Thumbnailer drawing the slice color in the legend
+type pieThumbnail struct {
+	color color.Color
+}
+
+// CreatePieChart creates a PNG file with a pie chart (a donut chart if donut is set) and
+// a legend reporting, per slice, label, value and percentage of the total.
+func CreatePieChart(title, unit string, slices []PieSlice, donut bool, fileName string,
+	logger logr.Logger) error {
+	if len(slices) == 0 {
+		return fmt.Errorf("no data to generate pie chart")
+	}
+
+	p := plot.New()
+	p.Title.Text = title
+	p.HideAxes()
+	p.Legend.Top = true
+	p.Legend.TextStyle.Font.Size = vg.Points(9)
+	p.Legend.Padding = vg.Points(2)
+
+	pie := &pieChart{
+		slices:     slices,
+		colors:     make([]color.Color, len(slices)),
+		labelStyle: p.Legend.TextStyle,
+	}
+	pie.labelStyle.Color = color.White
+	pie.labelStyle.XAlign = draw.XCenter
+	pie.labelStyle.YAlign = draw.YCenter
+	if donut {
+		pie.holeRatio = 0.5
+	}
+
+	for i := range slices {
+		pie.total += slices[i].Value
+	}
+	if pie.total <= 0 {
+		return fmt.Errorf("no data to generate pie chart")
+	}
+
+	for i := range slices {
+		pie.colors[i] = getPieColor(i, len(slices))
+		p.Legend.Add(fmt.Sprintf("%s: %.2f %s (%.1f%%)", slices[i].Label, slices[i].Value, unit,
+			100*slices[i].Value/pie.total), &pieThumbnail{color: pie.colors[i]})
+	}
+	p.Add(pie)
+
+	// Pie is drawn on the left half. Grow height so that the legend, on the right, fits.
+	height := 6 * vg.Inch
+	if rows := vg.Length(len(slices)) * 13; rows > height {
+		height = rows
+	}
+	if err := p.Save(12*vg.Inch, height, fileName); err != nil {
+		logger.Info(fmt.Sprintf("Failed to save pie chart. Err: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// Plot draws slices clockwise, starting at twelve o'clock, on the left half of the canvas
+func (pie *pieChart) Plot(c draw.Canvas, plt *plot.Plot) {
+	width := c.Max.X - c.Min.X
+	height := c.Max.Y - c.Min.Y
+	radius := height / 2 * 0.9
+	if radius > width/4 {
+		radius = width / 4
+	}
+	center := vg.Point{X: c.Min.X + width/4, Y: c.Min.Y + height/2}
+
+	start := math.Pi / 2
+	for i := range pie.slices {
+		angle := -2 * math.Pi * pie.slices[i].Value / pie.total
+
+		var path vg.Path
+		if pie.holeRatio > 0 {
+			inner := radius * vg.Length(pie.holeRatio)
+			path.Move(pointOnCircle(center, inner, start))
+			path.Arc(center, radius, start, angle)
+			path.Arc(center, inner, start+angle, -angle)
+		} else {
+			path.Move(center)
+			path.Arc(center, radius, start, angle)
+		}
+		path.Close()
+
+		c.SetColor(pie.colors[i])
+		c.Fill(path)
+
+		c.SetLineStyle(draw.LineStyle{Color: color.White, Width: vg.Points(1)})
+		c.Stroke(path)
+
+		if percentage := 100 * pie.slices[i].Value / pie.total; percentage >= minLabelledPercentage {
+			distance := radius * 0.7
+			if pie.holeRatio > 0 {
+				distance = radius * vg.Length((1+pie.holeRatio)/2)
+			}
+			c.FillText(pie.labelStyle, pointOnCircle(center, distance, start+angle/2),
+				fmt.Sprintf("%.0f%%", percentage))
+		}
+
+		start += angle
+	}
+}
+
+// Thumbnail fills the legend thumbnail with the slice color
+func (t *pieThumbnail) Thumbnail(c *draw.Canvas) {
+	pts := []vg.Point{
+		{X: c.Min.X, Y: c.Min.Y},
+		{X: c.Min.X, Y: c.Max.Y},
+		{X: c.Max.X, Y: c.Max.Y},
+		{X: c.Max.X, Y: c.Min.Y},
+	}
+	c.FillPolygon(t.color, c.ClipPolygonY(pts))
+}
+
+// pointOnCircle returns the point on the circle with given center and radius at angle
+func pointOnCircle(center vg.Point, radius vg.Length, angle float64) vg.Point {
+	return vg.Point{
+		X: center.X + radius*vg.Length(math.Cos(angle)),
+		Y: center.Y + radius*vg.Length(math.Sin(angle)),
+	}
+}
+
+// getPieColor returns n distinct colors, spreading hue evenly and alternating brightness
+// so that adjacent slices are easy to tell apart
+func getPieColor(i, n int) color.Color {
+	h := float64(i) / float64(n) * 6
+	v := 0.85
+	if i%2 == 1 {
+		v = 0.65
+	}
+	s := 0.7
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+
+	return color.RGBA{R: uint8((r + m) * 255), G: uint8((g + m) * 255), B: uint8((b + m) * 255), A: 255}
+}
@@ -11,29 +11,18 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/gonum/stat"
-	"github.com/jasonlvhit/gocron"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
 	gim "github.com/ozankasikci/go-image-merge"
 
 	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/routing"
 	"github.com/gianlucam76/webex_bot/utils"
-	"github.com/gianlucam76/webex_bot/webex_utils"
 )
 
 // Minimum number of runs with reports needed.
 const numberOfAvailableRuns int = 7
 
-// CheckReportDurationOnUCS for each reports in UCS:
-// - consider the runs in the two last week;
-// - if relative standard deviation is higher than rsdThreshold
-// send a message on the webex channel
-func CheckReportDurationOnUCS(ctx context.Context,
-	webexClient *webexteams.Client, roomID string,
-	logger logr.Logger) {
-	_ = gocron.Every(1).Monday().At("12:00:00").Do(evaluateUCSReports,
-		ctx, webexClient, roomID, logger)
-}
-
 // evaluateUCSReports:
 // - gets list of available reports
 // - groups reports for type (and subType if avaialble)
@@ -48,24 +37,40 @@ func evaluateUCSReports(ctx context.Context,
 		return
 	}
 
-	reportFiles := make([]string, 0)
+	ws, err := artifacts.New(reportDurationAnalyzer, logger)
+	if err != nil {
+		return
+	}
+	defer ws.Remove(logger)
 
-	files := analyzeByGroupingForTypeAndSubtype(ctx, reportTypes, logger)
-	reportFiles = append(reportFiles, files...)
-	files = analyzeByGroupingForTypeSubtypeAndName(ctx, reportTypes, logger)
-	reportFiles = append(reportFiles, files...)
+	reportPlots, evaluated := analyzeByGroupingForTypeAndSubtype(ctx, ws, reportTypes, logger)
+	perNamePlots, perNameEvaluated := analyzeByGroupingForTypeSubtypeAndName(ctx, ws, reportTypes, logger)
+	for report, files := range perNamePlots {
+		reportPlots[report] = append(reportPlots[report], files...)
+	}
+	evaluated = append(evaluated, perNameEvaluated...)
 
-	if len(reportFiles) > 0 {
-		textMessage := "Hello I detected something which I believe needs to be looked at.  \n"
+	notify, resolved := filterAlerts(reportDurationAnalyzer, evaluated, reportPlots, logger)
+	if len(notify) > 0 {
+		reportOwner := make(map[string]string)
+		for i := range notify {
+			reportOwner[notify[i]] = routing.GetReportOwner(notify[i], logger)
+		}
+		textMessage := "I detected something which I believe needs to be looked at.  \n"
 		textMessage += "For the reports in the plot the relative standard deviation is too big.  \n"
-		sendAlertForReport(webexClient, roomID, textMessage, reportFiles, logger)
+		sendAlerts(ws, reportDurationAnalyzer, textMessage, notify, reportPlots, reportOwner, nil, logger)
 	}
+
+	sendResolvedNotice(webexClient, roomID, reportDurationAnalyzer, resolved, logger)
 }
 
 // analyzeByGroupingForTypeAndSubtype groups reports by type and subType if available (name is ignored).
-// Collects durations and if there is too much variance, sends an alert to the webex space.
-func analyzeByGroupingForTypeAndSubtype(ctx context.Context, reportTypes []string, logger logr.Logger) []string {
-	reportFiles := make([]string, 0)
+// Collects durations and if there is too much variance, generates a plot.
+// Returns, per report with too much variance, the plots and the reports for which data could be fetched.
+func analyzeByGroupingForTypeAndSubtype(ctx context.Context, ws *artifacts.Workspace, reportTypes []string,
+	logger logr.Logger) (map[string][]string, []string) {
+	reportFiles := make(map[string][]string)
+	evaluated := make([]string, 0)
 
 	for i := range reportTypes {
 		// Get reports for a given type/subtype
@@ -73,6 +78,7 @@ func analyzeByGroupingForTypeAndSubtype(ctx context.Context, reportTypes []strin
 		if err != nil {
 			continue
 		}
+		evaluated = append(evaluated, reportTypes[i])
 
 		if len(data) < numberOfAvailableRuns {
 			continue
@@ -92,24 +98,25 @@ func analyzeByGroupingForTypeAndSubtype(ctx context.Context, reportTypes []strin
 			reportTypes[i], mean, std, rsd))
 
 		if rsd >= rsdThreshold {
-			// Results are returned with last one first.
-			// Reverse the order while creating a plot
-			utils.Reverse(durations)
 			reportName := reportTypes[i]
-			environment := "ucs"
-			fileName := CreateDurationPlot(&environment, &reportName, durations, mean, logger)
-			reportFiles = append(reportFiles, fileName)
+			series := []Series{{Environment: "ucs", Samples: GetReportSamples(data)}}
+			if fileName := CreateDurationPlot(ws, reportName, series, logger); fileName != "" {
+				reportFiles[reportName] = append(reportFiles[reportName], fileName)
+			}
 		}
 	}
 
-	return reportFiles
+	return reportFiles, evaluated
 }
 
 // analyzeByGroupingForTypeSubtypeAndName groups reports by type and subType if available.
 // If it detects name as constant accross multiple runs, uses the name to group as well.
-// Collects durations and if there is too much variance, sends an alert to the webex space.
-func analyzeByGroupingForTypeSubtypeAndName(ctx context.Context, reportTypes []string, logger logr.Logger) []string {
-	reportFiles := make([]string, 0)
+// Collects durations and if there is too much variance, generates a plot.
+// Returns, per report with too much variance, the plots and the reports which were analyzed per name.
+func analyzeByGroupingForTypeSubtypeAndName(ctx context.Context, ws *artifacts.Workspace, reportTypes []string,
+	logger logr.Logger) (map[string][]string, []string) {
+	reportFiles := make(map[string][]string)
+	evaluated := make([]string, 0)
 
 	for i := range reportTypes {
 		// Get reports for a given type/subtype
@@ -138,16 +145,20 @@ func analyzeByGroupingForTypeSubtypeAndName(ctx context.Context, reportTypes []s
 		}
 
 		logger.Info(fmt.Sprintf("Report %s name appears to be NOT random", reportTypes[i]))
-		files := analyzePerNameReports(reportTypes[i], reportByName, logger)
-		reportFiles = append(reportFiles, files...)
+		for report, files := range analyzePerNameReports(ws, reportTypes[i], reportByName, logger) {
+			reportFiles[report] = append(reportFiles[report], files...)
+		}
+		for name := range reportByName {
+			evaluated = append(evaluated, getPerNameReport(reportTypes[i], name))
+		}
 	}
 
-	return reportFiles
+	return reportFiles, evaluated
 }
 
-func analyzePerNameReports(reportInfo string, reportByName map[string][]es_utils.Report,
-	logger logr.Logger) []string {
-	reportFiles := make([]string, 0)
+func analyzePerNameReports(ws *artifacts.Workspace, reportInfo string, reportByName map[string][]es_utils.Report,
+	logger logr.Logger) map[string][]string {
+	reportFiles := make(map[string][]string)
 
 	for name := range reportByName {
 		perNameReports := reportByName[name]
@@ -169,19 +180,22 @@ func analyzePerNameReports(reportInfo string, reportByName map[string][]es_utils
 			reportInfo, name, mean, std, rsd))
 
 		if rsd >= rsdThreshold {
-			// Results are returned with last one first.
-			// Reverse the order while creating a plot
-			utils.Reverse(durations)
-			environment := "ucs"
-			reportByName := fmt.Sprintf("%s_%s", reportInfo, name)
-			fileName := CreateDurationPlot(&environment, &reportByName, durations, mean, logger)
-			reportFiles = append(reportFiles, fileName)
+			reportByName := getPerNameReport(reportInfo, name)
+			series := []Series{{Environment: "ucs", Samples: GetReportSamples(perNameReports)}}
+			if fileName := CreateDurationPlot(ws, reportByName, series, logger); fileName != "" {
+				reportFiles[reportByName] = append(reportFiles[reportByName], fileName)
+			}
 		}
 	}
 
 	return reportFiles
 }
 
+// getPerNameReport returns the name used for a report analyzed per name
+func getPerNameReport(reportInfo, name string) string {
+	return fmt.Sprintf("%s_%s", reportInfo, name)
+}
+
 func getDurations(data []es_utils.Report) []float64 {
 	durations := make([]float64, 0)
 	for j := range data {
@@ -234,35 +248,32 @@ func getReportData(ctx context.Context, reportInfo string, logger logr.Logger) (
 	return data, nil
 }
 
-// sendAlertForReport generates a plot with duration and send a webex message with such graph.
-func sendAlertForReport(webexClient *webexteams.Client, roomID, textMessage string,
-	reportFiles []string, logger logr.Logger) {
-	x, y := GetGridSize(len(reportFiles))
+// createGrid merges all plots in a grid saved as gridFileName.
+func createGrid(files []string, gridFileName string, logger logr.Logger) (string, error) {
+	x, y := GetGridSize(len(files))
 
 	grids := make([]*gim.Grid, 0)
-	for i := range reportFiles {
-		tmpGrid := gim.Grid{ImageFilePath: reportFiles[i]}
+	for i := range files {
+		tmpGrid := gim.Grid{ImageFilePath: files[i]}
 		grids = append(grids, &tmpGrid)
 	}
 	rgba, err := gim.New(grids, x, y).Merge()
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create grid. Error %v", err))
-		return
+		return "", err
 	}
 
-	gridFileName := "/tmp/report_analysis_grid.png"
 	file, err := os.Create(gridFileName)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create grid file. Error %v", err))
-		return
+		return "", err
 	}
+	defer file.Close()
 
 	if err = png.Encode(file, rgba); err != nil {
 		logger.Info(fmt.Sprintf("Failed to encode grid file. Error %v", err))
-		return
+		return "", err
 	}
 
-	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{gridFileName}, logger); err != nil {
-		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
-	}
+	return gridFileName, nil
 }
@@ -0,0 +1,265 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gonum/stat"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/utils"
+)
+
+// Percentile of the collected samples used to compute requests
+const requestPercentile float64 = 0.9
+
+// Percentile of the collected samples used to compute limits
+const limitPercentile float64 = 0.99
+
+// Headroom (in percent) added on top of the request percentile
+const requestHeadroom float64 = 15
+
+// Headroom (in percent) added on top of the limit percentile
+const limitHeadroom float64 = 30
+
+// Minimum cpu (in m) ever recommended. Pods with no measurable cpu usage
+// still need a non zero request.
+const minCPURecommendation int64 = 10
+
+// Minimum memory (in Mi) ever recommended.
+const minMemoryRecommendationInMi int64 = 16
+
+// Workload kinds a resources patch can be generated for
+const (
+	deploymentKind  = "deployment"
+	daemonSetKind   = "daemonset"
+	statefulSetKind = "statefulset"
+)
+
+// ResourceRecommendation contains, for a pod, requests and limits computed from
+// historical usage samples.
+type ResourceRecommendation struct {
+	// Pod is the pod this recommendation is about (<namespace>:<name>)
+	Pod string
+	// Kind is the kind of the workload owning the pod, if reported
+	Kind string
+	// Workload is the name of the workload owning the pod
+	Workload string
+	// Container is the name of the container, if reported.
+	// Workload name otherwise.
+	Container string
+	// Samples is the number of runs considered
+	Samples int
+	// MemoryRequest is the recommended memory request in Mi
+	MemoryRequest int64
+	// MemoryLimit is the recommended memory limit in Mi
+	MemoryLimit int64
+	// CPURequest is the recommended cpu request in m
+	CPURequest int64
+	// CPULimit is the recommended cpu limit in m
+	CPULimit int64
+	// CurrentMemoryLimit is the memory limit (in Ki) seen in the last run
+	CurrentMemoryLimit int64
+	// CurrentCPULimit is the cpu limit (in m) seen in the last run
+	CurrentCPULimit int64
+}
+
+// RecommendResources computes requests and limits for a pod starting from usage samples.
+// data is expected to be ordered with last run first.
+func RecommendResources(pod string, data []es_utils.UsageReport) (*ResourceRecommendation, error) {
+	if len(data) < numberOfAvailableRuns {
+		return nil, fmt.Errorf("not enough samples (%d) for pod %s", len(data), pod)
+	}
+
+	memorySamples := getMemorySamples(data)
+	cpuSamples := getCPUSamples(data)
+
+	// Memory samples are in Ki. Recommendations are in Mi.
+	memoryRequest := int64(math.Ceil(percentile(memorySamples, requestPercentile) *
+		(1 + requestHeadroom/100) / 1024))
+	memoryLimit := int64(math.Ceil(percentile(memorySamples, limitPercentile) *
+		(1 + limitHeadroom/100) / 1024))
+
+	cpuRequest := int64(math.Ceil(percentile(cpuSamples, requestPercentile) * (1 + requestHeadroom/100)))
+	cpuLimit := int64(math.Ceil(percentile(cpuSamples, limitPercentile) * (1 + limitHeadroom/100)))
+
+	_, name := splitPodName(pod)
+	kind, workload, container, err := parseWorkload(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResourceRecommendation{
+		Pod:                pod,
+		Kind:               kind,
+		Workload:           workload,
+		Container:          container,
+		Samples:            len(data),
+		MemoryRequest:      maxInt64(memoryRequest, minMemoryRecommendationInMi),
+		MemoryLimit:        maxInt64(memoryLimit, maxInt64(memoryRequest, minMemoryRecommendationInMi)),
+		CPURequest:         maxInt64(cpuRequest, minCPURecommendation),
+		CPULimit:           maxInt64(cpuLimit, maxInt64(cpuRequest, minCPURecommendation)),
+		CurrentMemoryLimit: data[0].MemoryLimit,
+		CurrentCPULimit:    data[0].CPULimit,
+	}, nil
+}
+
+// GetResourceRecommendations returns a recommendation for each pod in namespace for which
+// enough usage samples are available.
+func GetResourceRecommendations(ctx context.Context, namespace string,
+	logger logr.Logger) ([]*ResourceRecommendation, error) {
+	pods, err := utils.BuildUCSUsageReports(ctx, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get usage reports. Err: %v", err))
+		return nil, err
+	}
+
+	sort.Strings(pods)
+
+	recommendations := make([]*ResourceRecommendation, 0)
+	for i := range pods {
+		podNamespace, _ := splitPodName(pods[i])
+		if podNamespace != namespace {
+			continue
+		}
+
+		data, err := getUsageReportData(ctx, pods[i], logger)
+		if err != nil {
+			continue
+		}
+
+		recommendation, err := RecommendResources(pods[i], data)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Skip recommendation for pod %s. Err: %v", pods[i], err))
+			continue
+		}
+		recommendations = append(recommendations, recommendation)
+	}
+
+	return recommendations, nil
+}
+
+// Markdown returns a one line description of the recommendation.
+func (r *ResourceRecommendation) Markdown() string {
+	currentMemoryLimit := "not set"
+	if r.CurrentMemoryLimit != 0 {
+		currentMemoryLimit = fmt.Sprintf("%dMi", int64(math.Ceil(float64(r.CurrentMemoryLimit)/1024)))
+	}
+	currentCPULimit := "not set"
+	if r.CurrentCPULimit != 0 {
+		currentCPULimit = fmt.Sprintf("%dm", r.CurrentCPULimit)
+	}
+
+	return fmt.Sprintf("*%s*: memory request **%dMi** limit **%dMi** (current limit %s), cpu request **%dm** limit **%dm** (current limit %s). Based on %d runs  \n",
+		r.Pod, r.MemoryRequest, r.MemoryLimit, currentMemoryLimit, r.CPURequest, r.CPULimit, currentCPULimit, r.Samples)
+}
+
+// CreateResourcesPatch writes a strategic merge patch setting requests and limits
+// to the recommended values. Returns the name of the file.
+func CreateResourcesPatch(ws *artifacts.Workspace, r *ResourceRecommendation, logger logr.Logger) (string, error) {
+	namespace, _ := splitPodName(r.Pod)
+
+	fileName := ws.Path(fmt.Sprintf("resources_%s_%s.yaml", namespace, r.Workload))
+
+	patch := fmt.Sprintf("# Resources recommended for %s considering the last %d runs.\n", r.Pod, r.Samples)
+	patch += fmt.Sprintf("# Requests are the p%.0f of the max usage plus %.0f%% headroom.\n",
+		requestPercentile*100, requestHeadroom)
+	patch += fmt.Sprintf("# Limits are the p%.0f of the max usage plus %.0f%% headroom.\n",
+		limitPercentile*100, limitHeadroom)
+	if r.Kind != "" {
+		patch += "# Apply with:\n"
+		patch += fmt.Sprintf("#   kubectl -n %s patch %s %s --patch-file %s\n",
+			namespace, r.Kind, r.Workload, filepath.Base(fileName))
+	} else {
+		// Usage report does not say which kind of workload owns the pod
+		patch += "# Apply to the deployment, daemonset or statefulset owning the pod, i.e.:\n"
+		patch += fmt.Sprintf("#   kubectl -n %s patch <kind> %s --patch-file %s\n",
+			namespace, r.Workload, filepath.Base(fileName))
+	}
+	patch += "spec:\n"
+	patch += "  template:\n"
+	patch += "    spec:\n"
+	patch += "      containers:\n"
+	patch += fmt.Sprintf("      - name: %s\n", r.Container)
+	patch += "        resources:\n"
+	patch += "          requests:\n"
+	patch += fmt.Sprintf("            cpu: %dm\n", r.CPURequest)
+	patch += fmt.Sprintf("            memory: %dMi\n", r.MemoryRequest)
+	patch += "          limits:\n"
+	patch += fmt.Sprintf("            cpu: %dm\n", r.CPULimit)
+	patch += fmt.Sprintf("            memory: %dMi\n", r.MemoryLimit)
+
+	if err := os.WriteFile(fileName, []byte(patch), 0600); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write patch file %s. Err: %v", fileName, err))
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// percentile returns the p percentile of samples. samples is not modified.
+func percentile(samples []float64, p float64) float64 {
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+	return stat.Quantile(p, stat.Empirical, sorted, nil)
+}
+
+// splitPodName splits <namespace>:<name> in namespace and name
+func splitPodName(pod string) (namespace, name string) {
+	info := strings.SplitN(pod, ":", 2)
+	if len(info) == 1 {
+		return "", info[0]
+	}
+	return info[0], info[1]
+}
+
+// parseWorkload parses the name of a usage report (namespace excluded).
+// Name is either <name> or <kind>/<name>[/<container>], with kind one of deployment,
+// daemonset and statefulset. When container is not reported, it is assumed to match
+// the workload name. Returns an error if name is in neither format.
+func parseWorkload(name string) (kind, workload, container string, err error) {
+	info := strings.Split(name, "/")
+	for i := range info {
+		if info[i] == "" {
+			return "", "", "", fmt.Errorf("invalid workload %q. Expected <name> or <kind>/<name>[/<container>]", name)
+		}
+	}
+
+	switch len(info) {
+	case 1:
+		return "", name, name, nil
+	case 2, 3:
+	default:
+		return "", "", "", fmt.Errorf("invalid workload %q. Expected <name> or <kind>/<name>[/<container>]", name)
+	}
+
+	switch strings.ToLower(info[0]) {
+	case deploymentKind, daemonSetKind, statefulSetKind:
+		kind = strings.ToLower(info[0])
+	default:
+		return "", "", "", fmt.Errorf("invalid workload %q. Kind %q is not one of %s, %s, %s",
+			name, info[0], deploymentKind, daemonSetKind, statefulSetKind)
+	}
+
+	workload = info[1]
+	container = workload
+	if len(info) == 3 {
+		container = info[2]
+	}
+	return kind, workload, container, nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
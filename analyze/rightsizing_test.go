@@ -0,0 +1,149 @@
+package analyze
+
+import (
+	"testing"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []float64
+		p        float64
+		expected float64
+	}{
+		{name: "single sample", samples: []float64{5}, p: 0.9, expected: 5},
+		{name: "median", samples: []float64{3, 1, 2}, p: 0.5, expected: 2},
+		{name: "p90 unordered", samples: []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}, p: 0.9, expected: 9},
+		{name: "p99", samples: []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}, p: 0.99, expected: 10},
+		{name: "max", samples: []float64{4, 4, 4}, p: 1, expected: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := make([]float64, len(tt.samples))
+			copy(samples, tt.samples)
+
+			if got := percentile(samples, tt.p); got != tt.expected {
+				t.Errorf("percentile(%v, %v) = %v, expected %v", tt.samples, tt.p, got, tt.expected)
+			}
+			for i := range samples {
+				if samples[i] != tt.samples[i] {
+					t.Errorf("percentile modified samples: %v", samples)
+					break
+				}
+			}
+		})
+	}
+}
+
+func getUsageReports(n int, memoryInMi, cpu int64) []es_utils.UsageReport {
+	data := make([]es_utils.UsageReport, n)
+	for i := range data {
+		data[i] = es_utils.UsageReport{
+			Memory: int64(i+1) * memoryInMi * 1024,
+			CPU:    int64(i+1) * cpu,
+		}
+	}
+	data[0].MemoryLimit = 2048
+	data[0].CPULimit = 50
+	return data
+}
+
+func TestRecommendResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      string
+		data     []es_utils.UsageReport
+		expected *ResourceRecommendation
+	}{
+		{
+			name: "not enough samples",
+			pod:  "default:app",
+			data: getUsageReports(numberOfAvailableRuns-1, 100, 10),
+		},
+		{
+			name: "percentiles plus headroom",
+			pod:  "default:app",
+			data: getUsageReports(10, 100, 10),
+			expected: &ResourceRecommendation{
+				Pod: "default:app", Workload: "app", Container: "app", Samples: 10,
+				MemoryRequest: 1035, MemoryLimit: 1300, CPURequest: 104, CPULimit: 130,
+				CurrentMemoryLimit: 2048, CurrentCPULimit: 50,
+			},
+		},
+		{
+			name: "invalid workload",
+			pod:  "default:job/app",
+			data: getUsageReports(10, 100, 10),
+		},
+		{
+			name: "minimum recommendation",
+			pod:  "kube-system:daemonset/agent/sidecar",
+			data: getUsageReports(10, 0, 0),
+			expected: &ResourceRecommendation{
+				Pod: "kube-system:daemonset/agent/sidecar", Kind: daemonSetKind, Workload: "agent", Container: "sidecar",
+				Samples: 10, MemoryRequest: minMemoryRecommendationInMi, MemoryLimit: minMemoryRecommendationInMi,
+				CPURequest: minCPURecommendation, CPULimit: minCPURecommendation,
+				CurrentMemoryLimit: 2048, CurrentCPULimit: 50,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RecommendResources(tt.pod, tt.data)
+			if tt.expected == nil {
+				if err == nil {
+					t.Errorf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != *tt.expected {
+				t.Errorf("got %+v, expected %+v", *got, *tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseWorkload(t *testing.T) {
+	tests := []struct {
+		name              string
+		expectedKind      string
+		expectedWorkload  string
+		expectedContainer string
+		expectedErr       bool
+	}{
+		{name: "app", expectedWorkload: "app", expectedContainer: "app"},
+		{name: "Deployment/app", expectedKind: deploymentKind, expectedWorkload: "app", expectedContainer: "app"},
+		{name: "statefulset/db/postgres", expectedKind: statefulSetKind, expectedWorkload: "db",
+			expectedContainer: "postgres"},
+		{name: "job/app", expectedErr: true},
+		{name: "deployment/", expectedErr: true},
+		{name: "deployment/app/", expectedErr: true},
+		{name: "deployment/app/main/extra", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, workload, container, err := parseWorkload(tt.name)
+			if tt.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, got (%q, %q, %q)", kind, workload, container)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kind != tt.expectedKind || workload != tt.expectedWorkload || container != tt.expectedContainer {
+				t.Errorf("parseWorkload(%q) = (%q, %q, %q), expected (%q, %q, %q)", tt.name,
+					kind, workload, container, tt.expectedKind, tt.expectedWorkload, tt.expectedContainer)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package analyze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/history"
+	"github.com/gianlucam76/webex_bot/state"
+	"github.com/gianlucam76/webex_bot/utils"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+// runWatcherFilename is the file where run watcher state is persisted
+var runWatcherFilename = state.GetPath("run_watcher_state.json")
+
+const (
+	// How often, in minutes, new runs are looked for
+	runWatcherInterval = 10
+
+	// Results are uploaded while a run progresses. A run is considered complete
+	// when its number of results has not changed for this many consecutive checks.
+	stableChecks = 3
+
+	// Number of most recent runs looked at every time
+	watchedRuns = 5
+
+	// Number of results fetched by the first query for a run
+	runResultsPageSize = 200
+
+	// Elastic index.max_result_window default. No query can return more results.
+	maxResultWindow = 10000
+)
+
+// runState tracks a run which has not been notified yet
+type runState struct {
+	// Results is the number of results found last time
+	Results int64 `json:"results"`
+	// Stable is the number of consecutive checks Results did not change
+	Stable int `json:"stable"`
+}
+
+// environmentState is the run watcher state for either UCS or VCS
+type environmentState struct {
+	// LastNotified is the most recent run a summary was sent for
+	LastNotified int64 `json:"lastNotified"`
+	// Pending contains runs not notified yet. Key is run ID.
+	Pending map[int64]*runState `json:"pending,omitempty"`
+}
+
+// runWatcherMux serializes checks for new runs
+var runWatcherMux sync.Mutex
+
+// checkNewRuns looks for new UCS and VCS runs.
+// Once all results of a new run are available, a summary is sent.
+func checkNewRuns(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	logger logr.Logger) {
+	runWatcherMux.Lock()
+	defer runWatcherMux.Unlock()
+
+	envStates, err := loadRunWatcherState(logger)
+	if err != nil {
+		return
+	}
+
+	for _, vcs := range []bool{false, true} {
+		env := getEnvironment(vcs)
+		envState, ok := envStates[env]
+		if !ok {
+			envState = &environmentState{}
+			envStates[env] = envState
+		}
+		checkNewRunsPerEnvironment(ctx, webexClient, roomID, vcs, envState, logger)
+	}
+
+	storeRunWatcherState(envStates, logger)
+}
+
+// checkNewRunsPerEnvironment sends a summary for each completed run more recent than
+// last notified one. Runs are processed in order; processing stops at the first
+// run still in progress.
+func checkNewRunsPerEnvironment(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	vcs bool, envState *environmentState, logger logr.Logger) {
+	runs, err := utils.GetLastNRuns(ctx, vcs, watchedRuns, logger)
+	if err != nil || len(runs) == 0 {
+		return
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i] < runs[j] })
+
+	if envState.LastNotified == 0 {
+		// First time bot sees this environment. Do not report past runs.
+		envState.LastNotified = runs[len(runs)-1]
+		logger.Info(fmt.Sprintf("Watching %s runs after %d", getEnvironment(vcs), envState.LastNotified))
+		return
+	}
+
+	if envState.Pending == nil {
+		envState.Pending = make(map[int64]*runState)
+	}
+
+	for i := range runs {
+		if runs[i] <= envState.LastNotified {
+			continue
+		}
+
+		results, err := es_utils.GetResults(ctx, logger,
+			fmt.Sprintf("%d", runs[i]), // filter on this run
+			"",                         // no specific test
+			vcs,                        // from vcs
+			!vcs,                       // from ucs
+			false,                      // no filter passed tests
+			false,                      // no filter failed tests
+			false,                      // no filter skipped tests
+			1,
+		)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to get results for run %d. Err: %v", runs[i], err))
+			return
+		}
+
+		pending, ok := envState.Pending[runs[i]]
+		if !ok || pending.Results != results.TotalHits() {
+			envState.Pending[runs[i]] = &runState{Results: results.TotalHits()}
+			return
+		}
+
+		pending.Stable++
+		if pending.Stable < stableChecks {
+			return
+		}
+
+		previousRun := int64(0)
+		if i > 0 {
+			previousRun = runs[i-1]
+		}
+
+		textMessage, err := getRunSummary(ctx, vcs, runs[i], previousRun, logger)
+		if err != nil {
+			return
+		}
+
+		// Run is complete. Keep it for long-range reports.
+		if err := history.IngestRun(ctx, vcs, runs[i], logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to store run %d in history. Err: %v", runs[i], err))
+		}
+
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+			return
+		}
+
+		envState.LastNotified = runs[i]
+		delete(envState.Pending, runs[i])
+	}
+
+	// Forget about runs already notified
+	for run := range envState.Pending {
+		if run <= envState.LastNotified {
+			delete(envState.Pending, run)
+		}
+	}
+}
+
+// getRunSummary returns a message with number of passed, failed and skipped tests,
+// tests that failed in run but not in previousRun, and run duration.
+// previousRun is ignored if zero.
+func getRunSummary(ctx context.Context, vcs bool, run, previousRun int64,
+	logger logr.Logger) (string, error) {
+	env := getEnvironment(vcs)
+
+	results, err := getRunResults(ctx, vcs, run, logger)
+	if err != nil {
+		return "", err
+	}
+
+	var passed, failed, skipped int
+	failedTests := make([]string, 0)
+	var start, end time.Time
+	for i := range results {
+		switch results[i].Result {
+		case "passed":
+			passed++
+		case "failed":
+			failed++
+			failedTests = append(failedTests, results[i].Name)
+		case "skipped":
+			skipped++
+		}
+
+		if results[i].StartTime.IsZero() {
+			continue
+		}
+		if start.IsZero() || results[i].StartTime.Before(start) {
+			start = results[i].StartTime
+		}
+		testEnd := results[i].StartTime.Add(time.Duration(results[i].DurationInMinutes * float64(time.Minute)))
+		if testEnd.After(end) {
+			end = testEnd
+		}
+	}
+	sort.Strings(failedTests)
+
+	status := "🥇"
+	if failed != 0 {
+		status = "❌"
+	}
+
+	textMessage := fmt.Sprintf("%s run [%d](%s) completed %s  \n", env, run, utils.GetRunLink(vcs, run), status)
+	textMessage += fmt.Sprintf("**Passed: %d Failed: %d Skipped: %d**  \n", passed, failed, skipped)
+	if !start.IsZero() {
+		textMessage += fmt.Sprintf("Total duration: %s  \n", end.Sub(start).Round(time.Minute))
+	}
+
+	if previousRun == 0 || len(failedTests) == 0 {
+		return textMessage, nil
+	}
+
+	previousResults, err := getRunResults(ctx, vcs, previousRun, logger)
+	if err != nil {
+		return textMessage, nil
+	}
+
+	previouslyFailed := make(map[string]bool)
+	for i := range previousResults {
+		if previousResults[i].Result == "failed" {
+			previouslyFailed[previousResults[i].Name] = true
+		}
+	}
+
+	newFailures := make([]string, 0)
+	for i := range failedTests {
+		if !previouslyFailed[failedTests[i]] {
+			newFailures = append(newFailures, failedTests[i])
+		}
+	}
+
+	if len(newFailures) == 0 {
+		textMessage += fmt.Sprintf("No new failures compared to run %d  \n", previousRun)
+		return textMessage, nil
+	}
+
+	textMessage += fmt.Sprintf("New failures compared to run %d:  \n", previousRun)
+	for i := range newFailures {
+		textMessage += fmt.Sprintf("1. %s  \n", newFailures[i])
+	}
+
+	return textMessage, nil
+}
+
+// getRunResults returns all results for a given run. Results are first fetched
+// in a single page of runResultsPageSize. If run has more results, query is repeated
+// asking for all of them (up to elastic max result window).
+func getRunResults(ctx context.Context, vcs bool, run int64,
+	logger logr.Logger) ([]es_utils.Result, error) {
+	size := runResultsPageSize
+	for {
+		searchResult, err := es_utils.GetResults(ctx, logger,
+			fmt.Sprintf("%d", run), // filter on this run
+			"",                     // no specific test
+			vcs,                    // from vcs
+			!vcs,                   // from ucs
+			false,                  // no filter passed tests
+			false,                  // no filter failed tests
+			false,                  // no filter skipped tests
+			size,
+		)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to get results for run %d from elastic DB. Err: %v", run, err))
+			return nil, err
+		}
+
+		results := make([]es_utils.Result, 0)
+		var rtyp es_utils.Result
+		for _, item := range searchResult.Each(reflect.TypeOf(rtyp)) {
+			results = append(results, item.(es_utils.Result))
+		}
+
+		total := int(searchResult.TotalHits())
+		if total <= len(results) || size >= maxResultWindow {
+			if total > len(results) {
+				logger.Info(fmt.Sprintf("Run %d has %d results. Only %d considered", run, total, len(results)))
+			}
+			return results, nil
+		}
+
+		size = total
+		if size > maxResultWindow {
+			size = maxResultWindow
+		}
+	}
+}
+
+// getEnvironment returns the environment name
+func getEnvironment(vcs bool) string {
+	if vcs {
+		return "vcs"
+	}
+	return "ucs"
+}
+
+// loadRunWatcherState reads run watcher state from runWatcherFilename.
+// Key is the environment.
+func loadRunWatcherState(logger logr.Logger) (map[string]*environmentState, error) {
+	envStates := make(map[string]*environmentState)
+
+	if _, err := os.Stat(runWatcherFilename); err != nil {
+		return envStates, nil
+	}
+
+	content, err := os.ReadFile(runWatcherFilename)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read file %s. Err: %v", runWatcherFilename, err))
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &envStates); err != nil {
+		logger.Info(fmt.Sprintf("Failed to parse file %s. Err: %v", runWatcherFilename, err))
+		return nil, err
+	}
+
+	return envStates, nil
+}
+
+// storeRunWatcherState saves run watcher state to runWatcherFilename
+func storeRunWatcherState(envStates map[string]*environmentState, logger logr.Logger) {
+	content, err := json.MarshalIndent(envStates, "", "  ")
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to marshal run watcher state. Err: %v", err))
+		return
+	}
+
+	if err := os.WriteFile(runWatcherFilename, content, 0600); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write file %s. Err: %v", runWatcherFilename, err))
+	}
+}
@@ -0,0 +1,340 @@
+package analyze
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gonum/stat"
+	"github.com/olivere/elastic/v7"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/artifacts"
+)
+
+// Sample is a value collected in a run
+type Sample struct {
+	// Run is the sanity run id
+	Run int
+	// Time is when sample was collected
+	Time time.Time
+	// Value is the sample value
+	Value float64
+	// Result is the test result (passed, failed or skipped). Empty when sample
+	// is not about a test.
+	Result string
+}
+
+// Series contains the samples collected in an environment
+type Series struct {
+	// Environment is the environment (ucs or vcs) samples were collected in
+	Environment string
+	// Samples are the collected samples. Order does not matter.
+	Samples []Sample
+}
+
+var (
+	failedColor  = color.RGBA{R: 220, A: 255}
+	skippedColor = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	limitColor   = color.RGBA{R: 255, G: 140, A: 255}
+)
+
+// GetResultSamples returns a sample per test result. Value is the test duration in minutes.
+func GetResultSamples(results *elastic.SearchResult) []Sample {
+	list := make([]es_utils.Result, 0)
+	if results == nil {
+		return GetTestSamples(list)
+	}
+
+	var rtyp es_utils.Result
+	for _, item := range results.Each(reflect.TypeOf(rtyp)) {
+		list = append(list, item.(es_utils.Result))
+	}
+	return GetTestSamples(list)
+}
+
+// GetTestSamples is like GetResultSamples for results already fetched (i.e. from history database)
+func GetTestSamples(results []es_utils.Result) []Sample {
+	samples := make([]Sample, len(results))
+	for i := range results {
+		r := &results[i]
+		samples[i] = Sample{Run: r.Run, Time: r.StartTime, Value: r.DurationInMinutes, Result: r.Result}
+	}
+	return samples
+}
+
+// GetReportSamples returns a sample per report. Value is the report duration in minutes.
+func GetReportSamples(reports []es_utils.Report) []Sample {
+	samples := make([]Sample, len(reports))
+	for i := range reports {
+		samples[i] = Sample{Run: reports[i].Run, Time: reports[i].CreatedTime, Value: reports[i].DurationInMinutes}
+	}
+	return samples
+}
+
+// GetUsageSamples returns a sample per usage report. Value is the max memory
+// used (in Ki) or, if cpu is set, the max cpu used (in m).
+func GetUsageSamples(reports []es_utils.UsageReport, cpu bool) []Sample {
+	samples := make([]Sample, len(reports))
+	for i := range reports {
+		value := float64(reports[i].Memory)
+		if cpu {
+			value = float64(reports[i].CPU)
+		}
+		samples[i] = Sample{Run: reports[i].Run, Time: reports[i].CreatedTime, Value: value}
+	}
+	return samples
+}
+
+// getMeasuredValues returns the values of samples whose value is meaningful
+func getMeasuredValues(samples []Sample) []float64 {
+	values := make([]float64, 0, len(samples))
+	for i := range samples {
+		if samples[i].isMeasured() {
+			values = append(values, samples[i].Value)
+		}
+	}
+	return values
+}
+
+// isMeasured returns true if sample value is meaningful. Duration of a failed or
+// skipped test is not.
+func (s *Sample) isMeasured() bool {
+	return s.Result == "" || s.Result == "passed"
+}
+
+// createSamplePlot creates, in ws, a plot with a line per series. Failed and skipped runs are
+// marked, outliers are labelled with their run and mean ±1σ band is drawn for each series.
+// With a single series, x axis is the run ID. With more series (i.e. VCS and UCS overlay),
+// since run IDs are not comparable across environments, x axis is time.
+// If limit is not zero, a line is drawn at limit.
+func createSamplePlot(ws *artifacts.Workspace, title, yLabel, fileName string, series []Series,
+	limit float64, logger logr.Logger) (string, error) {
+	byTime := len(series) > 1
+	getX := func(s *Sample) float64 {
+		if byTime {
+			return float64(s.Time.Unix())
+		}
+		return float64(s.Run)
+	}
+
+	p := plot.New()
+	p.Title.Text = title
+	p.Y.Label.Text = yLabel
+	if byTime {
+		p.X.Label.Text = "Date"
+		p.X.Tick.Marker = plot.TimeTicks{Format: "01/02"}
+	} else {
+		p.X.Label.Text = "Run ID"
+	}
+	p.Legend.Top = true
+	p.Legend.TextStyle.Font.Size = vg.Points(8)
+
+	// Axis range
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for i := range series {
+		for j := range series[i].Samples {
+			s := &series[i].Samples[j]
+			minX = math.Min(minX, getX(s))
+			maxX = math.Max(maxX, getX(s))
+			if s.Result != "skipped" {
+				minY = math.Min(minY, s.Value)
+				maxY = math.Max(maxY, s.Value)
+			}
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return "", fmt.Errorf("no samples for %s", title)
+	}
+	if math.IsInf(minY, 1) {
+		minY, maxY = 0, 0
+	}
+	if limit != 0 {
+		maxY = math.Max(maxY, limit)
+	}
+	padY := math.Max((maxY-minY)*0.1, 1)
+	p.Y.Min = minY - padY
+	// Leave room at the top for the legend
+	p.Y.Max = maxY + 4*padY
+	padX := math.Max((maxX-minX)*0.05, 1)
+	p.X.Min = minX - padX
+	p.X.Max = maxX + padX
+
+	failedPts := make(plotter.XYs, 0)
+	skippedPts := make(plotter.XYs, 0)
+
+	for i := range series {
+		// Skip red, it is used for failed runs
+		seriesColor := plotutil.Color(i + 1)
+
+		measured := make([]Sample, 0)
+		for j := range series[i].Samples {
+			s := series[i].Samples[j]
+			switch {
+			case s.isMeasured():
+				measured = append(measured, s)
+			case s.Result == "failed":
+				failedPts = append(failedPts, plotter.XY{X: getX(&s), Y: s.Value})
+			default:
+				// Skipped tests have no meaningful duration. Mark them at the bottom.
+				skippedPts = append(skippedPts, plotter.XY{X: getX(&s), Y: minY - padY/2})
+			}
+		}
+		if len(measured) == 0 {
+			continue
+		}
+		sort.Slice(measured, func(a, b int) bool { return getX(&measured[a]) < getX(&measured[b]) })
+
+		pts := make(plotter.XYs, len(measured))
+		values := make([]float64, len(measured))
+		for j := range measured {
+			pts[j].X = getX(&measured[j])
+			pts[j].Y = measured[j].Value
+			values[j] = measured[j].Value
+		}
+
+		if err := addMeanBand(p, series[i].Environment, values, minX, maxX, seriesColor); err != nil {
+			logger.Info(fmt.Sprintf("Failed to add mean band to plot %s. Err: %v", title, err))
+			return "", err
+		}
+
+		line, points, err := plotter.NewLinePoints(pts)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to create plot %s. Err: %v", title, err))
+			return "", err
+		}
+		line.Color = seriesColor
+		points.Color = seriesColor
+		points.Shape = draw.CircleGlyph{}
+		points.Radius = vg.Points(2)
+		p.Add(line, points)
+		p.Legend.Add(series[i].Environment, line, points)
+
+		if labels, err := getOutlierLabels(measured, values, getX); err == nil && labels != nil {
+			p.Add(labels)
+		}
+	}
+
+	if len(failedPts) > 0 {
+		if err := addMarkers(p, "failed", failedPts, draw.CrossGlyph{}, failedColor); err != nil {
+			logger.Info(fmt.Sprintf("Failed to add failed runs to plot %s. Err: %v", title, err))
+			return "", err
+		}
+	}
+	if len(skippedPts) > 0 {
+		if err := addMarkers(p, "skipped", skippedPts, draw.TriangleGlyph{}, skippedColor); err != nil {
+			logger.Info(fmt.Sprintf("Failed to add skipped runs to plot %s. Err: %v", title, err))
+			return "", err
+		}
+	}
+
+	if limit != 0 {
+		limitLine, err := plotter.NewLine(plotter.XYs{{X: p.X.Min, Y: limit}, {X: p.X.Max, Y: limit}})
+		if err != nil {
+			return "", err
+		}
+		limitLine.Color = limitColor
+		limitLine.Width = vg.Points(2)
+		p.Add(limitLine)
+		p.Legend.Add("limit", limitLine)
+	}
+
+	fileName = ws.Path(fileName)
+	if err := p.Save(5*vg.Inch, 4*vg.Inch, fileName); err != nil {
+		logger.Info(fmt.Sprintf("Failed to save plot %s. Err: %v", title, err))
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// addMeanBand adds a dashed line at the mean of values and a shaded band covering ±1σ
+func addMeanBand(p *plot.Plot, env string, values []float64, minX, maxX float64, c color.Color) error {
+	mean, std := stat.MeanStdDev(values, nil)
+	if math.IsNaN(std) {
+		std = 0
+	}
+
+	r, g, b, _ := c.RGBA()
+	bandColor := color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 40}
+
+	if std > 0 {
+		band, err := plotter.NewPolygon(plotter.XYs{
+			{X: minX, Y: mean - std}, {X: maxX, Y: mean - std},
+			{X: maxX, Y: mean + std}, {X: minX, Y: mean + std},
+		})
+		if err != nil {
+			return err
+		}
+		band.Color = bandColor
+		band.LineStyle.Width = 0
+		p.Add(band)
+	}
+
+	meanLine, err := plotter.NewLine(plotter.XYs{{X: minX, Y: mean}, {X: maxX, Y: mean}})
+	if err != nil {
+		return err
+	}
+	meanLine.Color = c
+	meanLine.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+	p.Add(meanLine)
+	p.Legend.Add(fmt.Sprintf("%s mean %.1f ±1σ %.1f", env, mean, std), meanLine)
+
+	return nil
+}
+
+// addMarkers adds a scatter with no line for pts
+func addMarkers(p *plot.Plot, label string, pts plotter.XYs, shape draw.GlyphDrawer, c color.Color) error {
+	scatter, err := plotter.NewScatter(pts)
+	if err != nil {
+		return err
+	}
+	scatter.Shape = shape
+	scatter.Color = c
+	scatter.Radius = vg.Points(4)
+	p.Add(scatter)
+	p.Legend.Add(label, scatter)
+	return nil
+}
+
+// getOutlierLabels returns labels, with the run ID, for samples whose distance from median
+// is more than outlierThreshold scaled MADs. Returns nil if there are no outliers.
+func getOutlierLabels(samples []Sample, values []float64, getX func(s *Sample) float64) (*plotter.Labels, error) {
+	m := median(values)
+	mad := scaledMAD(values)
+	if mad == 0 {
+		return nil, nil
+	}
+
+	xys := make(plotter.XYs, 0)
+	labels := make([]string, 0)
+	for i := range samples {
+		if math.Abs(values[i]-m)/mad > outlierThreshold {
+			xys = append(xys, plotter.XY{X: getX(&samples[i]), Y: values[i]})
+			labels = append(labels, fmt.Sprintf("run %d", samples[i].Run))
+		}
+	}
+	if len(xys) == 0 {
+		return nil, nil
+	}
+
+	l, err := plotter.NewLabels(plotter.XYLabels{XYs: xys, Labels: labels})
+	if err != nil {
+		return nil, err
+	}
+	for i := range l.TextStyle {
+		l.TextStyle[i].Font.Size = vg.Points(8)
+	}
+	l.Offset = vg.Point{X: vg.Points(3), Y: vg.Points(3)}
+	return l, nil
+}
@@ -3,21 +3,22 @@ package analyze
 import (
 	"context"
 	"fmt"
-	"image/png"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/opts"
 	"github.com/go-logr/logr"
 	"github.com/gonum/stat"
-	"github.com/jasonlvhit/gocron"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
 	"github.com/olivere/elastic/v7"
-	gim "github.com/ozankasikci/go-image-merge"
 
 	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/routing"
 	"github.com/gianlucam76/webex_bot/utils"
 	"github.com/gianlucam76/webex_bot/webex_utils"
 )
@@ -32,22 +33,21 @@ const minDurationInMinutes float64 = 5
 // an action is taken
 const rsdThreshold float64 = 10
 
-// CreatePieCharts creates pie chart with test duration for last available VCS
+// sendDurationPieChart creates pie chart with test duration for last available VCS
 // and UCS run
-func CreatePieCharts(ctx context.Context,
-	webexClient *webexteams.Client, roomID string,
-	logger logr.Logger) {
-	_ = gocron.Every(1).Friday().At("9:30:00").Do(sendDurationPieChart,
-		ctx, webexClient, roomID, logger)
-}
-
 func sendDurationPieChart(ctx context.Context,
 	webexClient *webexteams.Client, roomID string,
 	logger logr.Logger) {
+	ws, err := artifacts.New("charts", logger)
+	if err != nil {
+		return
+	}
+	defer ws.Remove(logger)
+
 	if shouldSendPieChart(ctx, true, logger) {
 		// create pie chart for vcs
-		if fileName, err := CreateDurationPieChart(ctx, true, roomID, logger); err == nil {
-			textMessage := "please open the attached file to see test duration pie chart from last VCS run"
+		if fileName, err := CreateDurationPieChart(ctx, ws, true, roomID, logger); err == nil {
+			textMessage := "here is the test duration chart from last VCS run"
 			if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
 				logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 			}
@@ -56,8 +56,8 @@ func sendDurationPieChart(ctx context.Context,
 
 	if shouldSendPieChart(ctx, false, logger) {
 		// create pie chart for ucs
-		if fileName, err := CreateDurationPieChart(ctx, false, roomID, logger); err == nil {
-			textMessage := "please open the attached file to see test duration pie chart from last UCS run"
+		if fileName, err := CreateDurationPieChart(ctx, ws, false, roomID, logger); err == nil {
+			textMessage := "here is the test duration chart from last UCS run"
 			if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
 				logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 			}
@@ -65,23 +65,26 @@ func sendDurationPieChart(ctx context.Context,
 	}
 }
 
-// CheckTestDurationOnUCS for each test in UCS:
+// evaluateUCSTest for each test in UCS:
 // - consider the runs in the last week;
 // - if the mean value is higher than minDurationInMinutes and
 // - if relative standard deviation is higher than rsdThreshold
 // send a message on the webex channel
-func CheckTestDurationOnUCS(ctx context.Context,
-	webexClient *webexteams.Client, roomID string,
-	logger logr.Logger) {
-	_ = gocron.Every(1).Monday().At("11:30:00").Do(evaluateUCSTest,
-		ctx, webexClient, roomID, logger)
-}
-
 func evaluateUCSTest(ctx context.Context,
 	webexClient *webexteams.Client, roomID string,
 	logger logr.Logger) {
-	maintainers := make(map[string]bool)
-	testFiles := make([]string, 0)
+	ws, err := artifacts.New(testDurationAnalyzer, logger)
+	if err != nil {
+		return
+	}
+	defer ws.Remove(logger)
+
+	// testMaintainer contains, per test, the test maintainer
+	testMaintainer := make(map[string]string)
+	// testPlots contains, per test with too much variance, the duration plot
+	testPlots := make(map[string][]string)
+	// evaluated contains tests for which data could be fetched
+	evaluated := make([]string, 0)
 
 	testNames, err := utils.BuildUCSTests(ctx, logger)
 	if err != nil {
@@ -90,13 +93,13 @@ func evaluateUCSTest(ctx context.Context,
 	}
 
 	for i := range testNames {
-		data, maintainer, err := getTestData(ctx, testNames[i], logger)
+		samples, maintainer, err := getTestData(ctx, testNames[i], logger)
 		if err != nil {
 			continue
 		}
+		evaluated = append(evaluated, testNames[i])
 
-		utils.Reverse(data)
-
+		data := getMeasuredValues(samples)
 		if len(data) < numberOfSuccessfulRuns {
 			continue
 		}
@@ -107,16 +110,27 @@ func evaluateUCSTest(ctx context.Context,
 			testNames[i], mean, std, rsd))
 
 		if mean >= minDurationInMinutes && rsd >= rsdThreshold {
-			environment := "ucs"
-			file := CreateDurationPlot(&environment, &testNames[i], data, mean, logger)
-			testFiles = append(testFiles, file)
-			maintainers[maintainer] = true
+			file := CreateDurationPlot(ws, testNames[i], []Series{{Environment: "ucs", Samples: samples}}, logger)
+			if file == "" {
+				continue
+			}
+			testPlots[testNames[i]] = []string{file}
+			testMaintainer[testNames[i]] = maintainer
 		}
 	}
 
-	if len(testFiles) > 0 {
-		sendAlertForTest(webexClient, roomID, testFiles, maintainers, logger)
+	notify, resolved := filterAlerts(testDurationAnalyzer, evaluated, testPlots, logger)
+	if len(notify) > 0 {
+		testOwner := make(map[string]string)
+		for i := range notify {
+			testOwner[notify[i]] = routing.GetTestOwner(notify[i], testMaintainer[notify[i]], logger)
+		}
+		textMessage := "I detected something which I believe needs to be looked at.  \n"
+		textMessage += "For the tests in the plot the relative standard deviation is too big.  \n"
+		sendAlerts(ws, testDurationAnalyzer, textMessage, notify, testPlots, testOwner, nil, logger)
 	}
+
+	sendResolvedNotice(webexClient, roomID, testDurationAnalyzer, resolved, logger)
 }
 
 // getLastRunResults returns last run results
@@ -155,21 +169,111 @@ func getLastRunResults(ctx context.Context, vcs bool,
 }
 
 // CreateDurationPieChart takes into consideration last available run.
-// Generates a pie chart considering test duration time.
+// Generates, in ws, a PNG donut chart considering test duration time.
 // Only tests that account for at least one percent of the total time
 // will be displayed
-func CreateDurationPieChart(ctx context.Context, vcs bool,
+func CreateDurationPieChart(ctx context.Context, ws *artifacts.Workspace, vcs bool,
 	roomID string, logger logr.Logger) (string, error) {
 	env := "ucs"
 	if vcs {
 		env = "vcs"
 	}
-	items := make([]opts.PieData, 0)
+
+	slices, err := getDurationPieSlices(ctx, vcs, logger)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := ws.Path(fmt.Sprintf("pie_chart_duration_%s.png", env))
+	title := fmt.Sprintf("%s test duration (tests marked with '*' ran in serial)", strings.ToUpper(env))
+	if err := CreatePieChart(title, "min", slices, true, fileName, logger); err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// CreateDurationPieChartHTML generates the same chart as CreateDurationPieChart
+// as an interactive HTML page
+func CreateDurationPieChartHTML(ctx context.Context, ws *artifacts.Workspace, vcs bool,
+	logger logr.Logger) (string, error) {
+	env := "ucs"
+	if vcs {
+		env = "vcs"
+	}
+
+	slices, err := getDurationPieSlices(ctx, vcs, logger)
+	if err != nil {
+		return "", err
+	}
+
+	items := make([]opts.PieData, len(slices))
+	for i := range slices {
+		items[i] = opts.PieData{
+			Name:  slices[i].Label,
+			Value: fmt.Sprintf("%.2f", slices[i].Value),
+		}
+	}
+
+	pie := charts.NewPie()
+	pie.SetGlobalOptions(
+		charts.WithTitleOpts(
+			opts.Title{
+				Title:    "Test duration (time is in minutes)",
+				Subtitle: "Only tests which account for at least more than one percent of total time are displayed\nTests marked with '*' ran in serial",
+			},
+		),
+	)
+	pie.SetSeriesOptions()
+	pie.AddSeries("Test duration", items).
+		SetSeriesOptions(
+			charts.WithPieChartOpts(
+				opts.PieChart{
+					Radius: 100,
+				},
+			),
+			charts.WithLabelOpts(
+				opts.Label{
+					Show:      true,
+					Formatter: "{b}: {c}",
+				},
+			),
+		)
+
+	fileName := ws.Path(fmt.Sprintf("pie_chart_duration_%s.html", env))
+	f, err := os.Create(fileName)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to create file %s. Err: %v", fileName, err))
+		return "", err
+	}
+	defer f.Close()
+
+	if err := pie.Render(f); err != nil {
+		logger.Info(fmt.Sprintf("Failed to render pie chart. Err: %v", err))
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// getDurationPieSlices returns, for last available run, a slice per test which
+// accounts for at least one percent of the total time. Remaining tests are grouped
+// in a single slice.
+func getDurationPieSlices(ctx context.Context, vcs bool,
+	logger logr.Logger) ([]PieSlice, error) {
+	env := "ucs"
+	if vcs {
+		env = "vcs"
+	}
 
 	results, err := getLastRunResults(ctx, vcs, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to get failed test in %s from elastic DB. Err: %v", env, err))
-		return "", err
+		return nil, err
+	}
+	if results == nil {
+		logger.Info("no data to generate pie chart")
+		return nil, fmt.Errorf("no data to generate pie chart")
 	}
 
 	// TODO: we stopped storing setup_wait_for_e2e result in es db.
@@ -186,6 +290,8 @@ func CreateDurationPieChart(ctx context.Context, vcs bool,
 		totalTime += r.DurationInMinutes
 	}
 
+	slices := make([]PieSlice, 0)
+
 	// Total time all tests that individually accounted for less than one percent of the total time.
 	var discardedTotalTime float64 = 0
 	for _, item := range results.Each(reflect.TypeOf(rtyp)) {
@@ -202,52 +308,22 @@ func CreateDurationPieChart(ctx context.Context, vcs bool,
 		if r.Serial {
 			name = fmt.Sprintf("%s*", r.Name)
 		}
-		items = append(items, opts.PieData{
-			Name:  name,
-			Value: fmt.Sprintf("%.2f", r.DurationInMinutes),
-		})
+		slices = append(slices, PieSlice{Label: name, Value: r.DurationInMinutes})
 	}
 
+	// Largest slices first
+	sort.SliceStable(slices, func(i, j int) bool { return slices[i].Value > slices[j].Value })
+
 	if discardedTotalTime > 0 {
-		items = append(items, opts.PieData{
-			Name:  "all others",
-			Value: discardedTotalTime,
-		})
+		slices = append(slices, PieSlice{Label: "all others", Value: discardedTotalTime})
 	}
 
-	if len(items) > 0 {
-		pie := charts.NewPie()
-		pie.SetGlobalOptions(
-			charts.WithTitleOpts(
-				opts.Title{
-					Title:    "Test duration (time is in minutes)",
-					Subtitle: "Only tests which account for at least more than one percent of total time are displayed\nTests marked with '*' ran in serial",
-				},
-			),
-		)
-		pie.SetSeriesOptions()
-		pie.AddSeries("Test duration", items).
-			SetSeriesOptions(
-				charts.WithPieChartOpts(
-					opts.PieChart{
-						Radius: 100,
-					},
-				),
-				charts.WithLabelOpts(
-					opts.Label{
-						Show:      true,
-						Formatter: "{b}: {c}",
-					},
-				),
-			)
-		filname := "/tmp/pie_chart_duration.html"
-		f, _ := os.Create(filname)
-		_ = pie.Render(f)
-
-		return filname, nil
+	if len(slices) == 0 {
+		logger.Info("no data to generate pie chart")
+		return nil, fmt.Errorf("no data to generate pie chart")
 	}
-	logger.Info("no data to generate pie chart")
-	return "", fmt.Errorf("no data to generate pie chart")
+
+	return slices, nil
 }
 
 // shouldSendPieChart gets latest run and if there are at least more than 20
@@ -273,19 +349,19 @@ func shouldSendPieChart(ctx context.Context, vcs bool,
 	return false
 }
 
-// getTestData consider the last 30 UCS runs and for a given test returns:
-// - durations in a form of slice
+// getTestData consider the last 100 UCS results and for a given test returns:
+// - a sample per run in the last two weeks. Failed and skipped runs are included;
 // - maintainer
-func getTestData(ctx context.Context, testName string, logger logr.Logger) (data []float64, maintainer string, err error) {
+func getTestData(ctx context.Context, testName string, logger logr.Logger) (samples []Sample, maintainer string, err error) {
 	var ucsResults *elastic.SearchResult
 	ucsResults, err = es_utils.GetResults(ctx, logger,
 		"",       // no specific run
 		testName, // for this specific test
 		false,    // no vcs
 		true,     // only ucs
-		true,     // only results where test passed
-		false,    // no failed
-		false,    // no skipped
+		false,    // no filter on passed
+		false,    // no filter on failed
+		false,    // no filter on skipped
 		100)      // consider the last 100 runs. We have an average of 3 runs per week. Setting this higher.
 	// Runs older than two weeks will be discarded later on.
 	if err != nil {
@@ -294,58 +370,21 @@ func getTestData(ctx context.Context, testName string, logger logr.Logger) (data
 	}
 
 	var rtyp es_utils.Result
-	data = make([]float64, 0)
 	for _, item := range ucsResults.Each(reflect.TypeOf(rtyp)) {
 		r := item.(es_utils.Result)
-
-		// Discard runs older than two weeks
-		lastValidTime := time.Now().Add(-13 * 24 * time.Hour)
-		if r.StartTime.After(lastValidTime) {
+		if r.Maintainer != "" {
 			maintainer = r.Maintainer
-			data = append(data, r.DurationInMinutes)
 		}
 	}
 
-	return
-}
-
-// sendAlertForTest generates a plot with test duration and send a webex message with such graph.
-func sendAlertForTest(webexClient *webexteams.Client, roomID string,
-	testFiles []string, maintainers map[string]bool,
-	logger logr.Logger) {
-
-	textMessage := "I detected something which I believe needs to be looked at. Tagging all maintainers:  \n"
-	for m := range maintainers {
-		textMessage += fmt.Sprintf("1. <@personEmail:%s@cisco.com|%s>  \n", m, m)
-	}
-	textMessage += "  \nFor the tests in the plot the relative standard deviation is too big.  \n"
-
-	x, y := GetGridSize(len(testFiles))
-
-	grids := make([]*gim.Grid, 0)
-	for i := range testFiles {
-		tmpGrid := gim.Grid{ImageFilePath: testFiles[i]}
-		grids = append(grids, &tmpGrid)
-	}
-	rgba, err := gim.New(grids, x, y).Merge()
-	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to create grid. Error %v", err))
-		return
-	}
-
-	gridFileName := "/tmp/test_analysis_grid.png"
-	file, err := os.Create(gridFileName)
-	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to create grid file. Error %v", err))
-		return
-	}
-
-	if err = png.Encode(file, rgba); err != nil {
-		logger.Info(fmt.Sprintf("Failed to encode grid file. Error %v", err))
-		return
+	// Discard runs older than two weeks
+	lastValidTime := time.Now().Add(-13 * 24 * time.Hour)
+	samples = make([]Sample, 0)
+	for _, s := range GetResultSamples(ucsResults) {
+		if s.Time.After(lastValidTime) {
+			samples = append(samples, s)
+		}
 	}
 
-	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{gridFileName}, logger); err != nil {
-		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
-	}
+	return
 }
@@ -0,0 +1,271 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/history"
+	"github.com/gianlucam76/webex_bot/utils"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+// Number of weeks and months shown in trend report
+const (
+	trendWeeks  = 26
+	trendMonths = 12
+)
+
+// sendTrendReport sends the trend report. Runs are read from the history database.
+func sendTrendReport(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client,
+	logger logr.Logger) {
+	ws, err := artifacts.New("trends", logger)
+	if err != nil {
+		return
+	}
+	defer ws.Remove(logger)
+
+	textMessage, fileName, err := GetTrendReport(ctx, ws, jiraClient, logger)
+	if err != nil {
+		return
+	}
+
+	textMessage = "Hello cloudstack team here is the monthly e2e trend report.  \n" + textMessage
+	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// GetTrendReport returns a message with mean time to resolution and a grid with:
+// - pass rate per environment per week;
+// - failed run percentage per environment per month;
+// - issues filed and resolved per week;
+// - mean time to resolution per month.
+// Plots and grid are created in ws.
+func GetTrendReport(ctx context.Context, ws *artifacts.Workspace, jiraClient *jira.Client,
+	logger logr.Logger) (textMessage, fileName string, err error) {
+	now := time.Now()
+	firstWeek := getWeekStart(now).AddDate(0, 0, -7*(trendWeeks-1))
+	firstMonth := getMonthStart(now).AddDate(0, -(trendMonths - 1), 0)
+
+	from := firstMonth
+	if firstWeek.Before(from) {
+		from = firstWeek
+	}
+	runs, err := history.GetRuns("", from, now, logger)
+	if err != nil {
+		return "", "", err
+	}
+
+	issues, err := utils.RunQuery(ctx, jiraClient, utils.TrendIssuesQuery, logger)
+	if err != nil {
+		return "", "", err
+	}
+
+	files := make([]string, 0)
+
+	// Pass rate per environment per week
+	passRate := make(map[string]plotter.XYs)
+	for _, env := range []string{"ucs", "vcs"} {
+		passed := make(map[time.Time]int)
+		total := make(map[time.Time]int)
+		for _, s := range runs {
+			week := getWeekStart(s.StartTime)
+			if s.Environment != env || week.Before(firstWeek) {
+				continue
+			}
+			passed[week] += s.Passed
+			total[week] += s.Passed + s.Failed
+		}
+		passRate[env] = getRatePoints(passed, total)
+	}
+	if file, err := createTrendPlot(ws, "Pass rate per week (%)", "pass_rate", passRate, logger); err == nil {
+		files = append(files, file)
+	}
+
+	// Failed run percentage per environment per month
+	failedRuns := make(map[string]plotter.XYs)
+	for _, env := range []string{"ucs", "vcs"} {
+		failed := make(map[time.Time]int)
+		total := make(map[time.Time]int)
+		for _, s := range runs {
+			month := getMonthStart(s.StartTime)
+			if s.Environment != env || month.Before(firstMonth) {
+				continue
+			}
+			if s.Failed > 0 {
+				failed[month]++
+			}
+			total[month]++
+		}
+		failedRuns[env] = getRatePoints(failed, total)
+	}
+	if file, err := createTrendPlot(ws, "Failed runs per month (%)", "failed_runs", failedRuns, logger); err == nil {
+		files = append(files, file)
+	}
+
+	// Issue inflow/outflow per week and time to resolution per month
+	inflow := make(map[time.Time]int)
+	outflow := make(map[time.Time]int)
+	resolutionDays := make(map[time.Time][]float64)
+	var totalDays float64
+	var resolvedIssues int
+	for i := range issues {
+		created := time.Time(issues[i].Fields.Created)
+		if week := getWeekStart(created); !week.Before(firstWeek) {
+			inflow[week]++
+		}
+
+		resolved := time.Time(issues[i].Fields.Resolutiondate)
+		if resolved.IsZero() {
+			continue
+		}
+		if week := getWeekStart(resolved); !week.Before(firstWeek) {
+			outflow[week]++
+		}
+		days := resolved.Sub(created).Hours() / 24
+		if month := getMonthStart(resolved); !month.Before(firstMonth) {
+			resolutionDays[month] = append(resolutionDays[month], days)
+		}
+		totalDays += days
+		resolvedIssues++
+	}
+	for week := firstWeek; !week.After(now); week = week.AddDate(0, 0, 7) {
+		// Weeks with no issues are shown as zero
+		inflow[week] += 0
+		outflow[week] += 0
+	}
+	flow := map[string]plotter.XYs{"filed": getCountPoints(inflow), "resolved": getCountPoints(outflow)}
+	if file, err := createTrendPlot(ws, "Issues per week", "issue_flow", flow, logger); err == nil {
+		files = append(files, file)
+	}
+
+	mttr := make(map[time.Time]float64)
+	for month, days := range resolutionDays {
+		var sum float64
+		for i := range days {
+			sum += days[i]
+		}
+		mttr[month] = sum / float64(len(days))
+	}
+	mttrPts := map[string]plotter.XYs{"MTTR": getValuePoints(mttr)}
+	if file, err := createTrendPlot(ws, "Mean time to resolution per month (days)", "mttr", mttrPts, logger); err == nil {
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return "", "", fmt.Errorf("failed to create trend plots")
+	}
+
+	fileName, err = createGrid(files, ws.Path("trends_grid.png"), logger)
+	if err != nil {
+		return "", "", err
+	}
+
+	textMessage = fmt.Sprintf("Runs considered: %d. Issues considered: %d.  \n", len(runs), len(issues))
+	if resolvedIssues > 0 {
+		textMessage += fmt.Sprintf("Mean time to resolution over the last six months: **%.1f days** (%d resolved issues)  \n",
+			totalDays/float64(resolvedIssues), resolvedIssues)
+	}
+
+	return textMessage, fileName, nil
+}
+
+// getRatePoints returns, sorted by time, the percentage of count over total
+func getRatePoints(count, total map[time.Time]int) plotter.XYs {
+	values := make(map[time.Time]float64)
+	for k, v := range total {
+		if v != 0 {
+			values[k] = float64(count[k]) * 100 / float64(v)
+		}
+	}
+	return getValuePoints(values)
+}
+
+// getCountPoints returns counts sorted by time
+func getCountPoints(count map[time.Time]int) plotter.XYs {
+	values := make(map[time.Time]float64)
+	for k, v := range count {
+		values[k] = float64(v)
+	}
+	return getValuePoints(values)
+}
+
+// getValuePoints returns values sorted by time
+func getValuePoints(values map[time.Time]float64) plotter.XYs {
+	times := make([]time.Time, 0, len(values))
+	for k := range values {
+		times = append(times, k)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	pts := make(plotter.XYs, len(times))
+	for i := range times {
+		pts[i].X = float64(times[i].Unix())
+		pts[i].Y = values[times[i]]
+	}
+	return pts
+}
+
+// createTrendPlot creates a line chart with a line per series. X axis is time.
+func createTrendPlot(ws *artifacts.Workspace, title, name string, series map[string]plotter.XYs,
+	logger logr.Logger) (string, error) {
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Tick.Marker = plot.TimeTicks{Format: "2006-01-02"}
+
+	names := make([]string, 0, len(series))
+	for k := range series {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	vs := make([]interface{}, 0)
+	for i := range names {
+		if len(series[names[i]]) == 0 {
+			continue
+		}
+		vs = append(vs, names[i], series[names[i]])
+	}
+	if len(vs) == 0 {
+		return "", fmt.Errorf("no data for %s", title)
+	}
+
+	if err := plotutil.AddLinePoints(p, vs...); err != nil {
+		logger.Info(fmt.Sprintf("Failed to create plot %s. Err: %v", title, err))
+		return "", err
+	}
+
+	fileName := ws.Path(fmt.Sprintf("trend_%s.png", name))
+	if err := p.Save(6*vg.Inch, 4*vg.Inch, fileName); err != nil {
+		logger.Info(fmt.Sprintf("Failed to save plot %s. Err: %v", title, err))
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// getWeekStart returns midnight of the Monday of the week t belongs to
+func getWeekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// getMonthStart returns midnight of the first day of the month t belongs to
+func getMonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
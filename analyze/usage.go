@@ -7,11 +7,12 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/gonum/stat"
-	"github.com/jasonlvhit/gocron"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
 
 	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/alerts"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/routing"
 	"github.com/gianlucam76/webex_bot/utils"
 )
 
@@ -19,26 +20,24 @@ import (
 // defined send a warning.
 const maxMemory = 500000
 
-// When relative standard deviation is higher than this value
-// an action is taken
+// When robust relative standard deviation (scaled median absolute deviation over median)
+// is higher than this value an action is taken
 const memoryRsdThreshold float64 = 40
 
-// When relative standard deviation is higher than this value
-// an action is taken
+// When robust relative standard deviation (scaled median absolute deviation over median)
+// is higher than this value an action is taken
 const cpuRsdThreshold float64 = 40
 
-// CheckReportUsageOnUCS for each reports in UCS:
-// - consider the runs in the last week;
-// - if relative standard deviation is higher than rsdThreshold
-// send a message on the webex channel
-// - if memory limit is defined, and memory usage is close to limit,
-// send a message on the webex channel
-func CheckReportUsageOnUCS(ctx context.Context,
-	webexClient *webexteams.Client, roomID string,
-	logger logr.Logger) {
-	_ = gocron.Every(1).Tuesday().At("11:00:00").Do(evaluateUCSUsageReports,
-		ctx, webexClient, roomID, logger)
-}
+// Variance is ignored when max memory usage across runs changes less than this
+// value (in Ki)
+const minMemoryChange float64 = 50 * 1024
+
+// Variance is ignored when max cpu usage across runs changes less than this
+// value (in m)
+const minCPUChange float64 = 50
+
+// SuppressText is the command used to suppress usage variance alerts for a pod
+const SuppressText = "suppress"
 
 // evaluateUCSUsageReports:
 // - gets list of available usage reports
@@ -54,38 +53,88 @@ func evaluateUCSUsageReports(ctx context.Context,
 		return
 	}
 
-	var reportFiles []string
+	ws, err := artifacts.New("usage", logger)
+	if err != nil {
+		return
+	}
+	defer ws.Remove(logger)
 
 	// Analyze per pod, memory and cpu variance.
-	reportFiles = analyzeUsageVariance(ctx, usageReports, logger)
-	if len(reportFiles) > 0 {
-		textMessage := "Hello I detected something which I believe needs to be looked at.  \n"
-		textMessage += "For the reports in the plot the relative standard deviation is too big.  \n"
-		logger.Info(textMessage)
-		//sendAlertForReport(webexClient, roomID, textMessage, reportFiles, logger)
+	plots, evaluated := analyzeUsageVariance(ctx, ws, usageReports, logger)
+	notify, resolved := filterAlerts(UsageVarianceAnalyzer, evaluated, plots, logger)
+	if len(notify) > 0 {
+		textMessage := "I detected something which I believe needs to be looked at.  \n"
+		textMessage += "For the pods in the plot usage varies too much across runs (outliers excluded).  \n"
+		sendAlerts(ws, UsageVarianceAnalyzer, textMessage, notify, plots, getPodOwners(notify, logger), nil, logger)
 	}
+	sendResolvedNotice(webexClient, roomID, UsageVarianceAnalyzer, resolved, logger)
 
 	// Analyze per pod memory usage compared to memory limit.
-	reportFiles = analyzeMemoryUsage(ctx, usageReports, logger)
-	if len(reportFiles) > 0 {
-		textMessage := "Hello I detected something which I believe needs to be looked at.  \n"
+	plots, recommendations, evaluated := analyzeMemoryUsage(ctx, ws, usageReports, logger)
+	notify, resolved = filterAlerts(memoryLimitAnalyzer, evaluated, plots, logger)
+	if len(notify) > 0 {
+		textMessage := "I detected something which I believe needs to be looked at.  \n"
 		textMessage += "For the reports in the plot, the max memory usage is too close to memory limit. Please consider increasing limit.  \n"
-		sendAlertForReport(webexClient, roomID, textMessage, reportFiles, logger)
+		sendAlerts(ws, memoryLimitAnalyzer, textMessage, notify, plots, getPodOwners(notify, logger),
+			getRecommendations(ws, recommendations, logger), logger)
 	}
+	sendResolvedNotice(webexClient, roomID, memoryLimitAnalyzer, resolved, logger)
 
 	// Analyze per pod memory usage compared to memory limit.
-	reportFiles = analyzeMemoryUsageWithNoLimit(ctx, usageReports, logger)
-	if len(reportFiles) > 0 {
-		textMessage := "Hello I detected something which I believe needs to be looked at.  \n"
+	plots, recommendations, evaluated = analyzeMemoryUsageWithNoLimit(ctx, ws, usageReports, logger)
+	notify, resolved = filterAlerts(memoryNoLimitAnalyzer, evaluated, plots, logger)
+	if len(notify) > 0 {
+		textMessage := "I detected something which I believe needs to be looked at.  \n"
 		textMessage += "For the reports in the plot, the max memory usage is too high and no memory limit is defined. Please consider adding requets and limits.  \n"
-		sendAlertForReport(webexClient, roomID, textMessage, reportFiles, logger)
+		sendAlerts(ws, memoryNoLimitAnalyzer, textMessage, notify, plots, getPodOwners(notify, logger),
+			getRecommendations(ws, recommendations, logger), logger)
+	}
+	sendResolvedNotice(webexClient, roomID, memoryNoLimitAnalyzer, resolved, logger)
+}
+
+// getPodOwners returns, per pod, the owner of the pod namespace
+func getPodOwners(pods []string, logger logr.Logger) map[string]string {
+	podOwner := make(map[string]string)
+	for i := range pods {
+		namespace, _ := splitPodName(pods[i])
+		podOwner[pods[i]] = routing.GetNamespaceOwner(namespace, logger)
+	}
+	return podOwner
+}
+
+// getRecommendations returns a function that, for a set of pods, returns the recommended
+// requests and limits and the corresponding resources patches.
+func getRecommendations(ws *artifacts.Workspace, recommendations map[string]*ResourceRecommendation,
+	logger logr.Logger) func(pods []string) (string, []string) {
+	return func(pods []string) (string, []string) {
+		textMessage := ""
+		patchFiles := make([]string, 0)
+		for i := range pods {
+			r, ok := recommendations[pods[i]]
+			if !ok {
+				continue
+			}
+			if textMessage == "" {
+				textMessage = "Recommended requests and limits:  \n"
+			}
+			textMessage += r.Markdown()
+			if patchFile, err := CreateResourcesPatch(ws, r, logger); err == nil {
+				patchFiles = append(patchFiles, patchFile)
+			}
+		}
+		return textMessage, patchFiles
 	}
 }
 
 // analyzeMemoryUsage considers all pods for which memory usage was collected.
-// If pod memory usage is too close to limit, generate a plot with collected samples.
-func analyzeMemoryUsage(ctx context.Context, reports []string, logger logr.Logger) []string {
-	reportFiles := make([]string, 0)
+// If pod memory usage is too close to limit, generate a plot with collected samples
+// and a resource recommendation.
+// Returns also the pods for which usage could be fetched.
+func analyzeMemoryUsage(ctx context.Context, ws *artifacts.Workspace, reports []string,
+	logger logr.Logger) (map[string][]string, map[string]*ResourceRecommendation, []string) {
+	reportFiles := make(map[string][]string)
+	recommendations := make(map[string]*ResourceRecommendation)
+	evaluated := make([]string, 0)
 
 	for i := range reports {
 		podName := &reports[i]
@@ -94,6 +143,7 @@ func analyzeMemoryUsage(ctx context.Context, reports []string, logger logr.Logge
 		if err != nil {
 			continue
 		}
+		evaluated = append(evaluated, *podName)
 
 		if len(data) < numberOfAvailableRuns {
 			logger.Info(fmt.Sprintf("Not enough available runs for pod %q", reports[i]))
@@ -106,20 +156,28 @@ func analyzeMemoryUsage(ctx context.Context, reports []string, logger logr.Logge
 		// data[0] is from last available run, so always use it.
 		if data[0].MemoryLimit != 0 && max >= 0.9*float64(data[0].MemoryLimit) {
 			logger.Info(fmt.Sprintf("Max memory consumption (%f) is too close to memory limit (%d)", max, data[0].MemoryLimit))
-			mean, _ := stat.MeanStdDev(memorySamples, nil)
-			environment := "ucs"
-			fileName := CreateMemoryPlot(&environment, podName, memorySamples, mean, float64(data[0].MemoryLimit), logger)
-			reportFiles = append(reportFiles, fileName)
+			series := []Series{{Environment: "ucs", Samples: GetUsageSamples(data, false)}}
+			if fileName := CreateMemoryPlot(ws, *podName, series, float64(data[0].MemoryLimit), logger); fileName != "" {
+				reportFiles[*podName] = []string{fileName}
+			}
+			if recommendation, err := RecommendResources(*podName, data); err == nil {
+				recommendations[*podName] = recommendation
+			}
 		}
 	}
 
-	return reportFiles
+	return reportFiles, recommendations, evaluated
 }
 
 // analyzeMemoryUsageWithNoLimit considers all pods for which memory usage was collected.
-// If pod memory usage is too high and no limit is defined, generate a plot with collected samples.
-func analyzeMemoryUsageWithNoLimit(ctx context.Context, reports []string, logger logr.Logger) []string {
-	reportFiles := make([]string, 0)
+// If pod memory usage is too high and no limit is defined, generate a plot with collected samples
+// and a resource recommendation.
+// Returns also the pods for which usage could be fetched.
+func analyzeMemoryUsageWithNoLimit(ctx context.Context, ws *artifacts.Workspace, reports []string,
+	logger logr.Logger) (map[string][]string, map[string]*ResourceRecommendation, []string) {
+	reportFiles := make(map[string][]string)
+	recommendations := make(map[string]*ResourceRecommendation)
+	evaluated := make([]string, 0)
 
 	for i := range reports {
 		podName := &reports[i]
@@ -128,6 +186,7 @@ func analyzeMemoryUsageWithNoLimit(ctx context.Context, reports []string, logger
 		if err != nil {
 			continue
 		}
+		evaluated = append(evaluated, *podName)
 
 		if len(data) < numberOfAvailableRuns {
 			logger.Info(fmt.Sprintf("Not enough available runs for pod %q", reports[i]))
@@ -142,10 +201,13 @@ func analyzeMemoryUsageWithNoLimit(ctx context.Context, reports []string, logger
 			if max > maxMemory {
 				logger.Info(fmt.Sprintf("Max memory consumption (%f) is too high and no memory limit is defined. Please considere adding mremory limit/request",
 					max))
-				mean, _ := stat.MeanStdDev(memorySamples, nil)
-				environment := "ucs"
-				fileName := CreateMemoryPlot(&environment, podName, memorySamples, mean, float64(data[0].MemoryLimit), logger)
-				reportFiles = append(reportFiles, fileName)
+				series := []Series{{Environment: "ucs", Samples: GetUsageSamples(data, false)}}
+				if fileName := CreateMemoryPlot(ws, *podName, series, float64(data[0].MemoryLimit), logger); fileName != "" {
+					reportFiles[*podName] = []string{fileName}
+				}
+				if recommendation, err := RecommendResources(*podName, data); err == nil {
+					recommendations[*podName] = recommendation
+				}
 			} else {
 				logger.Info(fmt.Sprintf("Pod: %s memory limit not set. Skip analyzing it", reports[i]))
 			}
@@ -153,13 +215,16 @@ func analyzeMemoryUsageWithNoLimit(ctx context.Context, reports []string, logger
 		}
 	}
 
-	return reportFiles
+	return reportFiles, recommendations, evaluated
 }
 
 // analyzeUsageVariance considers all pods for which (memory and cpu) usage was collected.
 // Considering all collected pod samples if there is too much variance, generate a plot with samples.
-func analyzeUsageVariance(ctx context.Context, reports []string, logger logr.Logger) []string {
-	reportFiles := make([]string, 0)
+// Returns, per pod with too much variance, the plots and the pods for which usage could be fetched.
+func analyzeUsageVariance(ctx context.Context, ws *artifacts.Workspace, reports []string,
+	logger logr.Logger) (map[string][]string, []string) {
+	reportFiles := make(map[string][]string)
+	evaluated := make([]string, 0)
 
 	for i := range reports {
 		// Get usage reports for a given pod
@@ -167,21 +232,22 @@ func analyzeUsageVariance(ctx context.Context, reports []string, logger logr.Log
 		if err != nil {
 			continue
 		}
+		evaluated = append(evaluated, reports[i])
 
 		if len(data) < numberOfAvailableRuns {
 			continue
 		}
 
-		if fileName := analyzeMemoryVariance(reports[i], data, logger); fileName != "" {
-			reportFiles = append(reportFiles, fileName)
+		if fileName := analyzeMemoryVariance(ws, reports[i], data, logger); fileName != "" {
+			reportFiles[reports[i]] = append(reportFiles[reports[i]], fileName)
 		}
 
-		if fileName := analyzeCPUVariance(reports[i], data, logger); fileName != "" {
-			reportFiles = append(reportFiles, fileName)
+		if fileName := analyzeCPUVariance(ws, reports[i], data, logger); fileName != "" {
+			reportFiles[reports[i]] = append(reportFiles[reports[i]], fileName)
 		}
 	}
 
-	return reportFiles
+	return reportFiles, evaluated
 }
 
 // getUsageReportData for a given pod, returns usage considering the last 30 runs,
@@ -234,45 +300,60 @@ func getCPUSamples(data []es_utils.UsageReport) []float64 {
 	return cpu
 }
 
-func analyzeMemoryVariance(pod string, data []es_utils.UsageReport, logger logr.Logger) string {
+func analyzeMemoryVariance(ws *artifacts.Workspace, pod string, data []es_utils.UsageReport, logger logr.Logger) string {
 	memorySamples := getMemorySamples(data)
-	mean, std := stat.MeanStdDev(memorySamples, nil)
 
-	if mean <= 1 {
-		logger.Info(fmt.Sprintf("Usage Report for pod: %s Mean: %f is too low. Skip analyzing rsd", pod, mean))
+	if !isTooVariable(pod, "memory", memorySamples, 1, memoryRsdThreshold, minMemoryChange, logger) {
 		return ""
 	}
 
-	rsd := std * 100 / mean
-	logger.Info(fmt.Sprintf("Usage Report for pod: %s Mean: %f Standard Deviation: %f Relative Standard Deviation: %f",
-		pod, mean, std, rsd))
-
-	if rsd >= memoryRsdThreshold {
-		environment := "ucs"
-		fileName := CreateMemoryPlot(&environment, &pod, memorySamples, mean, float64(data[0].MemoryLimit), logger)
-		return fileName
-	}
-
-	return ""
+	series := []Series{{Environment: "ucs", Samples: GetUsageSamples(data, false)}}
+	return CreateMemoryPlot(ws, pod, series, float64(data[0].MemoryLimit), logger)
 }
 
-func analyzeCPUVariance(pod string, data []es_utils.UsageReport, logger logr.Logger) string {
+func analyzeCPUVariance(ws *artifacts.Workspace, pod string, data []es_utils.UsageReport, logger logr.Logger) string {
 	cpuSamples := getCPUSamples(data)
-	mean, std := stat.MeanStdDev(cpuSamples, nil)
 
-	if mean <= 10 {
-		logger.Info(fmt.Sprintf("Usage Report for pod: %s Mean: %f is too low. Skip analyzing rsd", pod, mean))
+	if !isTooVariable(pod, "cpu", cpuSamples, 10, cpuRsdThreshold, minCPUChange, logger) {
 		return ""
 	}
 
-	rsd := std * 100 / mean
-	logger.Info(fmt.Sprintf("Usage Report for pod: %s Mean: %f Standard Deviation: %f Relative Standard Deviation: %f",
-		pod, mean, std, rsd))
+	series := []Series{{Environment: "ucs", Samples: GetUsageSamples(data, true)}}
+	return createCPUPlot(ws, pod, series, float64(data[0].CPULimit), logger)
+}
+
+// isTooVariable returns true if samples vary too much. At least numberOfAvailableRuns
+// samples are needed. Outliers are first trimmed, then:
+// - median must be higher than minMedian;
+// - robust relative standard deviation must be higher than rsdThreshold;
+// - difference between max and min must be higher than minChange.
+func isTooVariable(pod, usageType string, samples []float64, minMedian, rsdThreshold, minChange float64,
+	logger logr.Logger) bool {
+	if len(samples) < numberOfAvailableRuns {
+		logger.Info(fmt.Sprintf("Usage Report for pod: %s (%s) not enough samples", pod, usageType))
+		return false
+	}
+
+	// Trimming never drops more than half of the samples, as at least half are
+	// within one MAD from median.
+	trimmed := trimOutliers(samples)
 
-	if rsd >= cpuRsdThreshold {
-		fileName := createCPUPlot(&pod, cpuSamples, mean, float64(data[0].CPULimit), logger)
-		return fileName
+	m := median(trimmed)
+	if m <= minMedian {
+		logger.Info(fmt.Sprintf("Usage Report for pod: %s (%s) Median: %f is too low. Skip analyzing rsd", pod, usageType, m))
+		return false
 	}
 
-	return ""
+	rsd := scaledMAD(trimmed) * 100 / m
+	min, max := minMax(trimmed)
+	logger.Info(fmt.Sprintf("Usage Report for pod: %s (%s) Median: %f Robust Relative Standard Deviation: %f Change: %f (outliers: %d)",
+		pod, usageType, m, rsd, max-min, len(samples)-len(trimmed)))
+
+	return rsd >= rsdThreshold && max-min >= minChange
+}
+
+// SuppressUsageAlert stops usage variance alerts for pod till duration has elapsed.
+func SuppressUsageAlert(pod string, duration time.Duration, logger logr.Logger) error {
+	_, err := alerts.Snooze(alerts.GetID(UsageVarianceAnalyzer, pod), duration, logger)
+	return err
 }
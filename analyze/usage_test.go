@@ -0,0 +1,33 @@
+package analyze
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestIsTooVariable(t *testing.T) {
+	tests := []struct {
+		name      string
+		samples   []float64
+		minChange float64
+		expected  bool
+	}{
+		{name: "not enough samples", samples: []float64{100, 300, 100, 300, 100, 300}, minChange: 50},
+		{name: "stable", samples: []float64{100, 101, 99, 100, 100, 101, 99}, minChange: 50},
+		{name: "variable", samples: []float64{100, 200, 300, 100, 200, 300, 200}, minChange: 50, expected: true},
+		{name: "variable with outlier", samples: []float64{100, 200, 300, 100, 200, 300, 5000}, minChange: 50,
+			expected: true},
+		{name: "change too small", samples: []float64{100, 200, 300, 100, 200, 300, 200}, minChange: 500},
+		{name: "median too low", samples: []float64{0, 0, 0, 0, 1, 1, 1}, minChange: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTooVariable("default:app", "memory", tt.samples, 1, memoryRsdThreshold, tt.minChange,
+				logr.Discard()); got != tt.expected {
+				t.Errorf("isTooVariable(%v) = %v, expected %v", tt.samples, got, tt.expected)
+			}
+		})
+	}
+}
@@ -2,15 +2,20 @@ package analyze
 
 import (
 	"fmt"
-	"image/color"
+	"math"
+	"sort"
 
 	"github.com/go-logr/logr"
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
-	"gonum.org/v1/plot/vg"
+
+	"github.com/gianlucam76/webex_bot/artifacts"
 )
 
+// Scale factor making median absolute deviation comparable to standard deviation
+const madScaleFactor float64 = 1.4826
+
+// Samples more than this number of scaled MADs away from the median are outliers
+const outlierThreshold float64 = 3.5
+
 func minMax(data []float64) (min, max float64) {
 	min = data[0]
 	max = data[0]
@@ -25,138 +30,90 @@ func minMax(data []float64) (min, max float64) {
 	return
 }
 
-func CreateDurationPlot(environment, testName *string, data []float64, mean float64, logger logr.Logger) string {
-	logger.Info(fmt.Sprintf("Generate duration plot for test %s", *testName))
+// median returns the median of data. data is not modified.
+func median(data []float64) float64 {
+	sorted := make([]float64, len(data))
+	copy(sorted, data)
+	sort.Float64s(sorted)
 
-	pts := make(plotter.XYs, len(data))
-	for i := range data {
-		pts[i].X = float64(i)
-		pts[i].Y = data[i]
-	}
-
-	p := plot.New()
-
-	p.Title.Text = *testName
-	p.X.Label.Text = "Runs (index is not used)"
-	p.Y.Label.Text = "Time in minute"
-
-	min, max := minMax(data)
-	p.Y.Max = max + 3
-	p.Y.Min = min - 3
-	p.X.Max = float64(len(data) + 3)
-
-	err := plotutil.AddLinePoints(p, fmt.Sprintf("Duration (env: %s)", *environment), pts)
-
-	meanPlot := plotter.NewFunction(func(x float64) float64 { return mean })
-	meanPlot.Color = color.RGBA{B: 255, A: 255}
-	p.Add(meanPlot)
-	p.Legend.Add("Mean", meanPlot)
-
-	if err != nil {
-		panic(err)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
 	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
 
-	fileName := fmt.Sprintf("/tmp/duration_%s.png", *testName)
-	// Save the plot to a PNG file.
-	if err := p.Save(4*vg.Inch, 4*vg.Inch, fileName); err != nil {
-		panic(err)
+// scaledMAD returns the median absolute deviation scaled to be a consistent
+// estimator of the standard deviation for normally distributed data.
+func scaledMAD(data []float64) float64 {
+	m := median(data)
+	deviations := make([]float64, len(data))
+	for i := range data {
+		deviations[i] = math.Abs(data[i] - m)
 	}
-
-	return fileName
+	return madScaleFactor * median(deviations)
 }
 
-func CreateMemoryPlot(environment, podName *string, data []float64, mean, limit float64, logger logr.Logger) string {
-	logger.Info(fmt.Sprintf("Generate memory plot for pod %s", *podName))
+// trimOutliers returns data without outliers. An outlier is any sample whose
+// distance from median is more than outlierThreshold scaled MADs.
+// Order is preserved.
+func trimOutliers(data []float64) []float64 {
+	m := median(data)
+	mad := scaledMAD(data)
+	if mad == 0 {
+		return data
+	}
 
-	pts := make(plotter.XYs, len(data))
+	trimmed := make([]float64, 0, len(data))
 	for i := range data {
-		pts[i].X = float64(i)
-		pts[i].Y = data[i]
+		if math.Abs(data[i]-m)/mad <= outlierThreshold {
+			trimmed = append(trimmed, data[i])
+		}
 	}
+	return trimmed
+}
 
-	p := plot.New()
-
-	p.Title.Text = *podName
-	p.X.Label.Text = "Runs (index is not used)"
-	p.Y.Label.Text = "Memory (in Ki)"
-
-	min, max := minMax(data)
-	p.Y.Max = max + 3
-	p.Y.Min = min - 3
-	p.X.Max = float64(len(data) + 3)
-
-	err := plotutil.AddLinePoints(p, fmt.Sprintf("Max Memory used (env: %s)", *environment), pts)
-
-	meanPlot := plotter.NewFunction(func(x float64) float64 { return mean })
-	meanPlot.Color = color.RGBA{B: 255, A: 255}
-	p.Add(meanPlot)
-	p.Legend.Add("Mean", meanPlot)
-
-	if limit != 0 {
-		p.Y.Max = limit + 3
-		limitPlot := plotter.NewFunction(func(x float64) float64 { return limit })
-		limitPlot.Color = color.RGBA{B: 200, A: 200}
-		p.Add(limitPlot)
-		p.Legend.Add("Limit (in Ki)", limitPlot)
-	}
+// CreateDurationPlot creates, in ws, a plot with test or report durations per run.
+// Passing both VCS and UCS series overlays them on the same axes.
+// Returns the file name, empty if plot could not be created.
+func CreateDurationPlot(ws *artifacts.Workspace, name string, series []Series, logger logr.Logger) string {
+	logger.Info(fmt.Sprintf("Generate duration plot for %s", name))
 
+	fileName, err := createSamplePlot(ws, name, "Time in minute", fmt.Sprintf("duration_%s.png", name),
+		series, 0, logger)
 	if err != nil {
-		panic(err)
-	}
-
-	fileName := fmt.Sprintf("/tmp/memory_%s.png", *podName)
-	// Save the plot to a PNG file.
-	if err := p.Save(4*vg.Inch, 4*vg.Inch, fileName); err != nil {
-		panic(err)
+		return ""
 	}
-
 	return fileName
 }
 
-func createCPUPlot(podName *string, data []float64, mean, limit float64, logger logr.Logger) string {
-	logger.Info(fmt.Sprintf("Generate cpu plot for pod %s", *podName))
+// CreateMemoryPlot creates, in ws, a plot with max memory used by a pod per run.
+// If limit is not zero, memory limit is drawn as well.
+// Returns the file name, empty if plot could not be created.
+func CreateMemoryPlot(ws *artifacts.Workspace, podName string, series []Series, limit float64,
+	logger logr.Logger) string {
+	logger.Info(fmt.Sprintf("Generate memory plot for pod %s", podName))
 
-	pts := make(plotter.XYs, len(data))
-	for i := range data {
-		pts[i].X = float64(i)
-		pts[i].Y = data[i]
+	fileName, err := createSamplePlot(ws, podName, "Memory (in Ki)", fmt.Sprintf("memory_%s.png", podName),
+		series, limit, logger)
+	if err != nil {
+		return ""
 	}
+	return fileName
+}
 
-	p := plot.New()
-
-	p.Title.Text = *podName
-	p.X.Label.Text = "Run ID"
-	p.Y.Label.Text = "CPU (in m)"
-
-	min, max := minMax(data)
-	p.Y.Max = max + 3
-	p.Y.Min = min - 3
-	p.X.Max = float64(len(data) + 3)
-
-	err := plotutil.AddLinePoints(p, "Max CPU used", pts)
-
-	meanPlot := plotter.NewFunction(func(x float64) float64 { return mean })
-	meanPlot.Color = color.RGBA{B: 255, A: 255}
-	p.Add(meanPlot)
-	p.Legend.Add("Mean", meanPlot)
-
-	if limit != 0 {
-		limitPlot := plotter.NewFunction(func(x float64) float64 { return limit })
-		limitPlot.Color = color.RGBA{B: 200, A: 200}
-		p.Add(limitPlot)
-		p.Legend.Add("Limit (in Ki)", limitPlot)
-	}
+// createCPUPlot creates, in ws, a plot with max cpu used by a pod per run.
+// If limit is not zero, cpu limit is drawn as well.
+// Returns the file name, empty if plot could not be created.
+func createCPUPlot(ws *artifacts.Workspace, podName string, series []Series, limit float64,
+	logger logr.Logger) string {
+	logger.Info(fmt.Sprintf("Generate cpu plot for pod %s", podName))
 
+	fileName, err := createSamplePlot(ws, podName, "CPU (in m)", fmt.Sprintf("cpu_%s.png", podName),
+		series, limit, logger)
 	if err != nil {
-		panic(err)
+		return ""
 	}
-
-	fileName := fmt.Sprintf("/tmp/cpu_%s.png", *podName)
-	// Save the plot to a PNG file.
-	if err := p.Save(4*vg.Inch, 4*vg.Inch, fileName); err != nil {
-		panic(err)
-	}
-
 	return fileName
 }
 
@@ -0,0 +1,49 @@
+package analyze
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestScaledMAD(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []float64
+		expected float64
+	}{
+		{name: "constant", data: []float64{5, 5, 5}, expected: 0},
+		{name: "odd number of samples", data: []float64{1, 2, 3, 4, 5}, expected: madScaleFactor},
+		{name: "even number of samples", data: []float64{1, 2, 3, 4}, expected: madScaleFactor},
+		{name: "outlier does not matter", data: []float64{10, 11, 9, 10, 1000}, expected: madScaleFactor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scaledMAD(tt.data); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("scaledMAD(%v) = %v, expected %v", tt.data, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTrimOutliers(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []float64
+		expected []float64
+	}{
+		{name: "no outliers", data: []float64{10, 11, 9, 10}, expected: []float64{10, 11, 9, 10}},
+		{name: "high outlier", data: []float64{10, 11, 9, 10, 100}, expected: []float64{10, 11, 9, 10}},
+		{name: "low and high outliers", data: []float64{0, 10, 11, 9, 10, 100}, expected: []float64{10, 11, 9, 10}},
+		{name: "zero MAD", data: []float64{5, 5, 5, 50}, expected: []float64{5, 5, 5, 50}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimOutliers(tt.data); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("trimOutliers(%v) = %v, expected %v", tt.data, got, tt.expected)
+			}
+		})
+	}
+}
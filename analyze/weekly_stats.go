@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/jasonlvhit/gocron"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
 	"github.com/olivere/elastic/v7"
 
@@ -23,14 +22,6 @@ type kv struct {
 
 type KVHeap []kv
 
-// WeeklyStats sends a summary of UCS and VCS weekly result
-func WeeklyStats(ctx context.Context,
-	webexClient *webexteams.Client, roomID string,
-	logger logr.Logger) {
-	_ = gocron.Every(1).Friday().At("10:30:00").Do(sendStats,
-		ctx, webexClient, roomID, logger)
-}
-
 // sendStats collects all runs in the last "run".
 // Report tests the top 5 test which failed the most, if any.
 func sendStats(ctx context.Context,
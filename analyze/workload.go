@@ -0,0 +1,202 @@
+package analyze
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/utils"
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+// unassigned is used, in workload report, for issues with no assignee
+const unassigned = "unassigned"
+
+// workloadIssue is an open issue in the active sprint
+type workloadIssue struct {
+	key         string
+	priority    string
+	age         int
+	occurrences int
+}
+
+// sendWorkloadReport sends, every week, the workload report for the active sprint
+func sendWorkloadReport(ctx context.Context,
+	webexClient *webexteams.Client, roomID string,
+	jiraClient *jira.Client,
+	logger logr.Logger) {
+	ws, err := artifacts.New("workload", logger)
+	if err != nil {
+		return
+	}
+	defer ws.Remove(logger)
+
+	textMessage, fileName, err := GetWorkloadReport(ctx, ws, jiraClient, logger)
+	if err != nil {
+		return
+	}
+
+	textMessage = "Hello cloudstack team here is the workload for the active sprint.  \n" + textMessage
+	if fileName == "" {
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// GetWorkloadReport returns, per assignee, the open e2e issues in the active sprint
+// with their age, recurrence count and priority, formatted as a table.
+// It also returns the name of a file, in ws, containing a bar chart with the number of issues per
+// assignee, stacked by priority. File name is empty if there are no issues.
+func GetWorkloadReport(ctx context.Context, ws *artifacts.Workspace, jiraClient *jira.Client,
+	logger logr.Logger) (textMessage, fileName string, err error) {
+	sprint, issues, err := utils.GetActiveSprintIssues(ctx, jiraClient, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get active sprint issues. Err: %v", err))
+		return "", "", err
+	}
+
+	if len(issues) == 0 {
+		return fmt.Sprintf("There are no open e2e issues in sprint %s  \n", sprint.Name), "", nil
+	}
+
+	workload := make(map[string][]workloadIssue)
+	for i := range issues {
+		w := workloadIssue{
+			key:         issues[i].Key,
+			age:         int(time.Since(time.Time(issues[i].Fields.Created)).Hours() / 24),
+			occurrences: len(utils.GetAtomComments(&issues[i], false)),
+		}
+		if issues[i].Fields.Priority != nil {
+			w.priority = issues[i].Fields.Priority.Name
+		}
+
+		assignee := unassigned
+		if issues[i].Fields.Assignee != nil {
+			assignee = issues[i].Fields.Assignee.Name
+		}
+		workload[assignee] = append(workload[assignee], w)
+	}
+
+	// Assignees with most issues first
+	assignees := make([]string, 0, len(workload))
+	for k := range workload {
+		assignees = append(assignees, k)
+	}
+	sort.Slice(assignees, func(i, j int) bool {
+		if len(workload[assignees[i]]) != len(workload[assignees[j]]) {
+			return len(workload[assignees[i]]) > len(workload[assignees[j]])
+		}
+		return assignees[i] < assignees[j]
+	})
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ASSIGNEE\tISSUE\tPRIORITY\tAGE (days)\tSEEN")
+	for _, assignee := range assignees {
+		sort.Slice(workload[assignee], func(i, j int) bool {
+			return workload[assignee][i].age > workload[assignee][j].age
+		})
+		for _, issue := range workload[assignee] {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", assignee, issue.key, issue.priority, issue.age, issue.occurrences)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		logger.Info(fmt.Sprintf("Failed to format workload table. Err: %v", err))
+		return "", "", err
+	}
+
+	textMessage = fmt.Sprintf("Sprint %s: %d open e2e issues across %d assignees.  \n",
+		sprint.Name, len(issues), len(assignees))
+	textMessage += "```\n" + table.String() + "```\n"
+
+	fileName, err = createWorkloadChart(ws, assignees, workload, logger)
+	if err != nil {
+		return textMessage, "", nil
+	}
+
+	return textMessage, fileName, nil
+}
+
+// createWorkloadChart creates a bar chart with number of issues per assignee, stacked by priority
+func createWorkloadChart(ws *artifacts.Workspace, assignees []string, workload map[string][]workloadIssue,
+	logger logr.Logger) (string, error) {
+	priorityMap := make(map[string]bool)
+	for _, issues := range workload {
+		for i := range issues {
+			priorityMap[issues[i].priority] = true
+		}
+	}
+	priorities := make([]string, 0, len(priorityMap))
+	for k := range priorityMap {
+		priorities = append(priorities, k)
+	}
+	sort.Strings(priorities)
+
+	p := plot.New()
+	p.Title.Text = "Open e2e issues per assignee"
+	p.Y.Label.Text = "Issues"
+	p.Legend.Top = true
+
+	barWidth := vg.Points(20)
+	var previous *plotter.BarChart
+	for i, priority := range priorities {
+		values := make(plotter.Values, len(assignees))
+		for j, assignee := range assignees {
+			for _, issue := range workload[assignee] {
+				if issue.priority == priority {
+					values[j]++
+				}
+			}
+		}
+
+		bars, err := plotter.NewBarChart(values, barWidth)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to create bar chart. Err: %v", err))
+			return "", err
+		}
+		bars.LineStyle.Width = vg.Length(0)
+		bars.Color = plotutil.Color(i)
+		if previous != nil {
+			bars.StackOn(previous)
+		}
+		previous = bars
+
+		p.Add(bars)
+		label := priority
+		if label == "" {
+			label = "no priority"
+		}
+		p.Legend.Add(label, bars)
+	}
+	p.NominalX(assignees...)
+
+	fileName := ws.Path("workload.png")
+	width := vg.Length(len(assignees)) * vg.Inch
+	if width < 4*vg.Inch {
+		width = 4 * vg.Inch
+	}
+	if err := p.Save(width, 4*vg.Inch, fileName); err != nil {
+		logger.Info(fmt.Sprintf("Failed to save workload chart. Err: %v", err))
+		return "", err
+	}
+
+	return fileName, nil
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+
+	"github.com/gianlucam76/webex_bot/alerts"
+	"github.com/gianlucam76/webex_bot/history"
+	"github.com/gianlucam76/webex_bot/utils"
+)
+
+const (
+	// apiTokenEnv is the env variable containing the token API clients must present.
+	// If not set, API is disabled.
+	apiTokenEnv = "E2E_API_TOKEN"
+
+	// Prefix of all API paths
+	apiPath = "/api/v1/"
+
+	// Default and maximum number of days of history returned
+	defaultDays = 7
+	maxDays     = 400
+
+	// Default and maximum number of runs considered for a test history
+	defaultTestRuns = 30
+	maxTestRuns     = 200
+)
+
+// LastRun contains the tests which failed in the last run of an environment
+type LastRun struct {
+	Environment string       `json:"environment"`
+	Run         int64        `json:"run"`
+	Link        string       `json:"link"`
+	Failed      []FailedTest `json:"failed"`
+}
+
+// FailedTest is a test which failed along with the open issue tracking its failure, if any
+type FailedTest struct {
+	Name  string `json:"name"`
+	Issue string `json:"issue,omitempty"`
+}
+
+// Issue is an open issue filed during e2e sanity
+type Issue struct {
+	Key      string    `json:"key"`
+	Link     string    `json:"link"`
+	Summary  string    `json:"summary"`
+	Status   string    `json:"status"`
+	Assignee string    `json:"assignee,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// apiError is the body of any failed request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// handlerFunc serves an API request. Returned value is sent as JSON.
+type handlerFunc func(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error)
+
+// badRequest is returned by a handlerFunc when request is not valid
+type badRequest struct {
+	msg string
+}
+
+func (e *badRequest) Error() string {
+	return e.msg
+}
+
+// Register adds to handler a read-only JSON API exposing the data behind chat commands:
+//   - runs?env=&days=              runs in the last days (history database)
+//   - runs/last?env=               tests which failed in last run, with tracking issue
+//   - results?env=&test=&days=     test results in the last days (history database)
+//   - tests/<name>?runs=           runs where test passed, failed or was skipped, per environment
+//   - reports?env=&type=&days=     reports in the last days (history database)
+//   - usage?env=&pod=&days=        usage reports in the last days (history database)
+//   - issues                       open e2e issues
+//   - alerts?status=               alerts, firing and resolved
+//
+// Requests must have an "Authorization: Bearer <token>" header with the token in
+// E2E_API_TOKEN. If E2E_API_TOKEN is not set, API is not registered.
+func Register(ctx context.Context, handler *http.ServeMux, jiraClient *jira.Client, logger logr.Logger) {
+	token, ok := os.LookupEnv(apiTokenEnv)
+	if !ok || token == "" {
+		logger.Info(fmt.Sprintf("%s not set. API is disabled", apiTokenEnv))
+		return
+	}
+
+	routes := map[string]handlerFunc{
+		"runs":      getRuns,
+		"runs/last": getLastRun,
+		"results":   getResults,
+		"reports":   getReports,
+		"usage":     getUsage,
+		"issues":    getIssues,
+		"alerts":    getAlerts,
+	}
+
+	handler.HandleFunc(apiPath, func(w http.ResponseWriter, r *http.Request) {
+		if !isAuthorized(r, token) {
+			writeJSON(w, http.StatusUnauthorized, &apiError{Error: "missing or invalid token"})
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, &apiError{Error: "API is read-only"})
+			return
+		}
+
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPath), "/")
+		fn, ok := routes[path]
+		if !ok && strings.HasPrefix(path, "tests/") {
+			fn, ok = getTestHistory, true
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, &apiError{Error: fmt.Sprintf("unknown path %s", r.URL.Path)})
+			return
+		}
+
+		result, err := fn(ctx, r, jiraClient, logger)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if _, ok := err.(*badRequest); ok {
+				status = http.StatusBadRequest
+			}
+			writeJSON(w, status, &apiError{Error: err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// isAuthorized returns true if request carries token
+func isAuthorized(r *http.Request, token string) bool {
+	value := r.Header.Get("Authorization")
+	if !strings.HasPrefix(value, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(value, "Bearer ")), []byte(token)) == 1
+}
+
+// writeJSON writes v, in JSON, with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// getEnvironment returns the env query parameter. Empty means both environments.
+func getEnvironment(r *http.Request) (string, error) {
+	env := strings.ToLower(r.URL.Query().Get("env"))
+	if env != "" && env != "ucs" && env != "vcs" {
+		return "", &badRequest{msg: fmt.Sprintf("invalid env %q. Valid ones are ucs and vcs", env)}
+	}
+	return env, nil
+}
+
+// getInt returns the name query parameter, defaultValue if not set
+func getInt(r *http.Request, name string, defaultValue, maxValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || n > maxValue {
+		return 0, &badRequest{msg: fmt.Sprintf("invalid %s %q. It must be between 1 and %d", name, value, maxValue)}
+	}
+	return n, nil
+}
+
+// getRange returns the time range covered by the days query parameter
+func getRange(r *http.Request) (from, to time.Time, err error) {
+	days, err := getInt(r, "days", defaultDays, maxDays)
+	if err != nil {
+		return
+	}
+	to = time.Now()
+	from = to.Add(-time.Duration(days) * 24 * time.Hour)
+	return
+}
+
+// getRuns returns runs from history database
+func getRuns(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	env, err := getEnvironment(r)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := getRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return history.GetRuns(env, from, to, logger)
+}
+
+// getLastRun returns the tests which failed in the last run of env, as "ucs" and "vcs" chat commands do
+func getLastRun(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	env, err := getEnvironment(r)
+	if err != nil {
+		return nil, err
+	}
+	if env == "" {
+		return nil, &badRequest{msg: "env is required"}
+	}
+
+	vcs := env == "vcs"
+	lastRun, failedTests, err := utils.GetLastRunFailures(ctx, vcs, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LastRun{Environment: env, Run: lastRun, Link: utils.GetRunLink(vcs, lastRun), Failed: make([]FailedTest, 0)}
+	issues, err := utils.GetIssuesForTests(ctx, jiraClient, failedTests, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to correlate failed tests with jira issues. Err: %v", err))
+	}
+	for i := range failedTests {
+		test := FailedTest{Name: failedTests[i]}
+		if issue, ok := issues[failedTests[i]]; ok {
+			test.Issue = issue.Key
+		}
+		result.Failed = append(result.Failed, test)
+	}
+
+	return result, nil
+}
+
+// getResults returns test results from history database
+func getResults(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	env, err := getEnvironment(r)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := getRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return history.GetResults(env, r.URL.Query().Get("test"), from, to, logger)
+}
+
+// getTestHistory returns, per environment, the runs where a test passed, failed or was skipped,
+// as asking the bot about a test does
+func getTestHistory(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	testName := strings.TrimPrefix(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPath), "/"), "tests/")
+	if testName == "" || strings.Contains(testName, "/") {
+		return nil, &badRequest{msg: "invalid test name"}
+	}
+	runs, err := getInt(r, "runs", defaultTestRuns, maxTestRuns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*utils.TestHistory, 0)
+	for _, vcs := range []bool{true, false} {
+		h, err := utils.GetTestHistory(ctx, testName, vcs, runs, logger)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, h)
+	}
+
+	return result, nil
+}
+
+// getReports returns reports from history database
+func getReports(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	env, err := getEnvironment(r)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := getRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return history.GetReports(env, r.URL.Query().Get("type"), from, to, logger)
+}
+
+// getUsage returns usage reports from history database
+func getUsage(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	env, err := getEnvironment(r)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := getRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return history.GetUsageReports(env, r.URL.Query().Get("pod"), from, to, logger)
+}
+
+// getIssues returns open e2e issues, as "issues" chat command does
+func getIssues(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	issues, err := utils.GetOpenIssues(ctx, jiraClient, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Issue, 0, len(issues))
+	for i := range issues {
+		if issues[i].Fields == nil {
+			continue
+		}
+		issue := Issue{
+			Key:     issues[i].Key,
+			Link:    utils.GetIssueURL(issues[i].Key),
+			Summary: issues[i].Fields.Summary,
+			Created: time.Time(issues[i].Fields.Created),
+		}
+		if issues[i].Fields.Status != nil {
+			issue.Status = issues[i].Fields.Status.Name
+		}
+		if issues[i].Fields.Assignee != nil {
+			issue.Assignee = issues[i].Fields.Assignee.Name
+		}
+		result = append(result, issue)
+	}
+
+	return result, nil
+}
+
+// getAlerts returns alerts, optionally only the ones with requested status
+func getAlerts(ctx context.Context, r *http.Request, jiraClient *jira.Client, logger logr.Logger) (interface{}, error) {
+	status := alerts.Status(strings.ToLower(r.URL.Query().Get("status")))
+	if status != "" && status != alerts.Firing && status != alerts.Resolved {
+		return nil, &badRequest{msg: fmt.Sprintf("invalid status %q. Valid ones are %s and %s", status, alerts.Firing, alerts.Resolved)}
+	}
+
+	all, err := alerts.GetAll(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]alerts.Alert, 0, len(all))
+	for i := range all {
+		if status == "" || all[i].Status == status {
+			result = append(result, all[i])
+		}
+	}
+
+	return result, nil
+}
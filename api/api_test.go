@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+const testToken = "secret"
+
+func TestAuthorization(t *testing.T) {
+	t.Setenv(apiTokenEnv, testToken)
+
+	handler := http.NewServeMux()
+	Register(context.TODO(), handler, nil, logr.Discard())
+
+	tests := []struct {
+		name           string
+		method         string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "no token", method: http.MethodGet, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, authorization: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "token without Bearer", method: http.MethodGet, authorization: testToken,
+			expectedStatus: http.StatusUnauthorized},
+		{name: "valid token", method: http.MethodGet, authorization: "Bearer " + testToken,
+			expectedStatus: http.StatusNotFound},
+		{name: "write request", method: http.MethodPost, authorization: "Bearer " + testToken,
+			expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, apiPath+"unknown", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, expected %d", w.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestDisabledWithoutToken(t *testing.T) {
+	t.Setenv(apiTokenEnv, "")
+
+	handler := http.NewServeMux()
+	Register(context.TODO(), handler, nil, logr.Discard())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPath+"runs", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetInt(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		expected    int
+		expectedErr bool
+	}{
+		{name: "default", query: "", expected: 7},
+		{name: "value", query: "?days=30", expected: 30},
+		{name: "max value", query: "?days=90", expected: 90},
+		{name: "too big", query: "?days=91", expectedErr: true},
+		{name: "zero", query: "?days=0", expectedErr: true},
+		{name: "negative", query: "?days=-1", expectedErr: true},
+		{name: "not a number", query: "?days=week", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, apiPath+"runs"+tt.query, nil)
+			got, err := getInt(r, "days", 7, 90)
+			if tt.expectedErr {
+				if _, ok := err.(*badRequest); !ok {
+					t.Errorf("expected bad request, got %d, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
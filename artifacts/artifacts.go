@@ -0,0 +1,143 @@
+package artifacts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// artifactsDirEnv is the env variable containing the directory where workspaces are created
+	artifactsDirEnv     = "E2E_ARTIFACTS_DIR"
+	defaultArtifactsDir = "/tmp/artifacts"
+
+	// Workspaces older than this are removed by garbage collection. Workspaces are
+	// normally removed as soon as files are sent. This only catches the ones left
+	// behind (bot restarted, job panicked, etc.)
+	maxWorkspaceAge = 2 * time.Hour
+
+	// Maximum length of a sanitized file name (extension excluded)
+	maxNameLength = 100
+)
+
+// unsafeChars matches any character not allowed in a file name
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Workspace is a temporary directory holding files generated while serving a single
+// request or running a single job. Requests served concurrently never share a workspace,
+// so generated files cannot overwrite each other.
+type Workspace struct {
+	dir string
+
+	// names contains the file names already handed out
+	names map[string]bool
+	mux   sync.Mutex
+}
+
+// getBaseDir returns the directory where workspaces are created
+func getBaseDir() string {
+	if v, ok := os.LookupEnv(artifactsDirEnv); ok && v != "" {
+		return v
+	}
+	return defaultArtifactsDir
+}
+
+// New creates a new workspace. purpose is only used to make the workspace
+// directory name recognizable.
+func New(purpose string, logger logr.Logger) (*Workspace, error) {
+	baseDir := getBaseDir()
+	if err := os.MkdirAll(baseDir, 0700); err != nil {
+		logger.Info(fmt.Sprintf("Failed to create directory %s. Err: %v", baseDir, err))
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(baseDir, SanitizeName(purpose)+"-")
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to create workspace for %s. Err: %v", purpose, err))
+		return nil, err
+	}
+
+	return &Workspace{dir: dir, names: make(map[string]bool)}, nil
+}
+
+// Dir returns the workspace directory
+func (w *Workspace) Dir() string {
+	return w.dir
+}
+
+// Path returns the path, within the workspace, of a new file named name.
+// name is sanitized so that it is always a valid file name in the workspace.
+// If name was already handed out, a numeric suffix is added so that a file
+// is never overwritten.
+func (w *Workspace) Path(name string) string {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	name = SanitizeName(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; w.names[name]; i++ {
+		name = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	w.names[name] = true
+
+	return filepath.Join(w.dir, name)
+}
+
+// Remove deletes the workspace along with all files in it
+func (w *Workspace) Remove(logger logr.Logger) {
+	if err := os.RemoveAll(w.dir); err != nil {
+		logger.Info(fmt.Sprintf("Failed to remove workspace %s. Err: %v", w.dir, err))
+	}
+}
+
+// SanitizeName returns name with any character not allowed in a file name (path
+// separators included) replaced by '_'. Extension, if any, is preserved.
+func SanitizeName(name string) string {
+	ext := filepath.Ext(name)
+	if ext == "." || len(ext) > 10 || unsafeChars.MatchString(ext) {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	base = strings.Trim(unsafeChars.ReplaceAllString(base, "_"), "._")
+	if len(base) > maxNameLength {
+		base = base[:maxNameLength]
+	}
+	if base == "" {
+		base = "artifact"
+	}
+
+	return base + ext
+}
+
+// RemoveStaleWorkspaces removes workspaces older than maxWorkspaceAge
+func RemoveStaleWorkspaces(logger logr.Logger) {
+	baseDir := getBaseDir()
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Info(fmt.Sprintf("Failed to read directory %s. Err: %v", baseDir, err))
+		}
+		return
+	}
+
+	for i := range entries {
+		info, err := entries[i].Info()
+		if err != nil || time.Since(info.ModTime()) < maxWorkspaceAge {
+			continue
+		}
+
+		dir := filepath.Join(baseDir, entries[i].Name())
+		logger.Info(fmt.Sprintf("Removing stale workspace %s", dir))
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Info(fmt.Sprintf("Failed to remove workspace %s. Err: %v", dir, err))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "plot.png", expected: "plot.png"},
+		{name: "kube-system:coredns.png", expected: "kube-system_coredns.png"},
+		{name: "../../etc/passwd", expected: "etc_passwd"},
+		{name: "a/b\\c d.csv", expected: "a_b_c_d.csv"},
+		{name: "report.tar.gz", expected: "report.tar.gz"},
+		{name: "name.with spaces", expected: "name.with_spaces"},
+		{name: "...", expected: "artifact"},
+		{name: ".png", expected: "artifact.png"},
+		{name: strings.Repeat("x", 2*maxNameLength) + ".pdf", expected: strings.Repeat("x", maxNameLength) + ".pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeName(tt.name); got != tt.expected {
+				t.Errorf("SanitizeName(%q) = %q, expected %q", tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWorkspacePath(t *testing.T) {
+	t.Setenv(artifactsDirEnv, t.TempDir())
+
+	ws, err := New("test/purpose", logr.Discard())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ws.Remove(logr.Discard())
+
+	if filepath.Dir(ws.Dir()) != getBaseDir() {
+		t.Errorf("workspace %s not in %s", ws.Dir(), getBaseDir())
+	}
+
+	expected := []string{"plot.png", "plot_2.png", "plot_3.png"}
+	for i := range expected {
+		path := ws.Path("plot.png")
+		if filepath.Dir(path) != ws.Dir() || filepath.Base(path) != expected[i] {
+			t.Errorf("Path returned %s, expected %s", path, filepath.Join(ws.Dir(), expected[i]))
+		}
+	}
+
+	if path := ws.Path("../escape.png"); filepath.Dir(path) != ws.Dir() {
+		t.Errorf("Path returned %s outside workspace %s", path, ws.Dir())
+	}
+
+	ws.Remove(logr.Discard())
+	if _, err := os.Stat(ws.Dir()); !os.IsNotExist(err) {
+		t.Errorf("workspace %s not removed", ws.Dir())
+	}
+}
+
+func TestRemoveStaleWorkspaces(t *testing.T) {
+	t.Setenv(artifactsDirEnv, t.TempDir())
+
+	stale, err := New("stale", logr.Discard())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old := time.Now().Add(-2 * maxWorkspaceAge)
+	if err := os.Chtimes(stale.Dir(), old, old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recent, err := New("recent", logr.Discard())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	RemoveStaleWorkspaces(logr.Discard())
+
+	if _, err := os.Stat(stale.Dir()); !os.IsNotExist(err) {
+		t.Errorf("stale workspace %s not removed", stale.Dir())
+	}
+	if _, err := os.Stat(recent.Dir()); err != nil {
+		t.Errorf("recent workspace %s removed", recent.Dir())
+	}
+}
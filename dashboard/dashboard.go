@@ -0,0 +1,205 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/summary"
+)
+
+const (
+	// A page is served from cache till it is older than this. Collecting a section
+	// queries history database, jira and creates plots, so it is not done on every request.
+	cacheDuration = 10 * time.Minute
+
+	sectionPath = "/section/"
+)
+
+// page is a rendered dashboard page
+type page struct {
+	content []byte
+	created time.Time
+}
+
+// templateData is what pageTemplate is executed with
+type templateData struct {
+	Sections  []string
+	Current   string
+	Section   *summary.Section
+	Images    []template.URL
+	Generated string
+}
+
+var (
+	// cache contains rendered pages. Key is section name.
+	cache = make(map[string]*page)
+
+	// sectionMux contains, per section, the lock serializing generation of that section page.
+	// Concurrent requests for a section generate it once, while different sections are
+	// generated in parallel.
+	sectionMux = make(map[string]*sync.Mutex)
+
+	// mux protects cache and sectionMux
+	mux sync.Mutex
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>E2E dashboard - {{.Section.Title}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 0; color: #222; }
+nav { background: #1f3b57; padding: 10px 20px; }
+nav a { color: #dbe7f3; margin-right: 18px; text-decoration: none; }
+nav a.current { color: #fff; font-weight: bold; }
+main { padding: 10px 20px; }
+table { border-collapse: collapse; margin-bottom: 20px; font-size: 14px; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 10px; text-align: left; }
+th { background: #f2f5f8; }
+img { width: 480px; margin: 5px; }
+footer { color: #888; font-size: 12px; padding: 10px 20px; }
+</style>
+</head>
+<body>
+<nav>{{range .Sections}}<a href="/section/{{.}}"{{if eq . $.Current}} class="current"{{end}}>{{.}}</a>{{end}}</nav>
+<main>
+<h1>{{.Section.Title}}</h1>
+{{range .Section.Text}}<p>{{.}}</p>
+{{end}}
+{{range .Section.Tables}}<h3>{{.Title}}</h3>
+{{if .Rows}}<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{else}}<p><i>No data</i></p>
+{{end}}{{end}}
+{{range .Images}}<img src="{{.}}">{{end}}
+</main>
+<footer>Prepared for you by cloudstack e2e assistant. Generated {{.Generated}}.</footer>
+</body>
+</html>
+`))
+
+// Register adds to handler a read-only dashboard with a page per summary section
+func Register(ctx context.Context, handler *http.ServeMux, jiraClient *jira.Client, logger logr.Logger) {
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, sectionPath+summary.SectionOverview, http.StatusFound)
+	})
+	handler.HandleFunc(sectionPath, func(w http.ResponseWriter, r *http.Request) {
+		serveSection(ctx, w, r, jiraClient, logger)
+	})
+}
+
+// serveSection writes the page for the section in the request path
+func serveSection(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	jiraClient *jira.Client, logger logr.Logger) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "dashboard is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, sectionPath)
+	sections, err := summary.ParseSections([]string{name})
+	if err != nil || len(sections) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := getPage(ctx, sections[0], jiraClient, logger)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate page. Err: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(content)
+}
+
+// getPage returns the page for section, from cache if recent enough
+func getPage(ctx context.Context, name string, jiraClient *jira.Client, logger logr.Logger) ([]byte, error) {
+	sectionLock := getSectionLock(name)
+	sectionLock.Lock()
+	defer sectionLock.Unlock()
+
+	if p := getCachedPage(name); p != nil {
+		return p.content, nil
+	}
+
+	ws, err := artifacts.New("dashboard", logger)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Remove(logger)
+
+	sections := summary.Collect(ctx, ws, jiraClient, []string{name}, logger)
+
+	data := templateData{
+		Sections:  summary.GetSections(),
+		Current:   name,
+		Section:   sections[0],
+		Generated: time.Now().Format("Jan 02 15:04 MST"),
+	}
+
+	// Plots are inlined so that page does not depend on files in ws
+	for i := range sections[0].Images {
+		image, err := os.ReadFile(sections[0].Images[i])
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to read plot %s. Err: %v", sections[0].Images[i], err))
+			continue
+		}
+		data.Images = append(data.Images,
+			template.URL("data:image/png;base64,"+base64.StdEncoding.EncodeToString(image)))
+	}
+
+	var buf strings.Builder
+	if err := pageTemplate.Execute(&buf, data); err != nil {
+		logger.Info(fmt.Sprintf("Failed to render dashboard page %s. Err: %v", name, err))
+		return nil, err
+	}
+
+	p := &page{content: []byte(buf.String()), created: time.Now()}
+	mux.Lock()
+	cache[name] = p
+	mux.Unlock()
+
+	return p.content, nil
+}
+
+// getSectionLock returns the lock serializing generation of section name page
+func getSectionLock(name string) *sync.Mutex {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if _, ok := sectionMux[name]; !ok {
+		sectionMux[name] = &sync.Mutex{}
+	}
+	return sectionMux[name]
+}
+
+// getCachedPage returns section name page if cached and recent enough, nil otherwise
+func getCachedPage(name string) *page {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if p, ok := cache[name]; ok && time.Since(p.created) < cacheDuration {
+		return p
+	}
+	return nil
+}
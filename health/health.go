@@ -0,0 +1,200 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+
+	"github.com/gianlucam76/webex_bot/metrics"
+)
+
+const (
+	// Webex, Jira and elastic DB connectivity is checked this often
+	checkInterval = 30 * time.Second
+	checkTimeout  = 10 * time.Second
+
+	// Liveness fails if dependencies have not been checked for this long
+	maxCheckAge = 5 * time.Minute
+
+	// Liveness fails if polling Webex for messages keeps failing for this long
+	maxPollFailure = 5 * time.Minute
+)
+
+// check verifies connectivity to a dependency
+type check struct {
+	dependency string
+	run        func(ctx context.Context) error
+}
+
+var (
+	// results contains, per dependency, the error returned by last check
+	results = make(map[string]error)
+
+	// lastChecked is when dependencies were last checked
+	lastChecked time.Time
+
+	// pollFailingSince is when polling Webex for messages started failing.
+	// Zero if last poll succeeded.
+	pollFailingSince time.Time
+
+	// mux serializes access to results, lastChecked and pollFailingSince
+	mux sync.Mutex
+)
+
+// Register adds to handler:
+//   - /healthz, liveness. Fails if polling Webex for messages keeps failing or if
+//     dependencies are not checked anymore. A Webex, Jira or elastic DB outage alone
+//     does not fail it, as restarting the bot would not help;
+//   - /readyz, readiness. Fails if Webex, Jira or elastic DB is not reachable.
+//
+// Connectivity is checked, in the background, till ctx is done.
+func Register(ctx context.Context, handler *http.ServeMux, webexClient *webexteams.Client,
+	jiraClient *jira.Client, logger logr.Logger) {
+	checks := []check{
+		{dependency: metrics.Webex, run: func(ctx context.Context) error {
+			return withDeadline(ctx, func() error {
+				_, _, err := webexClient.People.GetMe()
+				return err
+			})
+		}},
+		{dependency: metrics.Jira, run: func(ctx context.Context) error {
+			_, _, err := jiraClient.User.GetSelfWithContext(ctx)
+			return err
+		}},
+		{dependency: metrics.Elastic, run: func(ctx context.Context) error {
+			_, err := es_utils.GetAvailableRuns(ctx, "ucs", 1, logger.V(10))
+			return err
+		}},
+	}
+
+	mux.Lock()
+	lastChecked = time.Now()
+	for i := range checks {
+		results[checks[i].dependency] = fmt.Errorf("not checked yet")
+	}
+	mux.Unlock()
+
+	go func() {
+		for {
+			runChecks(ctx, checks, logger)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(checkInterval):
+			}
+		}
+	}()
+
+	handler.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, isAlive())
+	})
+	handler.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, isReady())
+	})
+}
+
+// withDeadline runs fn, which does not accept a context, returning its error or,
+// if ctx is done first, ctx error. fn is left to complete in the background.
+func withDeadline(ctx context.Context, fn func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- fn()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PollResult records the outcome of polling Webex for messages
+func PollResult(err error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if err == nil {
+		pollFailingSince = time.Time{}
+	} else if pollFailingSince.IsZero() {
+		pollFailingSince = time.Now()
+	}
+}
+
+// runChecks checks connectivity to all dependencies
+func runChecks(ctx context.Context, checks []check, logger logr.Logger) {
+	for i := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := checks[i].run(checkCtx)
+		cancel()
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to reach %s. Err: %v", checks[i].dependency, err))
+			metrics.DependencyError(checks[i].dependency)
+		}
+
+		mux.Lock()
+		results[checks[i].dependency] = err
+		mux.Unlock()
+	}
+
+	mux.Lock()
+	lastChecked = time.Now()
+	mux.Unlock()
+}
+
+func isAlive() bool {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if time.Since(lastChecked) > maxCheckAge {
+		return false
+	}
+	return pollFailingSince.IsZero() || time.Since(pollFailingSince) < maxPollFailure
+}
+
+func isReady() bool {
+	mux.Lock()
+	defer mux.Unlock()
+
+	for _, err := range results {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// writeStatus writes, with status code depending on ok, the state of every dependency
+func writeStatus(w http.ResponseWriter, ok bool) {
+	mux.Lock()
+	lines := make([]string, 0)
+	for _, dependency := range []string{metrics.Webex, metrics.Jira, metrics.Elastic} {
+		if err := results[dependency]; err != nil {
+			lines = append(lines, fmt.Sprintf("%s: failed (%v)", dependency, err))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: ok", dependency))
+		}
+	}
+	if !pollFailingSince.IsZero() {
+		lines = append(lines, fmt.Sprintf("message polling: failing since %s", pollFailingSince.Format(time.RFC3339)))
+	}
+	mux.Unlock()
+
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithDeadline(t *testing.T) {
+	expected := errors.New("unreachable")
+	if err := withDeadline(context.TODO(), func() error { return expected }); err != expected {
+		t.Errorf("got %v, expected %v", err, expected)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	err := withDeadline(ctx, func() error { <-release; return nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s, expected right after deadline", elapsed)
+	}
+}
@@ -0,0 +1,527 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	bolt "go.etcd.io/bbolt"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+
+	"github.com/gianlucam76/webex_bot/scheduler"
+	"github.com/gianlucam76/webex_bot/state"
+)
+
+const (
+	// historyDBEnv is the env variable containing the path of the history database
+	historyDBEnv  = "E2E_HISTORY_DB"
+	historyDBFile = "history.db"
+
+	// Maximum number of results, reports and usage reports fetched per run
+	maxPerRun = 1000
+
+	// Number of most recent runs, per environment, considered when backfilling
+	backfilledRuns = 100
+
+	// A run is considered finished when it had no activity for this long
+	runFinishedAfter = 3 * time.Hour
+
+	// keyTimeLayout is the layout of times in keys. Keys sort by time.
+	keyTimeLayout = "20060102T150405.000000000"
+
+	// openTimeout is how long opening the database waits for the lock. A previous
+	// leader might still be closing it.
+	openTimeout = 30 * time.Second
+)
+
+var (
+	// errRunNotFinished is returned when backfilling a run which is still in progress
+	errRunNotFinished = errors.New("run not finished")
+
+	// errNotOpen is returned when database is used outside of Open and Close
+	errNotOpen = errors.New("history database is not open")
+)
+
+// Buckets of the history database. Keys in all buckets start with <environment>/<run>/
+// with run zero padded so that keys are sorted by run.
+var (
+	runsBucket    = []byte("runs")
+	resultsBucket = []byte("results")
+	reportsBucket = []byte("reports")
+	usageBucket   = []byte("usage")
+)
+
+// Run contains the aggregated results of a run
+type Run struct {
+	Environment string    `json:"environment"`
+	Run         int64     `json:"run"`
+	StartTime   time.Time `json:"startTime"`
+	Passed      int       `json:"passed"`
+	Failed      int       `json:"failed"`
+	Skipped     int       `json:"skipped"`
+	// DurationInMinutes is the time from first test start to last test end
+	DurationInMinutes float64 `json:"durationInMinutes"`
+	// IngestedTime is when run was stored
+	IngestedTime time.Time `json:"ingestedTime"`
+}
+
+var (
+	// db is the history database. It is opened on first use after Open.
+	db *bolt.DB
+
+	// enabled is set between Open and Close
+	enabled bool
+
+	// mux serializes opening and closing db
+	mux sync.Mutex
+)
+
+// Open makes the history database available till Close is called.
+// Database is a single writer one: only the leader opens it. Failing to open it is
+// logged and retried on next use.
+func Open(logger logr.Logger) {
+	mux.Lock()
+	enabled = true
+	mux.Unlock()
+
+	_, _ = getDB(logger)
+}
+
+// getDB returns the history database, opening it if needed.
+// Database is in the file pointed by E2E_HISTORY_DB (default history.db in the state directory).
+func getDB(logger logr.Logger) (*bolt.DB, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if db != nil {
+		return db, nil
+	}
+
+	if !enabled {
+		return nil, errNotOpen
+	}
+
+	fileName := state.GetPath(historyDBFile)
+	if v, ok := os.LookupEnv(historyDBEnv); ok && v != "" {
+		fileName = v
+	}
+
+	tmpDB, err := bolt.Open(fileName, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to open history database %s. Err: %v", fileName, err))
+		return nil, err
+	}
+
+	err = tmpDB.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{runsBucket, resultsBucket, reportsBucket, usageBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to create history buckets. Err: %v", err))
+		tmpDB.Close()
+		return nil, err
+	}
+
+	db = tmpDB
+	return db, nil
+}
+
+// Close closes the history database. It is not available anymore till Open is called.
+func Close() error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	enabled = false
+	if db == nil {
+		return nil
+	}
+
+	err := db.Close()
+	db = nil
+	return err
+}
+
+// getEnvironment returns the environment name
+func getEnvironment(vcs bool) string {
+	if vcs {
+		return "vcs"
+	}
+	return "ucs"
+}
+
+// getRunPrefix returns the prefix of all keys for a run
+func getRunPrefix(env string, run int64) string {
+	return fmt.Sprintf("%s/%012d/", env, run)
+}
+
+// IsIngested returns true if run is already in the history database
+func IsIngested(vcs bool, run int64, logger logr.Logger) (bool, error) {
+	d, err := getDB(logger)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	err = d.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(runsBucket).Get([]byte(getRunPrefix(getEnvironment(vcs), run))) != nil
+		return nil
+	})
+	return found, err
+}
+
+// IngestRun fetches from elastic DB results, reports and usage reports of a run and
+// stores them in the history database. Data previously stored for run is replaced.
+// Run must be finished.
+func IngestRun(ctx context.Context, vcs bool, run int64, logger logr.Logger) error {
+	return ingestRun(ctx, vcs, run, false, logger)
+}
+
+// ingestRun ingests a run. If checkFinished is set, run is ingested only if it
+// had no activity (test ending, report or usage report) in the last runFinishedAfter.
+// Otherwise errRunNotFinished is returned.
+func ingestRun(ctx context.Context, vcs bool, run int64, checkFinished bool, logger logr.Logger) error {
+	d, err := getDB(logger)
+	if err != nil {
+		return err
+	}
+
+	env := getEnvironment(vcs)
+	prefix := getRunPrefix(env, run)
+
+	searchResult, err := es_utils.GetResults(ctx, logger, fmt.Sprintf("%d", run), "",
+		vcs, !vcs, false, false, false, maxPerRun)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get results for run %d. Err: %v", run, err))
+		return err
+	}
+	results := make([]es_utils.Result, 0)
+	var rtyp es_utils.Result
+	for _, item := range searchResult.Each(reflect.TypeOf(rtyp)) {
+		results = append(results, item.(es_utils.Result))
+	}
+
+	searchResult, err = es_utils.GetReports(ctx, logger, fmt.Sprintf("%d", run), "", "", "",
+		vcs, !vcs, maxPerRun)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get reports for run %d. Err: %v", run, err))
+		return err
+	}
+	reports := make([]es_utils.Report, 0)
+	var reportTyp es_utils.Report
+	for _, item := range searchResult.Each(reflect.TypeOf(reportTyp)) {
+		reports = append(reports, item.(es_utils.Report))
+	}
+
+	searchResult, err = es_utils.GetUsageReports(ctx, logger, fmt.Sprintf("%d", run), "",
+		vcs, !vcs, maxPerRun)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get usage reports for run %d. Err: %v", run, err))
+		return err
+	}
+	usageReports := make([]es_utils.UsageReport, 0)
+	var usageTyp es_utils.UsageReport
+	for _, item := range searchResult.Each(reflect.TypeOf(usageTyp)) {
+		usageReports = append(usageReports, item.(es_utils.UsageReport))
+	}
+
+	r, lastActivity := getRun(env, run, results, reports, usageReports)
+	if checkFinished && (lastActivity.IsZero() || time.Since(lastActivity) < runFinishedAfter) {
+		return errRunNotFinished
+	}
+
+	logger.Info(fmt.Sprintf("Ingesting %s run %d in history database", env, run))
+	return d.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{resultsBucket, reportsBucket, usageBucket} {
+			if err := deletePrefix(tx.Bucket(b), prefix); err != nil {
+				return err
+			}
+		}
+
+		// A test can be run more than once (retries). Start time and position
+		// keep every attempt.
+		for i := range results {
+			key := fmt.Sprintf("%s%s/%s/%06d", prefix, results[i].Name,
+				results[i].StartTime.UTC().Format(keyTimeLayout), i)
+			if err := put(tx.Bucket(resultsBucket), key, results[i]); err != nil {
+				return err
+			}
+		}
+
+		for i := range reports {
+			key := fmt.Sprintf("%s%s/%s/%s/%06d", prefix, reports[i].Type, reports[i].SubType, reports[i].Name, i)
+			if err := put(tx.Bucket(reportsBucket), key, reports[i]); err != nil {
+				return err
+			}
+		}
+
+		for i := range usageReports {
+			key := fmt.Sprintf("%s%s/%06d", prefix, usageReports[i].Name, i)
+			if err := put(tx.Bucket(usageBucket), key, usageReports[i]); err != nil {
+				return err
+			}
+		}
+
+		return put(tx.Bucket(runsBucket), prefix, r)
+	})
+}
+
+// getRun aggregates results of a run. Run start time is the start time of the first
+// test. If no test has a start time, the time of the first report (or usage report)
+// is used. Returns also the time of the last activity seen in the run.
+func getRun(env string, run int64, results []es_utils.Result, reports []es_utils.Report,
+	usageReports []es_utils.UsageReport) (*Run, time.Time) {
+	r := &Run{Environment: env, Run: run, IngestedTime: time.Now()}
+	var end time.Time
+
+	for i := range results {
+		switch results[i].Result {
+		case "passed":
+			r.Passed++
+		case "failed":
+			r.Failed++
+		case "skipped":
+			r.Skipped++
+		}
+		if !results[i].StartTime.IsZero() {
+			if r.StartTime.IsZero() || results[i].StartTime.Before(r.StartTime) {
+				r.StartTime = results[i].StartTime
+			}
+			testEnd := results[i].StartTime.Add(time.Duration(results[i].DurationInMinutes * float64(time.Minute)))
+			if testEnd.After(end) {
+				end = testEnd
+			}
+		}
+	}
+	if !r.StartTime.IsZero() {
+		r.DurationInMinutes = end.Sub(r.StartTime).Minutes()
+	}
+
+	lastActivity := end
+	var firstReport time.Time
+	reportTimes := make([]time.Time, 0, len(reports)+len(usageReports))
+	for i := range reports {
+		reportTimes = append(reportTimes, reports[i].CreatedTime)
+	}
+	for i := range usageReports {
+		reportTimes = append(reportTimes, usageReports[i].CreatedTime)
+	}
+	for i := range reportTimes {
+		if reportTimes[i].IsZero() {
+			continue
+		}
+		if firstReport.IsZero() || reportTimes[i].Before(firstReport) {
+			firstReport = reportTimes[i]
+		}
+		if reportTimes[i].After(lastActivity) {
+			lastActivity = reportTimes[i]
+		}
+	}
+
+	// Runs with no start time would never be returned by GetRuns
+	if r.StartTime.IsZero() {
+		r.StartTime = firstReport
+	}
+
+	return r, lastActivity
+}
+
+// Backfill ingests, right away and then daily, finished runs available in elastic DB
+// which are not in the history database yet.
+func Backfill(ctx context.Context, logger logr.Logger) {
+	go backfillRuns(ctx, backfilledRuns, logger)
+	_ = scheduler.Register(scheduler.Job{
+		Name:        "history-backfill",
+		Description: "finished runs in elastic DB not in the history database yet",
+		Schedule:    "0 3 * * *",
+		Run:         func() { backfillRuns(ctx, backfilledRuns, logger) },
+	}, logger)
+}
+
+// backfillRuns ingests, for both environments, the last finished runs available in elastic
+// DB which are not in the history database yet. runs is the number of most
+// recent runs, per environment, considered.
+func backfillRuns(ctx context.Context, runs int, logger logr.Logger) {
+	for _, vcs := range []bool{false, true} {
+		env := getEnvironment(vcs)
+		b, err := es_utils.GetAvailableRuns(ctx, env, runs, logger)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to get available %s runs from elastic DB. Err: %v", env, err))
+			continue
+		}
+
+		for _, bucket := range b.Buckets {
+			run, err := bucket.KeyNumber.Int64()
+			if err != nil {
+				continue
+			}
+
+			if ingested, err := IsIngested(vcs, run, logger); err != nil || ingested {
+				continue
+			}
+
+			if err := ingestRun(ctx, vcs, run, true, logger); err != nil {
+				if errors.Is(err, errRunNotFinished) {
+					logger.Info(fmt.Sprintf("%s run %d is not finished yet. Skip it", env, run))
+					continue
+				}
+				logger.Info(fmt.Sprintf("Failed to ingest %s run %d. Err: %v", env, run, err))
+			}
+		}
+	}
+}
+
+// GetRuns returns runs, in env, started between from and to, sorted by run.
+// If env is empty, runs from both environments are returned.
+func GetRuns(env string, from, to time.Time, logger logr.Logger) ([]Run, error) {
+	d, err := getDB(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]Run, 0)
+	err = d.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).ForEach(func(k, v []byte) error {
+			if env != "" && !strings.HasPrefix(string(k), env+"/") {
+				return nil
+			}
+			var r Run
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if r.StartTime.Before(from) || r.StartTime.After(to) {
+				return nil
+			}
+			runs = append(runs, r)
+			return nil
+		})
+	})
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read runs from history database. Err: %v", err))
+		return nil, err
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartTime.Before(runs[j].StartTime) })
+	return runs, nil
+}
+
+// GetResults returns test results, in env, for runs started between from and to.
+// If testName is not empty, only results for that test are returned.
+func GetResults(env, testName string, from, to time.Time, logger logr.Logger) ([]es_utils.Result, error) {
+	results := make([]es_utils.Result, 0)
+	err := forEachInRuns(resultsBucket, env, from, to, logger, func(k, v []byte) error {
+		var r es_utils.Result
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if testName == "" || r.Name == testName {
+			results = append(results, r)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// GetReports returns reports, in env, for runs started between from and to.
+// If reportType is not empty, only reports of that type are returned.
+func GetReports(env, reportType string, from, to time.Time, logger logr.Logger) ([]es_utils.Report, error) {
+	reports := make([]es_utils.Report, 0)
+	err := forEachInRuns(reportsBucket, env, from, to, logger, func(k, v []byte) error {
+		var r es_utils.Report
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if reportType == "" || r.Type == reportType {
+			reports = append(reports, r)
+		}
+		return nil
+	})
+	return reports, err
+}
+
+// GetUsageReports returns usage reports, in env, for runs started between from and to.
+// If pod is not empty, only usage reports for pods starting with pod are returned.
+func GetUsageReports(env, pod string, from, to time.Time, logger logr.Logger) ([]es_utils.UsageReport, error) {
+	reports := make([]es_utils.UsageReport, 0)
+	err := forEachInRuns(usageBucket, env, from, to, logger, func(k, v []byte) error {
+		var r es_utils.UsageReport
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if pod == "" || strings.HasPrefix(r.Name, pod) {
+			reports = append(reports, r)
+		}
+		return nil
+	})
+	return reports, err
+}
+
+// forEachInRuns invokes fn for every entry in bucket belonging to runs, in env, started
+// between from and to. Entries are visited sorted by run.
+func forEachInRuns(bucket []byte, env string, from, to time.Time, logger logr.Logger,
+	fn func(k, v []byte) error) error {
+	runs, err := GetRuns(env, from, to, logger)
+	if err != nil {
+		return err
+	}
+
+	d, err := getDB(logger)
+	if err != nil {
+		return err
+	}
+
+	err = d.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for i := range runs {
+			prefix := []byte(getRunPrefix(runs[i].Environment, runs[i].Run))
+			for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+				if err := fn(k, v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read %s from history database. Err: %v", string(bucket), err))
+	}
+
+	return err
+}
+
+// put stores value, in JSON, with key
+func put(b *bolt.Bucket, key string, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), content)
+}
+
+// deletePrefix removes all keys starting with prefix
+func deletePrefix(b *bolt.Bucket, prefix string) error {
+	keys := make([][]byte, 0)
+	c := b.Cursor()
+	for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+
+	for i := range keys {
+		if err := b.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
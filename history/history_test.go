@@ -0,0 +1,61 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+)
+
+func TestGetRun(t *testing.T) {
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                 string
+		results              []es_utils.Result
+		reports              []es_utils.Report
+		usageReports         []es_utils.UsageReport
+		expected             Run
+		expectedLastActivity time.Time
+	}{
+		{
+			name: "retried test",
+			results: []es_utils.Result{
+				{Name: "t1", Result: "failed", StartTime: start, DurationInMinutes: 10},
+				{Name: "t1", Result: "passed", StartTime: start.Add(20 * time.Minute), DurationInMinutes: 10},
+				{Name: "t2", Result: "skipped"},
+			},
+			reports:              []es_utils.Report{{CreatedTime: start.Add(time.Hour)}},
+			expected:             Run{StartTime: start, Passed: 1, Failed: 1, Skipped: 1, DurationInMinutes: 30},
+			expectedLastActivity: start.Add(time.Hour),
+		},
+		{
+			name:    "no test start time",
+			results: []es_utils.Result{{Name: "t1", Result: "passed"}},
+			reports: []es_utils.Report{{CreatedTime: start.Add(time.Hour)}, {}},
+			usageReports: []es_utils.UsageReport{
+				{CreatedTime: start.Add(2 * time.Hour)}, {CreatedTime: start.Add(30 * time.Minute)},
+			},
+			expected:             Run{StartTime: start.Add(30 * time.Minute), Passed: 1},
+			expectedLastActivity: start.Add(2 * time.Hour),
+		},
+		{
+			name:     "no data",
+			expected: Run{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, lastActivity := getRun("ucs", 1, tt.results, tt.reports, tt.usageReports)
+			if !r.StartTime.Equal(tt.expected.StartTime) || r.Passed != tt.expected.Passed ||
+				r.Failed != tt.expected.Failed || r.Skipped != tt.expected.Skipped ||
+				r.DurationInMinutes != tt.expected.DurationInMinutes {
+				t.Errorf("getRun() = %+v, expected %+v", *r, tt.expected)
+			}
+			if !lastActivity.Equal(tt.expectedLastActivity) {
+				t.Errorf("last activity %v, expected %v", lastActivity, tt.expectedLastActivity)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// Name of the Lease object replicas compete for
+	leaseName = "webex-bot"
+
+	// podNameEnv and podNamespaceEnv are set, through downward API, to the pod
+	// name and namespace. Pod name identifies the replica holding the lease.
+	podNameEnv      = "POD_NAME"
+	podNamespaceEnv = "POD_NAMESPACE"
+
+	// namespaceFile contains the namespace of the service account mounted in the pod
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	defaultNamespace = "webex-bot"
+
+	// leaseDuration is how long followers wait, since last renewal, before taking
+	// over the lease. It is the longest a failed leader goes unnoticed.
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+
+	// roleLabel is set to leaderRole on the pod of the replica holding the lease.
+	// Service exposing dashboard and JSON API selects it, so only the leader gets traffic.
+	roleLabel  = "role"
+	leaderRole = "leader"
+
+	// labelTimeout bounds updating the role label
+	labelTimeout = 5 * time.Second
+)
+
+// leading is 1 while this replica is the leader, 0 otherwise
+var leading int32
+
+// IsLeader returns true if this replica is currently the leader
+func IsLeader() bool {
+	return atomic.LoadInt32(&leading) == 1
+}
+
+// Run calls run, once this replica is elected leader, with a context which is
+// canceled if leadership is lost. Run returns once run returns or ctx is done. In
+// both cases lease is released, so another replica takes over right away.
+// A replica which loses leadership exits, to be restarted as a follower.
+// If standalone is set, there is no election and run is called right away.
+func Run(ctx context.Context, standalone bool, run func(ctx context.Context), logger logr.Logger) error {
+	if standalone {
+		logger.Info("Running standalone. No leader election")
+		atomic.StoreInt32(&leading, 1)
+		defer atomic.StoreInt32(&leading, 0)
+		run(ctx)
+		return nil
+	}
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get in-cluster config (use --standalone to run outside a cluster). Err: %v", err))
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to create kubernetes client. Err: %v", err))
+		return err
+	}
+
+	identity, err := getIdentity()
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get replica identity. Err: %v", err))
+		return err
+	}
+	logger = logger.WithValues("identity", identity)
+	namespace := getNamespace()
+
+	// A restarted replica might have been the leader
+	_ = setLeaderLabel(clientset, namespace, identity, false, logger)
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: namespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	electionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Info("Elected leader")
+				atomic.StoreInt32(&leading, 1)
+				_ = setLeaderLabel(clientset, namespace, identity, true, logger)
+				run(ctx)
+				atomic.StoreInt32(&leading, 0)
+				_ = setLeaderLabel(clientset, namespace, identity, false, logger)
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				atomic.StoreInt32(&leading, 0)
+				if electionCtx.Err() != nil {
+					logger.Info("Lease released")
+					return
+				}
+				logger.Info("Lost leadership. Exiting")
+				_ = setLeaderLabel(clientset, namespace, identity, false, logger)
+				os.Exit(1)
+			},
+			OnNewLeader: func(current string) {
+				if current != identity {
+					logger.Info(fmt.Sprintf("Following leader %s", current))
+				}
+			},
+		},
+	})
+
+	return nil
+}
+
+// setLeaderLabel sets, or removes if leading is false, the role label on pod
+func setLeaderLabel(clientset kubernetes.Interface, namespace, pod string, leading bool,
+	logger logr.Logger) error {
+	// In a merge patch, null removes the label
+	var role interface{}
+	if leading {
+		role = leaderRole
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{roleLabel: role},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), labelTimeout)
+	defer cancel()
+
+	if _, err := clientset.CoreV1().Pods(namespace).Patch(ctx, pod, types.MergePatchType, patch,
+		metav1.PatchOptions{}); err != nil {
+		logger.Info(fmt.Sprintf("Failed to update label %s of pod %s. Err: %v", roleLabel, pod, err))
+		return err
+	}
+
+	return nil
+}
+
+// getIdentity returns the name identifying this replica
+func getIdentity() (string, error) {
+	if name := os.Getenv(podNameEnv); name != "" {
+		return name, nil
+	}
+	return os.Hostname()
+}
+
+// getNamespace returns the namespace the Lease is created in
+func getNamespace() string {
+	if namespace := os.Getenv(podNamespaceEnv); namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(namespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+	return defaultNamespace
+}
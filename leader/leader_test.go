@@ -0,0 +1,45 @@
+package leader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSetLeaderLabel(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bot-1", Namespace: "ns", Labels: map[string]string{"bot": "webex-bot"}},
+	})
+
+	getLabels := func() map[string]string {
+		pod, err := clientset.CoreV1().Pods("ns").Get(context.TODO(), "bot-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod: %v", err)
+		}
+		return pod.Labels
+	}
+
+	if err := setLeaderLabel(clientset, "ns", "bot-1", true, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if labels := getLabels(); labels[roleLabel] != leaderRole || labels["bot"] != "webex-bot" {
+		t.Errorf("leader: unexpected labels %v", labels)
+	}
+
+	if err := setLeaderLabel(clientset, "ns", "bot-1", false, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if labels := getLabels(); labels["bot"] != "webex-bot" {
+		t.Errorf("follower: unexpected labels %v", labels)
+	} else if _, ok := labels[roleLabel]; ok {
+		t.Errorf("follower: unexpected labels %v", labels)
+	}
+
+	if err := setLeaderLabel(clientset, "ns", "unknown", true, logr.Discard()); err == nil {
+		t.Errorf("expected error for unknown pod")
+	}
+}
@@ -9,19 +9,17 @@ import (
 
 	"github.com/andygrunwald/go-jira"
 	"github.com/go-logr/logr"
-	"github.com/jasonlvhit/gocron"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
 
-	jira_utils "github.com/gianlucam76/jira_utils/jira"
+	"github.com/gianlucam76/webex_bot/scheduler"
+	"github.com/gianlucam76/webex_bot/state"
 	"github.com/gianlucam76/webex_bot/utils"
 	"github.com/gianlucam76/webex_bot/webex_utils"
 )
 
-const (
-	analyzedIssueFilename = "/tmp/analyzed_open_issue"
-)
-
 var (
+	analyzedIssueFilename = state.GetPath("analyzed_open_issue")
+
 	// resolvedIssueOwners is a map in the form: key: <method name> value: <engineer name>: <jira id> where:
 	// - <method name> is the method where e2e failed when jira issue was created
 	// - <engineer name> is the name of the engineer the resolved jira bug was assigned to.
@@ -51,9 +49,18 @@ func init() {
 func AnalyzeOpenIssues(ctx context.Context,
 	webexClient *webexteams.Client, roomID string,
 	jiraClient *jira.Client, logger logr.Logger) {
-	_ = gocron.Every(1).Day().At("23:30:00").Do(fromResolvedIssues, ctx, jiraClient, logger)
-	_ = gocron.Every(1).Day().At("8:30:00").Do(reassignOpenIssues, ctx, webexClient, roomID, jiraClient, logger)
-	_ = gocron.Every(1).Day().At("18:30:00").Do(reassignOpenIssues, ctx, webexClient, roomID, jiraClient, logger)
+	_ = scheduler.Register(scheduler.Job{
+		Name:        "learning-resolved-issues",
+		Description: "method to engineer map from resolved issues",
+		Schedule:    "30 23 * * *",
+		Run:         func() { fromResolvedIssues(ctx, jiraClient, logger) },
+	}, logger)
+	_ = scheduler.Register(scheduler.Job{
+		Name:        "learning-open-issues",
+		Description: "engineer suggestion for open issues",
+		Schedule:    "30 8,18 * * *",
+		Run:         func() { reassignOpenIssues(ctx, webexClient, roomID, jiraClient, logger) },
+	}, logger)
 }
 
 // fromResolvedIssues gets list of all resolved bugs filed by atomUser during e2e tagging sanity.
@@ -66,18 +73,7 @@ func AnalyzeOpenIssues(ctx context.Context,
 func fromResolvedIssues(ctx context.Context, jiraClient *jira.Client, logger logr.Logger) {
 	resolvedIssueOwners = make(map[string]string)
 
-	project, err := jira_utils.GetJiraProject(ctx, jiraClient, "", logger)
-	if err != nil || project == nil {
-		logger.Info(fmt.Sprintf("Failed to get jira project. Err: %v", err))
-		return
-	}
-
-	jql := fmt.Sprintf("Status IN (Resolved) and reporter = %s and project = %s",
-		utils.AtomUser, project.Name)
-	options := &jira.SearchOptions{
-		MaxResults: 100,
-	}
-	issues, _, err := jiraClient.Issue.SearchWithContext(ctx, jql, options)
+	issues, err := utils.RunQuery(ctx, jiraClient, utils.ResolvedIssuesQuery, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to get open issues. Error: %v", err))
 		return
@@ -124,17 +120,8 @@ func reassignOpenIssues(ctx context.Context, webexClient *webexteams.Client, roo
 		return
 	}
 
-	project, err := jira_utils.GetJiraProject(ctx, jiraClient, "", logger)
-	if err != nil || project == nil {
-		logger.Info(fmt.Sprintf("Failed to get jira project. Err: %v", err))
-		return
-	}
-
 	// Fetch open issues
-	jql := fmt.Sprintf("Status NOT IN (Resolved,Closed) and reporter = atom-ci.gen and project = %s",
-		project.Name)
-
-	openIssues, _, err := jiraClient.Issue.SearchWithContext(ctx, jql, nil)
+	openIssues, err := utils.GetOpenIssues(ctx, jiraClient, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to get open issues. Error: %v", err))
 		return
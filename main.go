@@ -6,19 +6,17 @@ import (
 	"fmt"
 	"image/png"
 	"os"
+	"os/signal"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/andygrunwald/go-jira"
 	"github.com/go-logr/logr"
-	"github.com/gonum/stat"
-	"github.com/jasonlvhit/gocron"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
-	"github.com/johnfercher/maroto/pkg/consts"
-	"github.com/johnfercher/maroto/pkg/pdf"
-	"github.com/johnfercher/maroto/pkg/props"
 	gim "github.com/ozankasikci/go-image-merge"
 	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
@@ -26,7 +24,18 @@ import (
 
 	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
 	jira_utils "github.com/gianlucam76/jira_utils/jira"
+	"github.com/gianlucam76/webex_bot/alerts"
 	"github.com/gianlucam76/webex_bot/analyze"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/health"
+	"github.com/gianlucam76/webex_bot/history"
+	"github.com/gianlucam76/webex_bot/leader"
+	"github.com/gianlucam76/webex_bot/metrics"
+	"github.com/gianlucam76/webex_bot/routing"
+	"github.com/gianlucam76/webex_bot/scheduler"
+	"github.com/gianlucam76/webex_bot/server"
+	"github.com/gianlucam76/webex_bot/state"
+	"github.com/gianlucam76/webex_bot/summary"
 	"github.com/gianlucam76/webex_bot/utils"
 	"github.com/gianlucam76/webex_bot/webex_utils"
 )
@@ -36,19 +45,62 @@ const (
 	webexRoom           = "E2E_WEBEX_ROOM"
 	issueText           = "issues"
 	vcsText             = "vcs"
-	vcsLink             = "https://cs-aci-jenkins.cisco.com:8443/job/Production/job/Cloudstack/job/Cloudstack-Virtual-Sanity/"
 	ucsText             = "ucs"
-	ucsLink             = "https://cs-aci-jenkins.cisco.com:8443/job/Production/job/Cloudstack/job/Cloudstack-UCS-Sanity/"
 	pieChartText        = "charts"
 	reportText          = "reports"
 	usageText           = "usage"
 	summaryText         = "summary"
+	rightSizeText       = "rightsize"
+	issueTimelineText   = "issue"
+	jqlText             = "jql"
+	fileIssueText       = "file-issue"
+	workloadText        = "workload"
+	trendsText          = "trends"
+	exportText          = "export"
+	htmlText            = "html"
+	jobsText            = "jobs"
+
+	// Commands messages are counted as when not matching any of the above
+	testCommand    = "test"
+	defaultCommand = "default"
 )
 
-var pollInterval time.Duration
+// Subcommands used to run the bot locally, with no Webex
+const (
+	runCommand         = "run"
+	jobCommand         = "job"
+	defaultOutputDir   = "webex_bot_output"
+	localRoom          = "local"
+	localUsageTemplate = "usage: %s run <command...> | %s job <name>"
+)
+
+// Maximum number of issues listed in a reply
+const maxListedIssues = 50
+
+// Messages older than this are not answered when resuming, so a bot which was down
+// for long does not answer questions nobody is waiting for anymore
+const maxUnansweredMessageAge = time.Hour
+
+// Suppressed usage variance alerts are muted for two weeks, unless a duration is specified
+const defaultSuppressDuration = 14 * 24 * time.Hour
+
+var (
+	pollInterval time.Duration
+
+	// standalone disables leader election. Only one instance must run.
+	standalone bool
+
+	// outputDir is where attachments are written when running locally
+	outputDir string
+
+	// lastMessageFilename is the file where the ID of the last answered message is persisted
+	lastMessageFilename = state.GetPath("last_message_id")
+)
 
 func main() {
-	ctx := context.Background()
+	// On termination, context is canceled so lease is released and another replica takes over
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
 
 	klog.InitFlags(nil)
 
@@ -62,6 +114,15 @@ func main() {
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
 
+	// "webex_bot run <command...>" and "webex_bot job <name>" run locally and exit
+	if args := pflag.Args(); len(args) > 0 {
+		if err := runLocally(ctx, args, logger); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	webexClient := webex_utils.GetClient(logger)
 
 	roomName := getRoom(logger)
@@ -79,43 +140,65 @@ func main() {
 		return
 	}
 
-	// Send weekly reports on UCS and VCS failed test stats
-	analyze.WeeklyStats(ctx, webexClient, room.ID, logger)
+	// Alerts are delivered to owners using their preferred channel
+	routing.RegisterDefaultNotifiers(webexClient, room.ID, logger)
 
-	// Check time duration for UCS tests. Send webex message when the time relative standard deviation
-	// is too large
-	analyze.CheckTestDurationOnUCS(ctx, webexClient, room.ID, logger)
+	// Serve health, readiness and metrics on every replica, read-only dashboard and
+	// JSON API on the leader only
+	server.Start(ctx, webexClient, jiraClient, logger)
 
-	// Analyze reports for UCS tests. Send webex message when the time relative standard deviation
-	// is too large
-	analyze.CheckReportDurationOnUCS(ctx, webexClient, room.ID, logger)
+	// Only the leader answers messages and runs scheduled jobs
+	if err := leader.Run(ctx, standalone, func(ctx context.Context) {
+		runLeader(ctx, webexClient, jiraClient, room.ID, logger)
+	}, logger); err != nil {
+		os.Exit(1)
+	}
+}
 
-	// Send reports on currently open issues
-	analyze.OpenIssues(ctx, webexClient, room.ID, jiraClient, logger)
+// runLeader schedules jobs and answers messages till ctx is done
+func runLeader(ctx context.Context, webexClient *webexteams.Client, jiraClient *jira.Client,
+	roomID string, logger logr.Logger) {
+	// History database is used by the leader only. It is closed before lease is released,
+	// so next leader can open it.
+	history.Open(logger)
+	defer func() {
+		if err := history.Close(); err != nil {
+			logger.Info(fmt.Sprintf("Failed to close history database. Err: %v", err))
+		}
+	}()
 
-	// Generate pie charts for UCS and VCS considering test durations
-	analyze.CreatePieCharts(ctx, webexClient, room.ID, logger)
+	// Run analyzers on schedule: failed test stats, test/report duration and usage,
+	// open issues, jira and run watchers, escalations, workload and trends.
+	// Generated files left behind are removed as well
+	analyze.ScheduleJobs(ctx, webexClient, roomID, jiraClient, logger)
 
-	// Send reports on memory/cpu usage
-	analyze.CheckReportUsageOnUCS(ctx, webexClient, room.ID, logger)
+	// Backfill history store with runs not ingested when they completed
+	history.Backfill(ctx, logger)
 
 	// TODO: re-enable this
-	// learning.AnalyzeOpenIssues(ctx, webexClient, room.ID, jiraClient, logger)
+	// learning.AnalyzeOpenIssues(ctx, webexClient, roomID, jiraClient, logger)
 
-	go startCron()
+	scheduler.Start(ctx, logger)
 
 	// Bot will respond to one message at a time.
-	// If this is not set, last message sent to bot will be answered. Otherwise last
-	// message sent to bot after this will be answered
-	lastMessageID := ""
-
-	now := time.Now()
-	maxOldMessageTimestamp := now.Add(-5 * pollInterval)
+	// Messages sent to bot after last answered one are answered. Last answered message
+	// is persisted, so a new leader, or a restarted bot, resumes from where the previous
+	// one left off. If it is not known, only messages sent in the last poll intervals are answered.
+	lastMessageID := loadLastMessageID(logger)
+	maxOldMessageTimestamp := time.Now().Add(-5 * pollInterval)
+	if lastMessageID != "" {
+		maxOldMessageTimestamp = time.Now().Add(-maxUnansweredMessageAge)
+	}
 
 	for {
-		messages, err := webex_utils.GetMessages(webexClient, room.ID, logger)
+		messages, err := webex_utils.GetMessages(webexClient, roomID, logger)
+		// Liveness fails if polling keeps failing
+		health.PollResult(err)
 		if err != nil {
-			return
+			if !sleep(ctx, pollInterval) {
+				return
+			}
+			continue
 		}
 
 		logger.Info(fmt.Sprintf("Got messages (%d)", len(messages.Items)))
@@ -130,36 +213,184 @@ func main() {
 				logger.Info("No new messages to answer")
 				break
 			} else {
-				if strings.Contains(m.Text, issueText) {
-					handleOpenIssueRequest(ctx, webexClient, jiraClient, room.ID, from, logger)
-				} else if strings.Contains(m.Text, vcsText) {
-					handleVcsResultRequest(ctx, webexClient, room.ID, from, logger)
-				} else if strings.Contains(m.Text, ucsText) {
-					handleUcsResultRequest(ctx, webexClient, room.ID, from, logger)
-				} else if strings.Contains(m.Text, pieChartText) {
-					handlePieChartRequest(ctx, webexClient, room.ID, from, logger)
-				} else if strings.Contains(m.Text, reportText) {
-					handleReportRequest(ctx, webexClient, room.ID, from, logger)
-				} else if strings.Contains(m.Text, usageText) {
-					handleUsageReportRequest(ctx, webexClient, room.ID, from, m.Text, logger)
-				} else if strings.Contains(m.Text, summaryText) {
-					handleSummaryRequest(ctx, webexClient, room.ID, from, logger)
-				} else if testName, isMatch, err := doesMatchTest(ctx, webexClient, room.ID, from, m.Text, logger); err == nil {
-					if isMatch {
-						sendMessageWithTestResult(ctx, webexClient, room.ID, from, testName, logger)
-					} else {
-						sendDefaultResponse(ctx, webexClient, room.ID, from, m.Text, logger)
-					}
-				}
+				handleMessage(ctx, webexClient, jiraClient, roomID, from, m.Text, logger)
 			}
 		}
 
 		// Messages are always from last sent backwards in time
-		if len(messages.Items) > 0 {
+		if len(messages.Items) > 0 && messages.Items[0].ID != lastMessageID {
 			lastMessageID = messages.Items[0].ID
+			storeLastMessageID(lastMessageID, logger)
 		}
 
-		time.Sleep(pollInterval)
+		if !sleep(ctx, pollInterval) {
+			return
+		}
+	}
+}
+
+// loadLastMessageID returns the ID of the last answered message, empty if not known
+func loadLastMessageID(logger logr.Logger) string {
+	content, err := os.ReadFile(lastMessageFilename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Info(fmt.Sprintf("Failed to read file %s. Err: %v", lastMessageFilename, err))
+		}
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// storeLastMessageID persists the ID of the last answered message
+func storeLastMessageID(id string, logger logr.Logger) {
+	if err := os.WriteFile(lastMessageFilename, []byte(id), 0600); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write file %s. Err: %v", lastMessageFilename, err))
+	}
+}
+
+// sleep waits for d. Returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// runLocally runs, with no Webex, either a bot command ("run <command...>") or a
+// scheduled analyzer once ("job <name>"). Replies are printed to stdout and attachments
+// are written to outputDir. Elastic DB and Jira are the configured ones.
+func runLocally(ctx context.Context, args []string, logger logr.Logger) error {
+	usage := fmt.Sprintf(localUsageTemplate, os.Args[0], os.Args[0])
+
+	switch args[0] {
+	case runCommand:
+		if len(args) < 2 {
+			return fmt.Errorf("%s", usage)
+		}
+	case jobCommand:
+		if len(args) != 2 {
+			text := usage + "\nAvailable jobs:\n"
+			for _, job := range analyze.GetJobs(ctx, nil, localRoom, nil, logger) {
+				text += fmt.Sprintf("  %-18s %s\n", job.Name, job.Description)
+			}
+			return fmt.Errorf("%s", text)
+		}
+	default:
+		return fmt.Errorf("unknown command %q. %s", args[0], usage)
+	}
+
+	if err := webex_utils.SetLocalOutput(outputDir, logger); err != nil {
+		return err
+	}
+
+	jiraClient, err := jira_utils.GetJiraClient(ctx, jira_utils.GetUsername(logger), jira_utils.GetPassword(logger), logger)
+	if err != nil {
+		return fmt.Errorf("failed to get jira client. Err: %v", err)
+	}
+
+	// Notifications are printed as well. Owners are never emailed by a local run.
+	routing.RegisterWebexNotifiers(nil, localRoom)
+
+	history.Open(logger)
+	defer func() {
+		if err := history.Close(); err != nil {
+			logger.Info(fmt.Sprintf("Failed to close history database. Err: %v", err))
+		}
+	}()
+
+	if args[0] == runCommand {
+		from := os.Getenv("USER")
+		if from == "" {
+			from = localRoom
+		}
+		handleMessage(ctx, nil, jiraClient, localRoom, from, strings.Join(args[1:], " "), logger)
+		return nil
+	}
+
+	for _, job := range analyze.GetJobs(ctx, nil, localRoom, jiraClient, logger) {
+		if job.Name == args[1] {
+			job.Run()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown job %q. Run %s %s for the list of jobs", args[1], os.Args[0], jobCommand)
+}
+
+// handleMessage answers a message sent to the bot
+func handleMessage(ctx context.Context, webexClient *webexteams.Client, jiraClient *jira.Client,
+	roomID, from, text string, logger logr.Logger) {
+	start := time.Now()
+	command := defaultCommand
+	defer func() {
+		metrics.ObserveMessage(command, time.Since(start))
+	}()
+
+	text = webex_utils.TrimMention(text)
+
+	if strings.Contains(text, rightSizeText) {
+		command = rightSizeText
+		handleRightSizeRequest(ctx, webexClient, roomID, from, text, logger)
+	} else if args, ok := getCommandArgs(text, analyze.AckText); ok {
+		command = analyze.AckText
+		handleAckRequest(ctx, webexClient, roomID, from, args, logger)
+	} else if args, ok := getCommandArgs(text, analyze.SnoozeText); ok {
+		command = analyze.SnoozeText
+		handleSnoozeRequest(ctx, webexClient, roomID, from, args, logger)
+	} else if args, ok := getCommandArgs(text, jobsText); ok {
+		command = jobsText
+		handleJobsRequest(ctx, webexClient, roomID, from, args, logger)
+	} else if strings.Contains(text, analyze.SuppressText) {
+		command = analyze.SuppressText
+		handleSuppressRequest(ctx, webexClient, roomID, from, text, logger)
+	} else if args, ok := getCommandArgs(text, exportText); ok {
+		command = exportText
+		handleExportRequest(ctx, webexClient, roomID, from, args, logger)
+	} else if args, ok := getCommandArgs(text, summaryText); ok {
+		command = summaryText
+		handleSummaryRequest(ctx, webexClient, jiraClient, roomID, from, args, logger)
+	} else if strings.Contains(text, trendsText) {
+		command = trendsText
+		handleTrendsRequest(ctx, webexClient, jiraClient, roomID, from, logger)
+	} else if strings.Contains(text, workloadText) {
+		command = workloadText
+		handleWorkloadRequest(ctx, webexClient, jiraClient, roomID, from, logger)
+	} else if args, ok := getCommandArgs(text, fileIssueText); ok {
+		command = fileIssueText
+		handleFileIssueRequest(ctx, webexClient, jiraClient, roomID, from, args, logger)
+	} else if args, ok := getCommandArgs(text, jqlText); ok {
+		command = jqlText
+		handleJQLRequest(ctx, webexClient, jiraClient, roomID, from, args, logger)
+	} else if args, ok := getCommandArgs(text, issueTimelineText); ok {
+		command = issueTimelineText
+		handleIssueTimelineRequest(ctx, webexClient, jiraClient, roomID, from, args, logger)
+	} else if strings.Contains(text, issueText) {
+		command = issueText
+		handleOpenIssueRequest(ctx, webexClient, jiraClient, roomID, from, logger)
+	} else if strings.Contains(text, vcsText) {
+		command = vcsText
+		handleVcsResultRequest(ctx, webexClient, jiraClient, roomID, from, logger)
+	} else if strings.Contains(text, ucsText) {
+		command = ucsText
+		handleUcsResultRequest(ctx, webexClient, jiraClient, roomID, from, logger)
+	} else if strings.Contains(text, pieChartText) {
+		command = pieChartText
+		handlePieChartRequest(ctx, webexClient, roomID, from, text, logger)
+	} else if strings.Contains(text, reportText) {
+		command = reportText
+		handleReportRequest(ctx, webexClient, roomID, from, logger)
+	} else if strings.Contains(text, usageText) {
+		command = usageText
+		handleUsageReportRequest(ctx, webexClient, roomID, from, text, logger)
+	} else if testName, isMatch, err := doesMatchTest(ctx, webexClient, roomID, from, text, logger); err == nil {
+		if isMatch {
+			command = testCommand
+			sendMessageWithTestResult(ctx, webexClient, roomID, from, testName, logger)
+		} else {
+			sendDefaultResponse(ctx, webexClient, roomID, from, text, logger)
+		}
 	}
 }
 
@@ -213,8 +444,8 @@ func handleOpenIssueRequest(ctx context.Context, webexClient *webexteams.Client,
 			diff := time.Since(createdTime)
 			lastUpdate := fmt.Sprintf("%d days", int(diff.Hours()/24))
 			assignee := issues[i].Fields.Assignee.Name
-			textMessage += fmt.Sprintf("[%s](https://jira-eng-sjc10.cisco.com/jira/browse/%s). Issue opened %s ago. Assignee <@personEmail:%s@cisco.com|%s>  (issue seen %d times since filed)\n",
-				issues[i].Key, issues[i].Key, lastUpdate, assignee, assignee, times)
+			textMessage += fmt.Sprintf("%s. Issue opened %s ago. Assignee <@personEmail:%s@cisco.com|%s>  (issue seen %d times since filed)\n",
+				utils.GetIssueLink(issues[i].Key), lastUpdate, assignee, assignee, times)
 		}
 	}
 
@@ -223,6 +454,330 @@ func handleOpenIssueRequest(ctx context.Context, webexClient *webexteams.Client,
 	}
 }
 
+func handleTrendsRequest(ctx context.Context, webexClient *webexteams.Client,
+	jiraClient *jira.Client, roomID, from string, logger logr.Logger) {
+	logger.Info("Handling trends request")
+
+	ws, err := artifacts.New("trends", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare trend report", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
+
+	report, fileName, err := analyze.GetTrendReport(ctx, ws, jiraClient, logger)
+	if err != nil {
+		textMessage += fmt.Sprintf("Failed to build trend report. Err: %v", err)
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage+report, []string{fileName}, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleExportRequest(ctx context.Context, webexClient *webexteams.Client,
+	roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling export request")
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
+
+	// Format of this request: <something> export <what> [filter] [range] [format]
+	request, err := analyze.ParseExportRequest(args)
+	if err != nil {
+		textMessage += fmt.Sprintf("%v.  \nFormat is %s <%s> [test, report type or namespace] [range, e.g. 30d or 4w] [csv|json]",
+			err, exportText, strings.Join(analyze.GetExportDatasets(), "|"))
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	attachment, entries, truncated, err := analyze.Export(ctx, request, logger)
+	if err != nil || entries == 0 {
+		if err != nil {
+			textMessage += fmt.Sprintf("Failed to export %s. Err: %v", request.What, err)
+		} else {
+			textMessage += fmt.Sprintf("No %s found in the last %d days", request.What, int(request.Range.Hours()/24))
+		}
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	textMessage += fmt.Sprintf("Please find attached %d %s entries from the last %d days",
+		entries, request.What, int(request.Range.Hours()/24))
+	if request.Filter != "" {
+		textMessage += fmt.Sprintf(" for %s", request.Filter)
+	}
+	if truncated {
+		textMessage += ".  \nMore entries matched: only the most recent ones were exported. " +
+			"Narrow the range or add a filter to get all of them"
+	}
+
+	if err := webex_utils.SendMessageWithAttachments(webexClient, roomID, textMessage,
+		[]webex_utils.Attachment{*attachment}, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleWorkloadRequest(ctx context.Context, webexClient *webexteams.Client,
+	jiraClient *jira.Client, roomID, from string, logger logr.Logger) {
+	logger.Info("Handling workload request")
+
+	ws, err := artifacts.New("workload", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare workload report", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
+
+	report, fileName, err := analyze.GetWorkloadReport(ctx, ws, jiraClient, logger)
+	if err != nil {
+		textMessage += fmt.Sprintf("Failed to get workload for the active sprint. Err: %v", err)
+	} else {
+		textMessage += report
+	}
+
+	if fileName == "" {
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleFileIssueRequest(ctx context.Context, webexClient *webexteams.Client,
+	jiraClient *jira.Client, roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling file issue request")
+
+	// Format of this request: <something> file-issue <test name> [run]
+	if len(args) == 0 {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Format is %s test-name [run] (if run is not specified, last run where test failed is used)",
+				fileIssueText), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	testName := args[0]
+	var run string
+	if len(args) > 1 {
+		if _, err := strconv.ParseInt(args[1], 10, 64); err != nil {
+			if err := webex_utils.SendMessage(webexClient, roomID,
+				fmt.Sprintf("Run %q is not valid. Format is %s test-name [run]", args[1], fileIssueText), logger); err != nil {
+				logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+			}
+			return
+		}
+		run = args[1]
+	}
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your request.  \n",
+		from, from)
+
+	results, err := es_utils.GetResults(ctx, logger,
+		run,      // from this run, if specified
+		testName, // for this specific test
+		false,    // any environment
+		false,    // any environment
+		false,    // no passed
+		true,     // get failed tests
+		false,    // no skipped
+		1,        // most recent failure
+	)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get failures for test %s from elastic DB. Err: %v", testName, err))
+		textMessage += fmt.Sprintf("Failed to get test %s failures. Err: %v", testName, err)
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	var rtyp es_utils.Result
+	var failure *es_utils.Result
+	for _, item := range results.Each(reflect.TypeOf(rtyp)) {
+		r := item.(es_utils.Result)
+		failure = &r
+	}
+
+	if failure == nil {
+		if run != "" {
+			textMessage += fmt.Sprintf("Test %s did not fail in run %s", testName, run)
+		} else {
+			textMessage += fmt.Sprintf("No failure found for test %s", testName)
+		}
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	assignee := routing.GetTestOwner(failure.Name, failure.Maintainer, logger)
+	issue, created, err := utils.FileTestFailure(ctx, jiraClient, failure, assignee, from, logger)
+	switch {
+	case err != nil && issue == nil:
+		textMessage += fmt.Sprintf("Failed to file test %s failure. Err: %v", testName, err)
+	case created:
+		textMessage += fmt.Sprintf("Filed %s for test %s failure in %s run %d. Assignee <@personEmail:%s@cisco.com|%s>",
+			utils.GetIssueLink(issue.Key), testName, failure.Environment, failure.Run, assignee, assignee)
+	default:
+		textMessage += fmt.Sprintf("Test %s failure in %s run %d added as new occurrence to open issue %s",
+			testName, failure.Environment, failure.Run, utils.GetIssueLink(issue.Key))
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleJQLRequest(ctx context.Context, webexClient *webexteams.Client,
+	jiraClient *jira.Client, roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling jql request")
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
+
+	names, err := utils.GetQueryNames(ctx, jiraClient, logger)
+	if err != nil {
+		textMessage += fmt.Sprintf("Failed to get jira queries. Err: %v", err)
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	// Format of this request: <something> jql <query name>
+	if len(args) == 0 || !isKnownQuery(names, args[0]) {
+		textMessage += fmt.Sprintf("Format is %s query-name. Available queries: %s",
+			jqlText, strings.Join(names, ", "))
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	issues, err := utils.RunQuery(ctx, jiraClient, args[0], logger)
+	if err != nil {
+		textMessage += fmt.Sprintf("Failed to run query %s. Err: %v", args[0], err)
+	} else if len(issues) == 0 {
+		textMessage += fmt.Sprintf("No issues match query %s", args[0])
+	} else {
+		textMessage += fmt.Sprintf("Here are the issues matching query %s:  \n", args[0])
+		if len(issues) > maxListedIssues {
+			textMessage += fmt.Sprintf("(showing first %d of %d)  \n", maxListedIssues, len(issues))
+			issues = issues[:maxListedIssues]
+		}
+		for i := range issues {
+			status := ""
+			if issues[i].Fields.Status != nil {
+				status = issues[i].Fields.Status.Name
+			}
+			assignee := "none"
+			if issues[i].Fields.Assignee != nil {
+				assignee = fmt.Sprintf("<@personEmail:%s@cisco.com|%s>",
+					issues[i].Fields.Assignee.Name, issues[i].Fields.Assignee.Name)
+			}
+			age := int(time.Since(time.Time(issues[i].Fields.Created)).Hours() / 24)
+			textMessage += fmt.Sprintf("1. %s %s. Status %s, opened %d days ago. Assignee %s  \n",
+				utils.GetIssueLink(issues[i].Key), issues[i].Fields.Summary, status, age, assignee)
+		}
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// isKnownQuery returns true if name is in names
+func isKnownQuery(names []string, name string) bool {
+	for i := range names {
+		if names[i] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func handleIssueTimelineRequest(ctx context.Context, webexClient *webexteams.Client,
+	jiraClient *jira.Client, roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling issue timeline request")
+
+	ws, err := artifacts.New("timeline", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare issue timeline", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+
+	// Format of this request: <something> issue <issue key>
+	if len(args) == 0 {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Format is %s issue-key (i.e. %s CSP-1234)", issueTimelineText, issueTimelineText), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	key := strings.ToUpper(args[0])
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
+
+	issue, occurrences, testName, err := analyze.GetIssueOccurrences(ctx, jiraClient, key, logger)
+	if err != nil {
+		textMessage += fmt.Sprintf("Failed to get issue %s. Err: %v", key, err)
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	textMessage += fmt.Sprintf("%s %s  \n", utils.GetIssueLink(issue.Key), issue.Fields.Summary)
+	textMessage += fmt.Sprintf("Failure seen %d times since filed:  \n", len(occurrences))
+	for i := range occurrences {
+		where := "unknown run"
+		if runID, err := strconv.ParseInt(occurrences[i].Run, 10, 64); err == nil {
+			if occurrences[i].Environment == "" {
+				// Without environment, run link cannot be built
+				where = fmt.Sprintf("unknown environment run %d", runID)
+			} else {
+				where = fmt.Sprintf("%s run [%d](%s)", occurrences[i].Environment, runID,
+					utils.GetRunLink(occurrences[i].Environment == vcsText, runID))
+			}
+		}
+		textMessage += fmt.Sprintf("1. %s %s  \n", occurrences[i].Time.Format("2006-01-02 15:04"), where)
+	}
+
+	fileName, err := analyze.CreateIssueTimeline(ctx, ws, issue.Key, testName, occurrences, logger)
+	if err != nil {
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
 func sendDefaultResponse(ctx context.Context, webexClient *webexteams.Client,
 	roomID, from, message string, logger logr.Logger) {
 	logger.Info(fmt.Sprintf("Sending default response. Failed to understand %q", message))
@@ -233,43 +788,28 @@ func sendDefaultResponse(ctx context.Context, webexClient *webexteams.Client,
 }
 
 func handleVcsResultRequest(ctx context.Context, webexClient *webexteams.Client,
-	roomID, from string, logger logr.Logger) {
-	lastRun, err := utils.GetLastRun(ctx, true, logger)
+	jiraClient *jira.Client, roomID, from string, logger logr.Logger) {
+	lastRun, failedTests, err := utils.GetLastRunFailures(ctx, true, logger)
 	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to get last run ID. Err: %v", err))
 		return
 	}
 
 	if lastRun != 0 {
-		results, err := es_utils.GetResults(ctx, logger,
-			fmt.Sprintf("%d", lastRun), // from this run
-			"",                         // no specific test
-			true,                       // from vcs
-			false,                      // no ucs
-			false,                      // no passed
-			true,                       // get failed tests
-			false,                      // no skipped
-			200,
-		)
-		if err != nil {
-			logger.Info(fmt.Sprintf("Failed to get failed test in vcs run %d from elastic DB. Err: %v", lastRun, err))
-			return
-		}
-
 		textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
 			from, from)
 
-		var rtyp es_utils.Result
-		failedTests := false
-		for _, item := range results.Each(reflect.TypeOf(rtyp)) {
-			failedTests = true
-			r := item.(es_utils.Result)
-			textMessage += fmt.Sprintf("Test %s failed in vcs run [%d](%s/%d) ❌  \n",
-				r.Name, lastRun, vcsLink, lastRun)
+		issues, err := utils.GetIssuesForTests(ctx, jiraClient, failedTests, logger)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to correlate failed tests with jira issues. Err: %v", err))
 		}
-		if !failedTests {
+
+		for i := range failedTests {
+			textMessage += fmt.Sprintf("Test %s failed in vcs run [%d](%s/%d) ❌ %s  \n",
+				failedTests[i], lastRun, utils.VCSLink, lastRun, getIssueAnnotation(issues, failedTests[i], err))
+		}
+		if len(failedTests) == 0 {
 			textMessage += fmt.Sprintf("No tests failed in vcs run [%d](%s/%d) 🥇   \n",
-				lastRun, vcsLink, lastRun)
+				lastRun, utils.VCSLink, lastRun)
 		}
 
 		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
@@ -279,43 +819,28 @@ func handleVcsResultRequest(ctx context.Context, webexClient *webexteams.Client,
 }
 
 func handleUcsResultRequest(ctx context.Context, webexClient *webexteams.Client,
-	roomID, from string, logger logr.Logger) {
-	lastRun, err := utils.GetLastRun(ctx, false, logger)
+	jiraClient *jira.Client, roomID, from string, logger logr.Logger) {
+	lastRun, failedTests, err := utils.GetLastRunFailures(ctx, false, logger)
 	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to get last run ID. Err: %v", err))
 		return
 	}
 
 	if lastRun != 0 {
-		results, err := es_utils.GetResults(ctx, logger,
-			fmt.Sprintf("%d", lastRun), // from this run
-			"",                         // no specific test
-			false,                      // no vcs
-			true,                       // from ucs
-			false,                      // no passed
-			true,                       // get failed tests
-			false,                      // no skipped
-			200,
-		)
-		if err != nil {
-			logger.Info(fmt.Sprintf("Failed to get failed test in ucs run %d from elastic DB. Err: %v", lastRun, err))
-			return
-		}
-
 		textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
 			from, from)
 
-		var rtyp es_utils.Result
-		failedTests := false
-		for _, item := range results.Each(reflect.TypeOf(rtyp)) {
-			failedTests = true
-			r := item.(es_utils.Result)
-			textMessage += fmt.Sprintf("Test %s failed in ucs run [%d](%s/%d) ❌  \n",
-				r.Name, lastRun, ucsLink, lastRun)
+		issues, err := utils.GetIssuesForTests(ctx, jiraClient, failedTests, logger)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to correlate failed tests with jira issues. Err: %v", err))
 		}
-		if !failedTests {
+
+		for i := range failedTests {
+			textMessage += fmt.Sprintf("Test %s failed in ucs run [%d](%s/%d) ❌ %s  \n",
+				failedTests[i], lastRun, utils.UCSLink, lastRun, getIssueAnnotation(issues, failedTests[i], err))
+		}
+		if len(failedTests) == 0 {
 			textMessage += fmt.Sprintf("No tests failed in ucs run [%d](%s/%d) 🥇  \n",
-				lastRun, ucsLink, lastRun)
+				lastRun, utils.UCSLink, lastRun)
 		}
 
 		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
@@ -324,34 +849,91 @@ func handleUcsResultRequest(ctx context.Context, webexClient *webexteams.Client,
 	}
 }
 
+// getIssueAnnotation returns the text describing the open issue tracking testName failure.
+// err is the error, if any, hit while looking for issues.
+func getIssueAnnotation(issues map[string]*jira.Issue, testName string, err error) string {
+	if err != nil {
+		return ""
+	}
+
+	issue, ok := issues[testName]
+	if !ok {
+		return "⚠️ no tracked issue"
+	}
+
+	age := int(time.Since(time.Time(issue.Fields.Created)).Hours() / 24)
+	text := fmt.Sprintf("tracked by %s opened %d days ago", utils.GetIssueLink(issue.Key), age)
+	if issue.Fields.Assignee != nil {
+		assignee := issue.Fields.Assignee.Name
+		text += fmt.Sprintf(" assignee <@personEmail:%s@cisco.com|%s>", assignee, assignee)
+	}
+
+	return text
+}
+
 func handlePieChartRequest(ctx context.Context, webexClient *webexteams.Client,
-	roomID, from string, logger logr.Logger) {
+	roomID, from, message string, logger logr.Logger) {
 	logger.Info("Handling pie chart request")
 
-	if fileName, err := analyze.CreateDurationPieChart(ctx, true, roomID, logger); err == nil {
-		textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
-			from, from)
-		textMessage += "the attached file contains test duration pie chart from last VCS run  \n"
-		if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
-			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
-		}
+	ws, err := artifacts.New("charts", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare pie charts", err, logger)
+		return
 	}
-	// create pie chart for ucs
-	if fileName, err := analyze.CreateDurationPieChart(ctx, false, roomID, logger); err == nil {
+	defer ws.Remove(logger)
+
+	// Format of this request: <something> charts [html]
+	// When html is present, interactive charts are attached as well
+	args, _ := getCommandArgs(message, pieChartText)
+	html := len(args) > 0 && args[0] == htmlText
+
+	for _, vcs := range []bool{true, false} {
+		env := "UCS"
+		if vcs {
+			env = "VCS"
+		}
+
+		fileName, err := analyze.CreateDurationPieChart(ctx, ws, vcs, roomID, logger)
+		if err != nil {
+			sendErrorMessage(webexClient, roomID, from, fmt.Sprintf("Failed to create %s test duration chart", env),
+				err, logger)
+			continue
+		}
+
 		textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
 			from, from)
-		textMessage += "the attached file contains test duration pie chart from last UCS run  \n"
+		textMessage += fmt.Sprintf("here is the test duration chart from last %s run  \n", env)
 		if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
 			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 		}
+
+		if !html {
+			continue
+		}
+
+		// Webex allows one file per message
+		if fileName, err := analyze.CreateDurationPieChartHTML(ctx, ws, vcs, logger); err == nil {
+			textMessage := fmt.Sprintf("open the attached file for the interactive %s chart", env)
+			if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{fileName}, logger); err != nil {
+				logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+			}
+		}
 	}
 }
 
 func handleReportRequest(ctx context.Context, webexClient *webexteams.Client,
 	roomID, from string, logger logr.Logger) {
 	logger.Info("Handling report request")
-	files, err := getReportFiles(ctx, logger)
+
+	ws, err := artifacts.New("reports", logger)
 	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare report plots", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+	files, err := getReportFiles(ctx, ws, logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to create report plots", err, logger)
 		return
 	}
 
@@ -365,18 +947,21 @@ func handleReportRequest(ctx context.Context, webexClient *webexteams.Client,
 	rgba, err := gim.New(grids, 3, 3).Merge()
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create grid. Error %v", err))
+		sendErrorMessage(webexClient, roomID, from, "Failed to merge plots", err, logger)
 		return
 	}
 
-	gridFileName := "/tmp/report_grid.png"
+	gridFileName := ws.Path("report_grid.png")
 	file, err := os.Create(gridFileName)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create grid file. Error %v", err))
+		sendErrorMessage(webexClient, roomID, from, "Failed to merge plots", err, logger)
 		return
 	}
 
 	if err = png.Encode(file, rgba); err != nil {
 		logger.Info(fmt.Sprintf("Failed to encode grid file. Error %v", err))
+		sendErrorMessage(webexClient, roomID, from, "Failed to merge plots", err, logger)
 		return
 	}
 
@@ -394,6 +979,13 @@ func handleUsageReportRequest(ctx context.Context, webexClient *webexteams.Clien
 	roomID, from, message string, logger logr.Logger) {
 	logger.Info("Handling usage report request")
 
+	ws, err := artifacts.New("usage", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare usage plots", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+
 	// Format of this request: <something> usage <namespace>
 	index := strings.Index(message, usageText)
 	var namespace string
@@ -406,8 +998,9 @@ func handleUsageReportRequest(ctx context.Context, webexClient *webexteams.Clien
 		return
 	}
 
-	files, err := getUsageReportFiles(ctx, namespace, logger)
+	files, err := getUsageReportFiles(ctx, ws, namespace, logger)
 	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to create usage plots", err, logger)
 		return
 	}
 
@@ -430,18 +1023,21 @@ func handleUsageReportRequest(ctx context.Context, webexClient *webexteams.Clien
 	rgba, err := gim.New(grids, x, y).Merge()
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create grid. Error %v", err))
+		sendErrorMessage(webexClient, roomID, from, "Failed to merge plots", err, logger)
 		return
 	}
 
-	gridFileName := "/tmp/report_grid.png"
+	gridFileName := ws.Path("report_grid.png")
 	file, err := os.Create(gridFileName)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create grid file. Error %v", err))
+		sendErrorMessage(webexClient, roomID, from, "Failed to merge plots", err, logger)
 		return
 	}
 
 	if err = png.Encode(file, rgba); err != nil {
 		logger.Info(fmt.Sprintf("Failed to encode grid file. Error %v", err))
+		sendErrorMessage(webexClient, roomID, from, "Failed to merge plots", err, logger)
 		return
 	}
 
@@ -455,151 +1051,279 @@ func handleUsageReportRequest(ctx context.Context, webexClient *webexteams.Clien
 	}
 }
 
-func handleSummaryRequest(ctx context.Context, webexClient *webexteams.Client,
-	roomID, from string, logger logr.Logger) {
-	logger.Info("Handling summary request")
-
-	m := pdf.NewMaroto(consts.Portrait, consts.A4)
-	var margin float64 = 10
-	m.SetPageMargins(margin, margin, margin)
+func handleRightSizeRequest(ctx context.Context, webexClient *webexteams.Client,
+	roomID, from, message string, logger logr.Logger) {
+	logger.Info("Handling right size request")
 
-	vcsRun, err := utils.GetLastRun(ctx, true, logger)
+	ws, err := artifacts.New("rightsize", logger)
 	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare resource recommendations", err, logger)
 		return
 	}
+	defer ws.Remove(logger)
 
-	ucsRun, err := utils.GetLastRun(ctx, false, logger)
-	if err != nil {
+	// Format of this request: <something> rightsize <namespace>
+	index := strings.Index(message, rightSizeText)
+	var namespace string
+	if _, err := fmt.Sscanf(message[index+len(rightSizeText):], "%s", &namespace); err != nil {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Format is %s namespace-name (namespace-name is the namespace of the pods you are interested in)",
+				rightSizeText), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
 		return
 	}
 
-	m.RegisterHeader(func() {
-		m.Row(10, func() {
-			m.Col(20, func() {
-				m.Text("Prepared for you by cloudstack e2e assistant.", props.Text{
-					Top:   0,
-					Style: consts.Bold,
-					Align: consts.Center,
-				})
-				m.Text(fmt.Sprintf("Last UCS run: %d. Last VCS run: %d", ucsRun, vcsRun),
-					props.Text{
-						Top:   6,
-						Style: consts.Bold,
-						Align: consts.Center,
-					})
-			})
-		})
-	})
+	recommendations, err := analyze.GetResourceRecommendations(ctx, namespace, logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from,
+			fmt.Sprintf("Failed to get resource recommendations for namespace %s", namespace), err, logger)
+		return
+	}
 
-	m.RegisterFooter(func() {
-		m.Row(10, func() {
-			m.Col(12, func() {
-				m.Text("For any feedback, please reach out to mgianluc@cisco.com", props.Text{
-					Top:   13,
-					Style: consts.BoldItalic,
-					Size:  8,
-					Align: consts.Center,
-				})
-			})
-		})
-	})
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
 
-	_, height := m.GetPageSize()
-	var currentHeight float64 = height
+	if len(recommendations) == 0 {
+		textMessage += fmt.Sprintf("Not enough usage records to recommend resources for pods in namespace %s", namespace)
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
 
-	// Get list of UCS tests. VCS tests are a subsets of UCS.
-	testNames, err := utils.BuildUCSTests(ctx, logger)
-	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to get tests. Err: %v", err))
+	textMessage += fmt.Sprintf("Here are the recommended requests and limits for pods in namespace %s.  \n", namespace)
+	for i := range recommendations {
+		textMessage += recommendations[i].Markdown()
+	}
+	textMessage += "A resources patch for each pod follows.  \n"
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 		return
 	}
 
-	// For each test, get duration plot in both UCS and VCS (if not skipped)
-	// Add those to document
-	for i := range testNames {
-		tmpTestFiles, _, err := getTestFiles(ctx, testNames[i], logger)
+	// Webex accepts a single file per message
+	for i := range recommendations {
+		patchFile, err := analyze.CreateResourcesPatch(ws, recommendations[i], logger)
 		if err != nil {
 			continue
 		}
+		if err := webex_utils.SendMessageWithGraphs(webexClient, roomID,
+			fmt.Sprintf("Resources patch for pod %s", recommendations[i].Pod), []string{patchFile}, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+	}
+}
 
-		var testFile string
+func handleSuppressRequest(ctx context.Context, webexClient *webexteams.Client,
+	roomID, from, message string, logger logr.Logger) {
+	logger.Info("Handling suppress request")
 
-		// both VCS and UCS data available, create a grid
-		if len(tmpTestFiles) == 2 {
-			grids := make([]*gim.Grid, 0)
-			for i := range tmpTestFiles {
-				tmpGrid := gim.Grid{ImageFilePath: tmpTestFiles[i]}
-				grids = append(grids, &tmpGrid)
-			}
-			rgba, err := gim.New(grids, 2, 1).Merge()
-			if err != nil {
-				logger.Info(fmt.Sprintf("Failed to create grid. Error %v", err))
-				return
-			}
-			gridFileName := fmt.Sprintf("/tmp/result_grid_%s.png", testNames[i])
-			file, err := os.Create(gridFileName)
-			if err != nil {
-				logger.Info(fmt.Sprintf("Failed to create grid file. Error %v", err))
-				return
-			}
+	// Format of this request: <something> suppress <namespace:pod> [duration]
+	index := strings.Index(message, analyze.SuppressText)
+	args := strings.Fields(message[index+len(analyze.SuppressText):])
+	if len(args) == 0 {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Format is %s pod-name [duration] (pod-name is as reported in usage alerts, duration i.e. 7d, default 14d)",
+				analyze.SuppressText), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
 
-			if err = png.Encode(file, rgba); err != nil {
-				logger.Info(fmt.Sprintf("Failed to encode grid file. Error %v", err))
-				return
+	duration := defaultSuppressDuration
+	if len(args) > 1 {
+		var err error
+		if duration, err = utils.ParseDuration(args[1]); err != nil {
+			if err := webex_utils.SendMessage(webexClient, roomID,
+				fmt.Sprintf("Invalid duration %q. Examples of valid durations: 12h, 7d", args[1]), logger); err != nil {
+				logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 			}
+			return
+		}
+	}
 
-			testFile = gridFileName
-		} else if len(tmpTestFiles) == 1 {
-			testFile = tmpTestFiles[0]
-		}
-
-		if testFile != "" {
-			m.Row(currentHeight+margin, func() {
-				m.Col(0, func() {
-					err = m.FileImage(testFile, props.Rect{
-						Top:     margin,
-						Left:    margin,
-						Percent: 75,
-					})
-					if err != nil {
-						logger.Info(fmt.Sprintf("Failed to add image %v", err))
-					}
-				})
-			})
-			currentHeight += height
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your request.  \n",
+		from, from)
+	if err := analyze.SuppressUsageAlert(args[0], duration, logger); err != nil {
+		textMessage += fmt.Sprintf("Failed to suppress usage alerts for pod %s. Err: %v", args[0], err)
+	} else {
+		textMessage += fmt.Sprintf("Usage variance alerts for pod %s are suppressed till %s",
+			args[0], time.Now().Add(duration).Format(time.RFC1123))
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleAckRequest(ctx context.Context, webexClient *webexteams.Client,
+	roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling ack request")
+
+	// Format of this request: <something> ack <alert ID>
+	if len(args) == 0 {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Format is %s alert-ID (alert-ID is as reported in alert messages)", analyze.AckText), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your request.  \n",
+		from, from)
+	if a, err := alerts.Ack(args[0], from, logger); err != nil {
+		textMessage += fmt.Sprintf("Failed to acknowledge alert %s. Err: %v", args[0], err)
+	} else {
+		textMessage += fmt.Sprintf("Alert %s acknowledged. It won't be notified again till it resolves.", a.ID())
+	}
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleSnoozeRequest(ctx context.Context, webexClient *webexteams.Client,
+	roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling snooze request")
+
+	// Format of this request: <something> snooze <alert ID> <duration>
+	if len(args) < 2 {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Format is %s alert-ID duration (alert-ID is as reported in alert messages, duration i.e. 7d)",
+				analyze.SnoozeText), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 		}
+		return
 	}
 
-	// Get all report plots and add to summary document
-	files, err := getReportFiles(ctx, logger)
+	duration, err := utils.ParseDuration(args[1])
 	if err != nil {
+		if err := webex_utils.SendMessage(webexClient, roomID,
+			fmt.Sprintf("Invalid duration %q. Examples of valid durations: 12h, 7d", args[1]), logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
 		return
 	}
-	for i := range files {
-		m.Row(currentHeight, func() {
-			m.Col(0, func() {
-				err = m.FileImage(files[i], props.Rect{
-					Top:     margin,
-					Left:    margin,
-					Percent: 75,
-				})
-				if err != nil {
-					logger.Info(fmt.Sprintf("Failed to add image %v", err))
-				}
-			})
-		})
-		currentHeight += height
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your request.  \n",
+		from, from)
+	if a, err := alerts.Snooze(args[0], duration, logger); err != nil {
+		textMessage += fmt.Sprintf("Failed to snooze alert %s. Err: %v", args[0], err)
+	} else {
+		textMessage += fmt.Sprintf("Alert %s snoozed till %s", a.ID(), a.SnoozedUntil.Format(time.RFC1123))
 	}
 
-	summaryFile := "/tmp/summary.pdf"
-	err = m.OutputFileAndClose(summaryFile)
-	if err != nil {
-		os.Exit(1)
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+func handleJobsRequest(ctx context.Context, webexClient *webexteams.Client,
+	roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling jobs request")
+
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your request.  \n",
+		from, from)
+
+	// Format of this request: <something> jobs [run|pause|resume <job name>]
+	if len(args) == 0 {
+		textMessage += getJobsStatus()
+	} else if len(args) != 2 || (args[0] != "run" && args[0] != "pause" && args[0] != "resume") {
+		textMessage += fmt.Sprintf("Format is %s [run|pause|resume job-name]", jobsText)
+	} else if !scheduler.IsAdmin(from) {
+		textMessage += "You are not allowed to run, pause or resume jobs."
+	} else {
+		var err error
+		switch args[0] {
+		case "run":
+			err = scheduler.RunNow(args[1], logger)
+		case "pause":
+			err = scheduler.Pause(args[1], logger)
+		case "resume":
+			err = scheduler.Resume(args[1], logger)
+		}
+		if err != nil {
+			textMessage += fmt.Sprintf("Failed to %s job. Err: %v", args[0], err)
+		} else {
+			textMessage += fmt.Sprintf("Job %s: %s done.", args[1], args[0])
+		}
 	}
 
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// getJobsStatus returns, for each scheduled job, its schedule, last and next run
+func getJobsStatus() string {
+	const timeFormat = "Jan 02 15:04 MST"
+
+	text := ""
+	for _, job := range scheduler.GetStatus() {
+		text += fmt.Sprintf("- **%s** (%s): %s  \n", job.Name, job.Schedule, job.Description)
+		switch {
+		case job.Running:
+			text += fmt.Sprintf("    running since %s", job.LastRun.Format(timeFormat))
+		case job.LastRun.IsZero():
+			text += "    never run"
+		case job.LastError != "":
+			text += fmt.Sprintf("    last run %s failed (%s)", job.LastRun.Format(timeFormat), job.LastError)
+		default:
+			text += fmt.Sprintf("    last run %s took %s", job.LastRun.Format(timeFormat),
+				job.LastDuration.Round(time.Second))
+		}
+		if job.Paused {
+			text += ", paused"
+		} else if !job.NextRun.IsZero() {
+			text += fmt.Sprintf(", next run %s", job.NextRun.Format(timeFormat))
+		}
+		if job.Skipped > 0 {
+			text += fmt.Sprintf(", %d runs skipped as previous one was still running", job.Skipped)
+		}
+		text += "  \n"
+	}
+
+	if text == "" {
+		return "No job is scheduled."
+	}
+	return text
+}
+
+func handleSummaryRequest(ctx context.Context, webexClient *webexteams.Client, jiraClient *jira.Client,
+	roomID, from string, args []string, logger logr.Logger) {
+	logger.Info("Handling summary request")
+
 	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
 		from, from)
-	textMessage += "Please find attached a summary document."
+
+	// Format of this request: <something> summary [sections...]
+	sections, err := summary.ParseSections(args)
+	if err != nil {
+		textMessage += fmt.Sprintf("%v.  \nFormat is %s [%s]...", err, summaryText, strings.Join(summary.GetSections(), "|"))
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	ws, err := artifacts.New("summary", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare summary document", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+
+	summaryFile, err := summary.Generate(ctx, ws, jiraClient, sections, logger)
+	if err != nil {
+		textMessage += fmt.Sprintf("Failed to create summary document. Err: %v", err)
+		if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+		}
+		return
+	}
+
+	textMessage += fmt.Sprintf("Please find attached a summary document (%s).", strings.Join(sections, ", "))
 
 	if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage,
 		[]string{summaryFile}, logger); err != nil {
@@ -607,6 +1331,29 @@ func handleSummaryRequest(ctx context.Context, webexClient *webexteams.Client,
 	}
 }
 
+// sendErrorMessage lets from know request could not be served. failure describes what
+// failed, err why.
+func sendErrorMessage(webexClient *webexteams.Client, roomID, from, failure string, err error, logger logr.Logger) {
+	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
+		from, from)
+	textMessage += fmt.Sprintf("%s. Err: %v", failure, err)
+
+	if err := webex_utils.SendMessage(webexClient, roomID, textMessage, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
+	}
+}
+
+// getCommandArgs returns true if command is the first word of message, bot mention
+// already removed. In such case, it also returns all words following command.
+func getCommandArgs(message, command string) ([]string, bool) {
+	words := strings.Fields(message)
+	if len(words) == 0 || words[0] != command {
+		return nil, false
+	}
+
+	return words[1:], true
+}
+
 // doesMatchTest returns true if message contain a test name along with test name
 // retuns false otherwise
 func doesMatchTest(ctx context.Context, webexClient *webexteams.Client,
@@ -628,40 +1375,26 @@ func doesMatchTest(ctx context.Context, webexClient *webexteams.Client,
 
 func sendMessageWithTestResult(ctx context.Context, webexClient *webexteams.Client,
 	roomID, from, testName string, logger logr.Logger) {
+	ws, err := artifacts.New("test", logger)
+	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, "Failed to prepare test results", err, logger)
+		return
+	}
+	defer ws.Remove(logger)
+
 	textMessage := fmt.Sprintf("Hello 🤚 <@personEmail:%s|%s> thanks for your question.  \n",
 		from, from)
 
-	files, tmpMessage, err := getTestFiles(ctx, testName, logger)
+	files, tmpMessage, err := getTestFiles(ctx, ws, testName, logger)
 	if err != nil {
+		sendErrorMessage(webexClient, roomID, from, fmt.Sprintf("Failed to get test %s results", testName), err, logger)
 		return
 	}
 
 	textMessage += tmpMessage
 
 	if len(files) > 0 {
-		grids := make([]*gim.Grid, 0)
-		for i := range files {
-			tmpGrid := gim.Grid{ImageFilePath: files[i]}
-			grids = append(grids, &tmpGrid)
-		}
-		rgba, err := gim.New(grids, 2, 1).Merge()
-		if err != nil {
-			logger.Info(fmt.Sprintf("Failed to create grid. Error %v", err))
-			return
-		}
-		gridFileName := "/tmp/result_grid.png"
-		file, err := os.Create(gridFileName)
-		if err != nil {
-			logger.Info(fmt.Sprintf("Failed to create grid file. Error %v", err))
-			return
-		}
-
-		if err = png.Encode(file, rgba); err != nil {
-			logger.Info(fmt.Sprintf("Failed to encode grid file. Error %v", err))
-			return
-		}
-
-		if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, []string{gridFileName}, logger); err != nil {
+		if err := webex_utils.SendMessageWithGraphs(webexClient, roomID, textMessage, files, logger); err != nil {
 			logger.Info(fmt.Sprintf("Failed to send message. Err: %v", err))
 		}
 		return
@@ -676,21 +1409,21 @@ func appendResultsToMessage(passedRuns, failedRuns, skippedRuns []int, testName,
 	if len(passedRuns) > 0 {
 		textMessage += fmt.Sprintf("Test **%s** passed in **%s** runs: ", testName, env)
 		for i := range passedRuns {
-			textMessage += fmt.Sprintf("[%d](%s/%d) ", passedRuns[i], vcsLink, passedRuns[i])
+			textMessage += fmt.Sprintf("[%d](%s/%d) ", passedRuns[i], utils.VCSLink, passedRuns[i])
 		}
 		textMessage += "✅  \n"
 	}
 	if len(skippedRuns) > 0 {
 		textMessage += fmt.Sprintf("Test **%s** was skipped in **%s** runs: ", testName, env)
 		for i := range skippedRuns {
-			textMessage += fmt.Sprintf("[%d](%s/%d) ", skippedRuns[i], vcsLink, skippedRuns[i])
+			textMessage += fmt.Sprintf("[%d](%s/%d) ", skippedRuns[i], utils.VCSLink, skippedRuns[i])
 		}
 		textMessage += "⏸  \n"
 	}
 	if len(failedRuns) > 0 {
 		textMessage += fmt.Sprintf("Test **%s** failed in **%s** runs: ", testName, env)
 		for i := range failedRuns {
-			textMessage += fmt.Sprintf("[%d](%s/%d) ", failedRuns[i], vcsLink, failedRuns[i])
+			textMessage += fmt.Sprintf("[%d](%s/%d) ", failedRuns[i], utils.VCSLink, failedRuns[i])
 		}
 		textMessage += "❌  \n"
 	}
@@ -703,13 +1436,21 @@ func initFlags(fs *pflag.FlagSet) {
 		defaultPollInterval,
 		"The minimum interval at which watched resources are reconciled (e.g. 10m)",
 	)
-}
 
-func startCron() {
-	<-gocron.Start()
+	flag.BoolVar(&standalone,
+		"standalone",
+		false,
+		"Run with no leader election (i.e. outside a cluster). Only one instance must run",
+	)
+
+	flag.StringVar(&outputDir,
+		"output-dir",
+		defaultOutputDir,
+		"The directory attachments are written to when running a command or a job locally",
+	)
 }
 
-func getReportFiles(ctx context.Context, logger logr.Logger) ([]string, error) {
+func getReportFiles(ctx context.Context, ws *artifacts.Workspace, logger logr.Logger) ([]string, error) {
 	files := make([]string, 0)
 
 	reportTypes, err := utils.BuildUCSReports(ctx, logger)
@@ -743,32 +1484,29 @@ func getReportFiles(ctx context.Context, logger logr.Logger) ([]string, error) {
 		}
 
 		var rtyp es_utils.Report
-		data := make([]float64, 0)
+		data := make([]es_utils.Report, 0)
 		for _, item := range ucsReports.Each(reflect.TypeOf(rtyp)) {
 			r := item.(es_utils.Report)
 
-			// Discard runs older than a week
+			// Discard runs older than two weeks
 			lastValidTime := time.Now().Add(-14 * 24 * time.Hour)
 			if r.CreatedTime.After(lastValidTime) {
-				data = append(data, float64(r.DurationInMinutes))
+				data = append(data, r)
 			}
 		}
 
 		if len(data) > 0 {
-			// Results are returned with last one first.
-			// Reverse the order while creating a plot
-			utils.Reverse(data)
-			environment := "ucs"
-			mean, _ := stat.MeanStdDev(data, nil)
-			ucsPlot := analyze.CreateDurationPlot(&environment, &reportTypes[i], data, mean, logger)
-			files = append(files, ucsPlot)
+			series := []analyze.Series{{Environment: "ucs", Samples: analyze.GetReportSamples(data)}}
+			if ucsPlot := analyze.CreateDurationPlot(ws, reportTypes[i], series, logger); ucsPlot != "" {
+				files = append(files, ucsPlot)
+			}
 		}
 	}
 
 	return files, nil
 }
 
-func getUsageReportFiles(ctx context.Context, namespace string, logger logr.Logger) ([]string, error) {
+func getUsageReportFiles(ctx context.Context, ws *artifacts.Workspace, namespace string, logger logr.Logger) ([]string, error) {
 	logger.Info(fmt.Sprintf("Collect usage report for pods in namespace: %s", namespace))
 	files := make([]string, 0)
 
@@ -806,7 +1544,7 @@ func getUsageReportFiles(ctx context.Context, namespace string, logger logr.Logg
 		}
 
 		var rtyp es_utils.UsageReport
-		data := make([]float64, 0)
+		data := make([]es_utils.UsageReport, 0)
 		var memoryLimit int64
 		for _, item := range ucsReports.Each(reflect.TypeOf(rtyp)) {
 			r := item.(es_utils.UsageReport)
@@ -814,21 +1552,18 @@ func getUsageReportFiles(ctx context.Context, namespace string, logger logr.Logg
 			if memoryLimit == 0 {
 				memoryLimit = r.MemoryLimit
 			}
-			// Discard runs older than a week
+			// Discard runs older than two weeks
 			lastValidTime := time.Now().Add(-14 * 24 * time.Hour)
 			if r.CreatedTime.After(lastValidTime) {
-				data = append(data, float64(r.Memory))
+				data = append(data, r)
 			}
 		}
 
 		if len(data) > 0 {
-			// Results are returned with last one first.
-			// Reverse the order while creating a plot
-			utils.Reverse(data)
-			environment := "ucs"
-			mean, _ := stat.MeanStdDev(data, nil)
-			ucsPlot := analyze.CreateMemoryPlot(&environment, &reportTypes[i], data, mean, float64(memoryLimit), logger)
-			files = append(files, ucsPlot)
+			series := []analyze.Series{{Environment: "ucs", Samples: analyze.GetUsageSamples(data, false)}}
+			if ucsPlot := analyze.CreateMemoryPlot(ws, reportTypes[i], series, float64(memoryLimit), logger); ucsPlot != "" {
+				files = append(files, ucsPlot)
+			}
 		}
 	}
 
@@ -836,75 +1571,31 @@ func getUsageReportFiles(ctx context.Context, namespace string, logger logr.Logg
 }
 
 // getTestFiles for a given test collects the results in the last 30 runs.
-// Returns location of files with duration plot and a string containing list of runs where it passed/failed/skipped.
-func getTestFiles(ctx context.Context, testName string, logger logr.Logger) ([]string, string, error) {
-	vcsResults, err := es_utils.GetResults(ctx, logger, "", testName, true, false, false, false, false, 30)
+// Returns location of the plot overlaying vcs and ucs durations and a string containing list of runs where it passed/failed/skipped.
+func getTestFiles(ctx context.Context, ws *artifacts.Workspace, testName string, logger logr.Logger) ([]string, string, error) {
+	vcsHistory, err := utils.GetTestHistory(ctx, testName, true, 30, logger)
 	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to get results for test %q. Error %v", testName, err))
 		return nil, "", err
 	}
-	ucsResults, err := es_utils.GetResults(ctx, logger, "", testName, false, true, false, false, false, 30)
+	ucsHistory, err := utils.GetTestHistory(ctx, testName, false, 30, logger)
 	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to get results for test %q. Error %v", testName, err))
 		return nil, "", err
 	}
 
 	var textMessage string
-
-	passedRuns := make([]int, 0)
-	failedRuns := make([]int, 0)
-	skippedRuns := make([]int, 0)
-	var rtyp es_utils.Result
-	vcsData := make([]float64, 0)
-	for _, item := range vcsResults.Each(reflect.TypeOf(rtyp)) {
-		r := item.(es_utils.Result)
-		if r.Result == "passed" {
-			passedRuns = append(passedRuns, r.Run)
-			vcsData = append(vcsData, r.DurationInMinutes)
-		} else if r.Result == "failed" {
-			failedRuns = append(failedRuns, r.Run)
-		} else if r.Result == "skipped" {
-			skippedRuns = append(skippedRuns, r.Run)
-		}
-	}
-	textMessage += appendResultsToMessage(passedRuns, failedRuns, skippedRuns, testName, "vcs")
-
-	passedRuns = make([]int, 0)
-	failedRuns = make([]int, 0)
-	skippedRuns = make([]int, 0)
-	ucsData := make([]float64, 0)
-	for _, item := range ucsResults.Each(reflect.TypeOf(rtyp)) {
-		r := item.(es_utils.Result)
-		if r.Result == "passed" {
-			passedRuns = append(passedRuns, r.Run)
-			ucsData = append(ucsData, r.DurationInMinutes)
-		} else if r.Result == "failed" {
-			failedRuns = append(failedRuns, r.Run)
-		} else if r.Result == "skipped" {
-			skippedRuns = append(skippedRuns, r.Run)
-		}
-	}
-	textMessage += appendResultsToMessage(passedRuns, failedRuns, skippedRuns, testName, "ucs")
+	textMessage += appendResultsToMessage(vcsHistory.Passed, vcsHistory.Failed, vcsHistory.Skipped, testName, "vcs")
+	textMessage += appendResultsToMessage(ucsHistory.Passed, ucsHistory.Failed, ucsHistory.Skipped, testName, "ucs")
 
 	files := make([]string, 0)
 
-	if len(ucsData) > 0 {
-		// Results are returned with last one first.
-		// Reverse the order while creating a plot
-		utils.Reverse(ucsData)
-		environment := "ucs"
-		mean, _ := stat.MeanStdDev(ucsData, nil)
-		ucsPlot := analyze.CreateDurationPlot(&environment, &testName, ucsData, mean, logger)
-		files = append(files, ucsPlot)
-	}
-	if len(vcsData) > 0 {
-		// Results are returned with last one first.
-		// Reverse the order while creating a plot
-		utils.Reverse(vcsData)
-		environment := "vcs"
-		mean, _ := stat.MeanStdDev(vcsData, nil)
-		vcsPlot := analyze.CreateDurationPlot(&environment, &testName, vcsData, mean, logger)
-		files = append(files, vcsPlot)
+	series := []analyze.Series{
+		{Environment: "vcs", Samples: analyze.GetTestSamples(vcsHistory.Results)},
+		{Environment: "ucs", Samples: analyze.GetTestSamples(ucsHistory.Results)},
+	}
+	if len(series[0].Samples)+len(series[1].Samples) > 0 {
+		if plot := analyze.CreateDurationPlot(ws, testName, series, logger); plot != "" {
+			files = append(files, plot)
+		}
 	}
 
 	return files, textMessage, nil
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "webex_bot"
+
+// Dependencies errors are counted for
+const (
+	Webex   = "webex"
+	Jira    = "jira"
+	Elastic = "elastic"
+)
+
+// Outcomes of a scheduled job run
+const (
+	JobSuccess = "success"
+	JobPanic   = "panic"
+	JobSkipped = "skipped"
+)
+
+// durationBuckets covers both quick replies and requests creating plots or documents
+var durationBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+var (
+	messagesHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_handled_total",
+		Help:      "Number of messages handled, per command",
+	}, []string{"command"})
+
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time taken to answer a message, per command",
+		Buckets:   durationBuckets,
+	}, []string{"command"})
+
+	dependencyErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dependency_errors_total",
+		Help:      "Number of failed requests, per dependency (webex, jira, elastic)",
+	}, []string{"dependency"})
+
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Number of scheduled job runs, per job and outcome (success, panic, skipped)",
+	}, []string{"job", "outcome"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time taken by a scheduled job run, per job",
+		Buckets:   durationBuckets,
+	}, []string{"job"})
+
+	alertsFired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_fired_total",
+		Help:      "Number of alerts notified, per analyzer",
+	}, []string{"analyzer"})
+)
+
+func init() {
+	prometheus.MustRegister(messagesHandled, handlerDuration, dependencyErrors,
+		jobRuns, jobDuration, alertsFired)
+}
+
+// Handler returns the handler serving metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveMessage records a message answered with command, taking d
+func ObserveMessage(command string, d time.Duration) {
+	messagesHandled.WithLabelValues(command).Inc()
+	handlerDuration.WithLabelValues(command).Observe(d.Seconds())
+}
+
+// DependencyError records a failed request to dependency
+func DependencyError(dependency string) {
+	dependencyErrors.WithLabelValues(dependency).Inc()
+}
+
+// ObserveJob records a run of job, with outcome, taking d. Duration is not
+// recorded for skipped runs.
+func ObserveJob(job, outcome string, d time.Duration) {
+	jobRuns.WithLabelValues(job, outcome).Inc()
+	if outcome != JobSkipped {
+		jobDuration.WithLabelValues(job).Observe(d.Seconds())
+	}
+}
+
+// AlertsFired records n alerts notified by analyzer
+func AlertsFired(analyzer string, n int) {
+	alertsFired.WithLabelValues(analyzer).Add(float64(n))
+}
@@ -0,0 +1,178 @@
+package routing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/webex_utils"
+)
+
+const (
+	// smtpServerEnv is the env variable containing the SMTP server (host:port).
+	// If not set, email notifications are not available.
+	smtpServerEnv = "E2E_SMTP_SERVER"
+	// smtpFromEnv is the env variable containing the email alerts are sent from
+	smtpFromEnv = "E2E_SMTP_FROM"
+)
+
+// Notifier delivers an alert to an owner
+type Notifier interface {
+	// Notify sends text with files attached to owner. owner is nil
+	// for alerts nobody owns.
+	Notify(owner *Owner, text string, files []string, logger logr.Logger) error
+}
+
+var (
+	// notifiers contains, per channel, the notifier
+	notifiers = make(map[Channel]Notifier)
+
+	// notifiersMux serializes access to notifiers
+	notifiersMux sync.Mutex
+)
+
+// RegisterNotifier registers the notifier used for a channel
+func RegisterNotifier(channel Channel, notifier Notifier) {
+	notifiersMux.Lock()
+	defer notifiersMux.Unlock()
+	notifiers[channel] = notifier
+}
+
+// RegisterWebexNotifiers registers room and direct message notifiers only
+func RegisterWebexNotifiers(webexClient *webexteams.Client, roomID string) {
+	RegisterNotifier(Room, &roomNotifier{webexClient: webexClient, roomID: roomID})
+	RegisterNotifier(Direct, &directNotifier{webexClient: webexClient})
+}
+
+// RegisterDefaultNotifiers registers room and direct message notifiers.
+// Email notifier is registered only if both E2E_SMTP_SERVER and E2E_SMTP_FROM are set.
+func RegisterDefaultNotifiers(webexClient *webexteams.Client, roomID string, logger logr.Logger) {
+	RegisterWebexNotifiers(webexClient, roomID)
+
+	server := os.Getenv(smtpServerEnv)
+	if server == "" {
+		return
+	}
+	from := os.Getenv(smtpFromEnv)
+	if from == "" {
+		logger.Info(fmt.Sprintf("%s is set but %s is not. Email notifications are disabled", smtpServerEnv, smtpFromEnv))
+		return
+	}
+	logger.Info(fmt.Sprintf("Email notifications through %s from %s", server, from))
+	RegisterNotifier(Email, &emailNotifier{server: server, from: from})
+}
+
+// Notify delivers text and files to owner using the owner's preferred channel.
+// Alerts with no owner, or for which preferred channel is not available, are sent
+// to the room.
+func Notify(owner *Owner, text string, files []string, logger logr.Logger) error {
+	notifiersMux.Lock()
+	notifier, ok := notifiers[Room]
+	if owner != nil {
+		if n, found := notifiers[owner.Channel]; found {
+			notifier = n
+			ok = true
+		} else {
+			logger.Info(fmt.Sprintf("No notifier for channel %s. Using room", owner.Channel))
+		}
+	}
+	notifiersMux.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no notifier registered")
+	}
+
+	return notifier.Notify(owner, text, files, logger)
+}
+
+// roomNotifier posts to the webex room mentioning the owner
+type roomNotifier struct {
+	webexClient *webexteams.Client
+	roomID      string
+}
+
+func (n *roomNotifier) Notify(owner *Owner, text string, files []string, logger logr.Logger) error {
+	if owner != nil {
+		text = fmt.Sprintf("Hello 🤚 %s  \n%s", owner.Mention(), text)
+	}
+	return webex_utils.SendMessageWithGraphs(n.webexClient, n.roomID, text, files, logger)
+}
+
+// directNotifier sends a webex direct message to the owner
+type directNotifier struct {
+	webexClient *webexteams.Client
+}
+
+func (n *directNotifier) Notify(owner *Owner, text string, files []string, logger logr.Logger) error {
+	if owner == nil {
+		return fmt.Errorf("direct message needs an owner")
+	}
+	return webex_utils.SendDirectMessageWithGraphs(n.webexClient, owner.Email, text, files, logger)
+}
+
+// emailNotifier sends an email to the owner
+type emailNotifier struct {
+	server string
+	from   string
+}
+
+func (n *emailNotifier) Notify(owner *Owner, text string, files []string, logger logr.Logger) error {
+	if owner == nil {
+		return fmt.Errorf("email needs an owner")
+	}
+
+	boundary := fmt.Sprintf("e2e-bot-%d", time.Now().UnixNano())
+
+	var body bytes.Buffer
+	body.WriteString(fmt.Sprintf("From: %s\r\n", n.from))
+	body.WriteString(fmt.Sprintf("To: %s\r\n", owner.Email))
+	body.WriteString("Subject: Cloudstack e2e alert\r\n")
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%s\r\n\r\n", boundary))
+
+	body.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(text, "  \n", "\r\n"))
+	body.WriteString("\r\n")
+
+	for i := range files {
+		content, err := os.ReadFile(files[i])
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to read file %s", files[i]))
+			continue
+		}
+		fileName := filepath.Base(files[i])
+		contentType := mime.TypeByExtension(filepath.Ext(fileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		body.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		body.WriteString(fmt.Sprintf("Content-Type: %s\r\n", contentType))
+		body.WriteString("Content-Transfer-Encoding: base64\r\n")
+		body.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=%q\r\n\r\n", fileName))
+		encoded := base64.StdEncoding.EncodeToString(content)
+		for len(encoded) > 76 {
+			body.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		body.WriteString(encoded + "\r\n")
+	}
+	body.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+
+	if err := smtp.SendMail(n.server, nil, n.from, []string{owner.Email}, body.Bytes()); err != nil {
+		logger.Info(fmt.Sprintf("Failed to send email to %s. Err: %v", owner.Email, err))
+		return err
+	}
+
+	return nil
+}
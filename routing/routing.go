@@ -0,0 +1,176 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// ownersFileEnv is the env variable containing the path of the owners configuration file
+	ownersFileEnv = "E2E_OWNERS_FILE"
+
+	// emailDomain is used to build the email of an owner with no email configured
+	emailDomain = "cisco.com"
+)
+
+// Channel is how an owner wants to receive alerts
+type Channel string
+
+const (
+	// Room means alerts are sent to the webex room, mentioning the owner
+	Room Channel = "room"
+	// Direct means alerts are sent as webex direct message
+	Direct Channel = "direct"
+	// Email means alerts are sent by email
+	Email Channel = "email"
+)
+
+// Owner is someone receiving alerts
+type Owner struct {
+	// Name is the owner username
+	Name string `json:"name"`
+	// Email is the owner email. If not set <name>@cisco.com is used
+	Email string `json:"email,omitempty"`
+	// Channel is the preferred channel. If not set, Room is used
+	Channel Channel `json:"channel,omitempty"`
+	// Manager is the username of the owner's manager
+	Manager string `json:"manager,omitempty"`
+}
+
+// Config contains owner overrides. It is loaded from the file
+// pointed by E2E_OWNERS_FILE. Example:
+//
+//	{
+//	  "owners": {"mgianluc": {"channel": "direct", "manager": "someone"}},
+//	  "tests": {"test_upgrade": "mgianluc"},
+//	  "reports": {"cluster-ready": "mgianluc"},
+//	  "namespaces": {"cs-system": "mgianluc"}
+//	}
+type Config struct {
+	// Owners contains, per owner username, owner preferences
+	Owners map[string]Owner `json:"owners,omitempty"`
+	// Tests contains, per test name, the owner. It overrides test Maintainer.
+	Tests map[string]string `json:"tests,omitempty"`
+	// Reports contains, per report type, the owner
+	Reports map[string]string `json:"reports,omitempty"`
+	// Namespaces contains, per pod namespace, the owner
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+}
+
+// mux serializes access to owners configuration file
+var mux sync.Mutex
+
+// loadConfig reads the owners configuration file. File is read every time so
+// that changes are picked up with no restart.
+// If E2E_OWNERS_FILE is not set, an empty configuration is returned.
+func loadConfig(logger logr.Logger) *Config {
+	mux.Lock()
+	defer mux.Unlock()
+
+	config := &Config{}
+
+	fileName, ok := os.LookupEnv(ownersFileEnv)
+	if !ok || fileName == "" {
+		return config
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read owners file %s. Err: %v", fileName, err))
+		return config
+	}
+
+	if err := json.Unmarshal(content, config); err != nil {
+		logger.Info(fmt.Sprintf("Failed to parse owners file %s. Err: %v", fileName, err))
+		return &Config{}
+	}
+
+	return config
+}
+
+// GetTestOwner returns the owner of a test. maintainer is the test Maintainer
+// as stored with test results. Configuration file takes precedence.
+func GetTestOwner(testName, maintainer string, logger logr.Logger) string {
+	config := loadConfig(logger)
+	if owner, ok := config.Tests[testName]; ok {
+		return owner
+	}
+	return maintainer
+}
+
+// GetReportOwner returns the owner of a report. report is in the form
+// type[---subType[_name]]. Owner is looked up by report type.
+func GetReportOwner(report string, logger logr.Logger) string {
+	config := loadConfig(logger)
+	if owner, ok := config.Reports[report]; ok {
+		return owner
+	}
+
+	// Look for the longest configured report type report starts with
+	var owner, match string
+	for k, v := range config.Reports {
+		if strings.HasPrefix(report, k) && len(k) > len(match) {
+			match = k
+			owner = v
+		}
+	}
+	return owner
+}
+
+// GetNamespaceOwner returns the owner of pods in namespace
+func GetNamespaceOwner(namespace string, logger logr.Logger) string {
+	config := loadConfig(logger)
+	return config.Namespaces[namespace]
+}
+
+// GetOwner returns the owner with name, including preferences if configured.
+// Returns nil if name is empty.
+func GetOwner(name string, logger logr.Logger) *Owner {
+	if name == "" {
+		return nil
+	}
+
+	config := loadConfig(logger)
+	owner := Owner{Name: name}
+	if o, ok := config.Owners[name]; ok {
+		owner = o
+		owner.Name = name
+	}
+
+	if owner.Email == "" {
+		owner.Email = fmt.Sprintf("%s@%s", name, emailDomain)
+	}
+	if owner.Channel == "" {
+		owner.Channel = Room
+	}
+
+	return &owner
+}
+
+// Group groups subjects per owner. subjectOwner contains, per subject, the owner
+// username. Subjects with no owner are grouped under the empty string.
+// Subjects in each group are sorted.
+func Group(subjects []string, subjectOwner map[string]string) map[string][]string {
+	groups := make(map[string][]string)
+	for i := range subjects {
+		owner := subjectOwner[subjects[i]]
+		groups[owner] = append(groups[owner], subjects[i])
+	}
+
+	for k := range groups {
+		sort.Strings(groups[k])
+	}
+
+	return groups
+}
+
+// Mention returns the markdown to tag owner in a webex message
+func (o *Owner) Mention() string {
+	return fmt.Sprintf("<@personEmail:%s|%s>", o.Email, o.Name)
+}
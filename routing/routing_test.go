@@ -0,0 +1,186 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+const ownersFile = `{
+  "owners": {"alice": {"channel": "direct", "manager": "bob"}, "carol": {"email": "carol@example.com"}},
+  "tests": {"test_upgrade": "alice"},
+  "reports": {"cluster": "carol", "cluster---ready": "alice"},
+  "namespaces": {"cs-system": "alice"}
+}`
+
+// setOwnersFile writes content to a temporary owners file and points E2E_OWNERS_FILE to it
+func setOwnersFile(t *testing.T, content string) {
+	fileName := filepath.Join(t.TempDir(), "owners.json")
+	if err := os.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write owners file: %v", err)
+	}
+	t.Setenv(ownersFileEnv, fileName)
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected *Config
+	}{
+		{
+			name:    "valid file",
+			content: `{"tests": {"t1": "alice"}, "namespaces": {"ns": "bob"}}`,
+			expected: &Config{
+				Tests:      map[string]string{"t1": "alice"},
+				Namespaces: map[string]string{"ns": "bob"},
+			},
+		},
+		{name: "empty object", content: `{}`, expected: &Config{}},
+		{name: "invalid json", content: `{"tests": `, expected: &Config{}},
+		{name: "wrong type", content: `{"tests": ["t1"]}`, expected: &Config{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOwnersFile(t, tt.content)
+			if got := loadConfig(logr.Discard()); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("loadConfig() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfigNoFile(t *testing.T) {
+	t.Setenv(ownersFileEnv, "")
+	if got := loadConfig(logr.Discard()); !reflect.DeepEqual(got, &Config{}) {
+		t.Errorf("expected empty configuration, got %+v", got)
+	}
+
+	t.Setenv(ownersFileEnv, filepath.Join(t.TempDir(), "missing.json"))
+	if got := loadConfig(logr.Discard()); !reflect.DeepEqual(got, &Config{}) {
+		t.Errorf("expected empty configuration, got %+v", got)
+	}
+}
+
+func TestGetTestOwner(t *testing.T) {
+	setOwnersFile(t, ownersFile)
+
+	tests := []struct {
+		testName   string
+		maintainer string
+		expected   string
+	}{
+		{testName: "test_upgrade", maintainer: "dave", expected: "alice"},
+		{testName: "test_other", maintainer: "dave", expected: "dave"},
+		{testName: "test_other", expected: ""},
+	}
+
+	for _, tt := range tests {
+		if got := GetTestOwner(tt.testName, tt.maintainer, logr.Discard()); got != tt.expected {
+			t.Errorf("GetTestOwner(%q, %q) = %q, expected %q", tt.testName, tt.maintainer, got, tt.expected)
+		}
+	}
+}
+
+func TestGetReportOwner(t *testing.T) {
+	setOwnersFile(t, ownersFile)
+
+	tests := []struct {
+		report   string
+		expected string
+	}{
+		{report: "cluster", expected: "carol"},
+		{report: "cluster---ready", expected: "alice"},
+		{report: "cluster---ready_name", expected: "alice"},
+		{report: "cluster---delete", expected: "carol"},
+		{report: "upgrade", expected: ""},
+	}
+
+	for _, tt := range tests {
+		if got := GetReportOwner(tt.report, logr.Discard()); got != tt.expected {
+			t.Errorf("GetReportOwner(%q) = %q, expected %q", tt.report, got, tt.expected)
+		}
+	}
+}
+
+func TestGetNamespaceOwner(t *testing.T) {
+	setOwnersFile(t, ownersFile)
+
+	if got := GetNamespaceOwner("cs-system", logr.Discard()); got != "alice" {
+		t.Errorf("expected alice, got %q", got)
+	}
+	if got := GetNamespaceOwner("default", logr.Discard()); got != "" {
+		t.Errorf("expected no owner, got %q", got)
+	}
+}
+
+func TestGetOwner(t *testing.T) {
+	setOwnersFile(t, ownersFile)
+
+	tests := []struct {
+		name     string
+		expected *Owner
+	}{
+		{name: ""},
+		{name: "alice", expected: &Owner{Name: "alice", Email: "alice@" + emailDomain, Channel: Direct, Manager: "bob"}},
+		{name: "carol", expected: &Owner{Name: "carol", Email: "carol@example.com", Channel: Room}},
+		{name: "dave", expected: &Owner{Name: "dave", Email: "dave@" + emailDomain, Channel: Room}},
+	}
+
+	for _, tt := range tests {
+		if got := GetOwner(tt.name, logr.Discard()); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("GetOwner(%q) = %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	subjects := []string{"t3", "t1", "t2", "t4"}
+	subjectOwner := map[string]string{"t1": "alice", "t3": "alice", "t2": "bob"}
+
+	expected := map[string][]string{
+		"alice": {"t1", "t3"},
+		"bob":   {"t2"},
+		"":      {"t4"},
+	}
+	if got := Group(subjects, subjectOwner); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Group() = %v, expected %v", got, expected)
+	}
+}
+
+func TestRegisterEmailNotifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		from     string
+		expected bool
+	}{
+		{name: "no server"},
+		{name: "no sender", server: "smtp.example.com:25"},
+		{name: "server and sender", server: "smtp.example.com:25", from: "bot@example.com", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(smtpServerEnv, tt.server)
+			t.Setenv(smtpFromEnv, tt.from)
+
+			notifiersMux.Lock()
+			notifiers = make(map[Channel]Notifier)
+			notifiersMux.Unlock()
+
+			RegisterDefaultNotifiers(nil, "room", logr.Discard())
+
+			notifiersMux.Lock()
+			_, ok := notifiers[Email]
+			notifiersMux.Unlock()
+			if ok != tt.expected {
+				t.Errorf("email notifier registered: %v, expected %v", ok, tt.expected)
+			}
+		})
+	}
+}
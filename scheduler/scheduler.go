@@ -0,0 +1,379 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Timezone database is embedded so E2E_TIMEZONE works in images with no tzdata
+	_ "time/tzdata"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+
+	"github.com/gianlucam76/webex_bot/metrics"
+	"github.com/gianlucam76/webex_bot/state"
+)
+
+const (
+	// timezoneEnv is the env variable containing the timezone (i.e. America/Los_Angeles)
+	// schedules are evaluated in. If not set, local time is used.
+	timezoneEnv = "E2E_TIMEZONE"
+
+	// adminsEnv is the env variable containing the comma separated list of emails
+	// of users allowed to run, pause and resume jobs
+	adminsEnv = "E2E_JOB_ADMINS"
+)
+
+// Job is a function run on a schedule
+type Job struct {
+	// Name identifies the job
+	Name string
+	// Description is a short description of what job does
+	Description string
+	// Schedule is a cron expression (minute hour day-of-month month day-of-week)
+	// or a descriptor such as "@every 10m"
+	Schedule string
+	// Jitter is the maximum random delay added to every scheduled run, so that jobs
+	// scheduled at the same time do not all query elastic DB and jira together
+	Jitter time.Duration
+	// Run runs the job once
+	Run func()
+}
+
+// Status is the state of a registered job
+type Status struct {
+	Name        string
+	Description string
+	Schedule    string
+	Paused      bool
+	Running     bool
+	// LastRun is when last run started. Zero if job never ran.
+	LastRun      time.Time
+	LastDuration time.Duration
+	// LastError is set if last run panicked
+	LastError string
+	NextRun   time.Time
+	// Skipped is the number of scheduled runs skipped because previous run was still going
+	Skipped int
+}
+
+// entry is a registered job along with its state
+type entry struct {
+	job     Job
+	id      cron.EntryID
+	paused  bool
+	running bool
+
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	skipped      int
+}
+
+var (
+	// c runs the registered jobs
+	c *cron.Cron
+
+	// entries contains registered jobs. Key is job name.
+	entries = make(map[string]*entry)
+
+	// pausedFilename is the file where names of paused jobs are persisted
+	pausedFilename = state.GetPath("paused_jobs.json")
+
+	// paused contains, per job name, whether job is paused. It includes jobs not
+	// registered yet. Nil till read from pausedFilename.
+	paused map[string]bool
+
+	// mux serializes access to c, entries, paused and pausedFilename
+	mux sync.Mutex
+)
+
+// getCron returns the cron instance, creating it on first use
+func getCron(logger logr.Logger) *cron.Cron {
+	if c != nil {
+		return c
+	}
+
+	location := time.Local
+	if tz, ok := os.LookupEnv(timezoneEnv); ok && tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to load timezone %s. Using local time. Err: %v", tz, err))
+		} else {
+			location = l
+		}
+	}
+
+	c = cron.New(cron.WithLocation(location))
+	return c
+}
+
+// Register schedules job. Scheduled runs start only after Start is called.
+func Register(job Job, logger logr.Logger) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if _, ok := entries[job.Name]; ok {
+		err := fmt.Errorf("job %s already registered", job.Name)
+		logger.Info(fmt.Sprintf("Failed to register job. Err: %v", err))
+		return err
+	}
+
+	if err := loadPaused(logger); err != nil {
+		return err
+	}
+
+	e := &entry{job: job, paused: paused[job.Name]}
+	id, err := getCron(logger).AddFunc(job.Schedule, func() { runScheduled(e, logger) })
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to register job %s with schedule %q. Err: %v", job.Name, job.Schedule, err))
+		return err
+	}
+	e.id = id
+	entries[job.Name] = e
+
+	return nil
+}
+
+// Start starts running registered jobs on schedule till ctx is done
+func Start(ctx context.Context, logger logr.Logger) {
+	if strings.TrimSpace(os.Getenv(adminsEnv)) == "" {
+		logger.Info(fmt.Sprintf("%s not set. Nobody is allowed to run, pause or resume jobs", adminsEnv))
+	}
+
+	mux.Lock()
+	cr := getCron(logger)
+	mux.Unlock()
+
+	cr.Start()
+	go func() {
+		<-ctx.Done()
+		<-cr.Stop().Done()
+	}()
+}
+
+// GetStatus returns the status of all registered jobs, sorted by name
+func GetStatus() []Status {
+	mux.Lock()
+	defer mux.Unlock()
+
+	result := make([]Status, 0, len(entries))
+	for name, e := range entries {
+		status := Status{
+			Name:         name,
+			Description:  e.job.Description,
+			Schedule:     e.job.Schedule,
+			Paused:       e.paused,
+			Running:      e.running,
+			LastRun:      e.lastRun,
+			LastDuration: e.lastDuration,
+			LastError:    e.lastError,
+			Skipped:      e.skipped,
+		}
+		if c != nil {
+			status.NextRun = c.Entry(e.id).Next
+		}
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// RunNow starts job right away, even if paused. Returns an error if job
+// is not registered or is already running.
+func RunNow(name string, logger logr.Logger) error {
+	e, err := getEntry(name)
+	if err != nil {
+		return err
+	}
+
+	if !start(e) {
+		return fmt.Errorf("job %s is already running", name)
+	}
+	go run(e, logger)
+
+	return nil
+}
+
+// Pause stops scheduled runs of job till Resume is called. Jobs stay paused
+// across bot restarts.
+func Pause(name string, logger logr.Logger) error {
+	return setPaused(name, true, logger)
+}
+
+// Resume resumes scheduled runs of a paused job
+func Resume(name string, logger logr.Logger) error {
+	return setPaused(name, false, logger)
+}
+
+// IsAdmin returns true if email is one of the users allowed to run, pause and resume jobs
+func IsAdmin(email string) bool {
+	for _, admin := range strings.Split(os.Getenv(adminsEnv), ",") {
+		admin = strings.TrimSpace(admin)
+		if admin != "" && strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func setPaused(name string, isPaused bool, logger logr.Logger) error {
+	e, err := getEntry(name)
+	if err != nil {
+		return err
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if err := loadPaused(logger); err != nil {
+		return err
+	}
+	paused[name] = isPaused
+	if err := storePaused(logger); err != nil {
+		// Keep in memory state consistent with what is persisted
+		paused[name] = e.paused
+		return err
+	}
+	e.paused = isPaused
+
+	return nil
+}
+
+// loadPaused reads names of paused jobs from pausedFilename, if not done already.
+// Must be called with mux held.
+func loadPaused(logger logr.Logger) error {
+	if paused != nil {
+		return nil
+	}
+
+	names := make([]string, 0)
+	if _, err := os.Stat(pausedFilename); err == nil {
+		content, err := os.ReadFile(pausedFilename)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to read file %s with paused jobs. Err: %v", pausedFilename, err))
+			return err
+		}
+
+		if err := json.Unmarshal(content, &names); err != nil {
+			logger.Info(fmt.Sprintf("Failed to parse file %s with paused jobs. Err: %v", pausedFilename, err))
+			return err
+		}
+	}
+
+	paused = make(map[string]bool)
+	for i := range names {
+		paused[names[i]] = true
+	}
+	return nil
+}
+
+// storePaused saves names of paused jobs to pausedFilename. Must be called with mux held.
+func storePaused(logger logr.Logger) error {
+	names := make([]string, 0, len(paused))
+	for name := range paused {
+		if paused[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	content, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to marshal paused jobs. Err: %v", err))
+		return err
+	}
+
+	if err := os.WriteFile(pausedFilename, content, 0600); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write file %s with paused jobs. Err: %v", pausedFilename, err))
+		return err
+	}
+
+	return nil
+}
+
+func getEntry(name string) (*entry, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	e, ok := entries[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown job %s", name)
+	}
+	return e, nil
+}
+
+// runScheduled is invoked by cron. Job is skipped if paused or if previous run
+// is still going.
+func runScheduled(e *entry, logger logr.Logger) {
+	mux.Lock()
+	isPaused := e.paused
+	mux.Unlock()
+	if isPaused {
+		logger.Info(fmt.Sprintf("Job %s is paused. Skipping run", e.job.Name))
+		metrics.ObserveJob(e.job.Name, metrics.JobSkipped, 0)
+		return
+	}
+
+	if e.job.Jitter > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(e.job.Jitter))))
+	}
+
+	if !start(e) {
+		mux.Lock()
+		e.skipped++
+		mux.Unlock()
+		logger.Info(fmt.Sprintf("Job %s is still running. Skipping run", e.job.Name))
+		metrics.ObserveJob(e.job.Name, metrics.JobSkipped, 0)
+		return
+	}
+	run(e, logger)
+}
+
+// start marks e as running. Returns false if e is already running.
+func start(e *entry) bool {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if e.running {
+		return false
+	}
+	e.running = true
+	e.lastRun = time.Now()
+
+	return true
+}
+
+// run runs e, which must be marked as running. A panic is recovered and recorded
+// as last error, so a failing job does not take down the bot.
+func run(e *entry, logger logr.Logger) {
+	logger.Info(fmt.Sprintf("Running job %s", e.job.Name))
+
+	lastError := ""
+	defer func() {
+		outcome := metrics.JobSuccess
+		if r := recover(); r != nil {
+			lastError = fmt.Sprintf("panic: %v", r)
+			outcome = metrics.JobPanic
+			logger.Info(fmt.Sprintf("Job %s panicked. Err: %v\n%s", e.job.Name, r, debug.Stack()))
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		e.running = false
+		e.lastDuration = time.Since(e.lastRun)
+		e.lastError = lastError
+		metrics.ObserveJob(e.job.Name, outcome, e.lastDuration)
+	}()
+
+	e.job.Run()
+}
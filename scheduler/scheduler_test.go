@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// reset clears registered jobs and makes paused jobs persisted in a test directory
+func reset(t *testing.T) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	c = nil
+	entries = make(map[string]*entry)
+	paused = nil
+	pausedFilename = filepath.Join(t.TempDir(), "paused_jobs.json")
+}
+
+func TestRunScheduledJitter(t *testing.T) {
+	reset(t)
+
+	jitter := 50 * time.Millisecond
+	done := make(chan time.Time, 1)
+	e := &entry{job: Job{Name: "jitter", Jitter: jitter, Run: func() { done <- time.Now() }}}
+
+	start := time.Now()
+	runScheduled(e, logr.Discard())
+
+	select {
+	case ranAt := <-done:
+		if delay := ranAt.Sub(start); delay > jitter+20*time.Millisecond {
+			t.Errorf("job ran after %s, expected within %s", delay, jitter)
+		}
+	default:
+		t.Fatal("job did not run")
+	}
+}
+
+func TestRunScheduledOverlap(t *testing.T) {
+	reset(t)
+
+	release := make(chan struct{})
+	runs := 0
+	e := &entry{job: Job{Name: "overlap", Run: func() { runs++; <-release }}}
+
+	if !start(e) {
+		t.Fatal("failed to start job")
+	}
+	finished := make(chan struct{})
+	go func() {
+		run(e, logr.Discard())
+		close(finished)
+	}()
+
+	runScheduled(e, logr.Discard())
+	runScheduled(e, logr.Discard())
+	close(release)
+	<-finished
+
+	if runs != 1 {
+		t.Errorf("job ran %d times, expected 1", runs)
+	}
+	if e.skipped != 2 {
+		t.Errorf("skipped %d runs, expected 2", e.skipped)
+	}
+	if e.running {
+		t.Error("job still marked as running")
+	}
+}
+
+func TestRunScheduledPaused(t *testing.T) {
+	reset(t)
+
+	ran := false
+	e := &entry{job: Job{Name: "paused", Run: func() { ran = true }}, paused: true}
+	runScheduled(e, logr.Discard())
+
+	if ran {
+		t.Error("paused job ran")
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	reset(t)
+
+	e := &entry{job: Job{Name: "panic", Run: func() { panic("boom") }}}
+	if !start(e) {
+		t.Fatal("failed to start job")
+	}
+	run(e, logr.Discard())
+
+	if e.lastError != "panic: boom" || e.running {
+		t.Errorf("got lastError %q running %v, expected panic recorded and job not running", e.lastError, e.running)
+	}
+}
+
+func TestPausePersisted(t *testing.T) {
+	reset(t)
+
+	job := Job{Name: "persisted", Schedule: "@hourly", Run: func() {}}
+	if err := Register(job, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Pause(job.Name, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Pause("unknown", logr.Discard()); err == nil {
+		t.Error("expected error pausing unknown job")
+	}
+
+	// Simulate a restart
+	filename := pausedFilename
+	reset(t)
+	pausedFilename = filename
+	if err := Register(job, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := GetStatus(); len(status) != 1 || !status[0].Paused {
+		t.Fatalf("job not paused after restart: %+v", status)
+	}
+
+	if err := Resume(job.Name, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reset(t)
+	pausedFilename = filename
+	if err := Register(job, logr.Discard()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := GetStatus(); len(status) != 1 || status[0].Paused {
+		t.Fatalf("job paused after resume and restart: %+v", status)
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	t.Setenv(adminsEnv, " alice@example.com, ,Bob@Example.com")
+
+	tests := []struct {
+		email    string
+		expected bool
+	}{
+		{email: "alice@example.com", expected: true},
+		{email: "bob@example.com", expected: true},
+		{email: "carol@example.com", expected: false},
+		{email: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsAdmin(tt.email); got != tt.expected {
+			t.Errorf("IsAdmin(%q) = %v, expected %v", tt.email, got, tt.expected)
+		}
+	}
+
+	t.Setenv(adminsEnv, "")
+	if IsAdmin("alice@example.com") {
+		t.Error("expected no admin when env is empty")
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/api"
+	"github.com/gianlucam76/webex_bot/dashboard"
+	"github.com/gianlucam76/webex_bot/health"
+	"github.com/gianlucam76/webex_bot/leader"
+	"github.com/gianlucam76/webex_bot/metrics"
+)
+
+const (
+	// serverAddrEnv is the env variable containing the address the bot HTTP server listens on
+	serverAddrEnv     = "E2E_SERVER_ADDR"
+	defaultServerAddr = ":9443"
+)
+
+// Start serves, in the background, dashboard, JSON API, health, readiness and
+// Prometheus metrics till ctx is cancelled.
+// Server listens on E2E_SERVER_ADDR (default :9443).
+// Every replica serves health, readiness and metrics. Dashboard and JSON API read state
+// (history database, alerts) owned by the leader, so only the leader serves them. Leader
+// pod is labeled role=leader and the Service exposing them selects such label.
+func Start(ctx context.Context, webexClient *webexteams.Client, jiraClient *jira.Client, logger logr.Logger) {
+	addr := defaultServerAddr
+	if v, ok := os.LookupEnv(serverAddrEnv); ok && v != "" {
+		addr = v
+	}
+
+	leaderHandler := http.NewServeMux()
+	dashboard.Register(ctx, leaderHandler, jiraClient, logger)
+	api.Register(ctx, leaderHandler, jiraClient, logger)
+
+	handler := http.NewServeMux()
+	health.Register(ctx, handler, webexClient, jiraClient, logger)
+	handler.Handle("/metrics", metrics.Handler())
+	handler.Handle("/", onLeader(leaderHandler))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	go func() {
+		logger.Info(fmt.Sprintf("HTTP server listening on %s", addr))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Info(fmt.Sprintf("HTTP server stopped. Err: %v", err))
+		}
+	}()
+}
+
+// onLeader returns a handler which passes requests to h on the leader and rejects
+// them on any other replica. Service does not route to followers, so those are
+// requests sent to a follower pod directly.
+func onLeader(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !leader.IsLeader() {
+			http.Error(w, "this replica is not the leader", http.StatusMisdirectedRequest)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
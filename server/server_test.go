@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gianlucam76/webex_bot/leader"
+)
+
+func TestOnLeader(t *testing.T) {
+	h := onLeader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/section/overview", nil))
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusMisdirectedRequest {
+		t.Errorf("follower: got status %d, expected %d", w.Code, http.StatusMisdirectedRequest)
+	}
+
+	_ = leader.Run(context.TODO(), true, func(ctx context.Context) {
+		if w := serve(); w.Code != http.StatusOK {
+			t.Errorf("leader: got status %d, expected %d", w.Code, http.StatusOK)
+		}
+	}, logr.Discard())
+
+	if w := serve(); w.Code != http.StatusMisdirectedRequest {
+		t.Errorf("former leader: got status %d, expected %d", w.Code, http.StatusMisdirectedRequest)
+	}
+}
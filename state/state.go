@@ -0,0 +1,24 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	// stateDirEnv is the env variable containing the directory where bot state (alerts,
+	// watchers, paused jobs, history database, last answered message) is persisted.
+	// When running more than one replica, it must be on a volume shared by all of them,
+	// so that a new leader picks up where the previous one left off.
+	stateDirEnv     = "E2E_STATE_DIR"
+	defaultStateDir = "/tmp"
+)
+
+// GetPath returns the location of the state file named name
+func GetPath(name string) string {
+	dir := defaultStateDir
+	if v, ok := os.LookupEnv(stateDirEnv); ok && v != "" {
+		dir = v
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,644 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+
+	es_utils "github.com/gianlucam76/cs-e2e-result/es_utils"
+	"github.com/gianlucam76/webex_bot/alerts"
+	"github.com/gianlucam76/webex_bot/analyze"
+	"github.com/gianlucam76/webex_bot/artifacts"
+	"github.com/gianlucam76/webex_bot/history"
+	"github.com/gianlucam76/webex_bot/utils"
+)
+
+// Sections a summary document can contain
+const (
+	SectionOverview = "overview"
+	SectionFailures = "failures"
+	SectionIssues   = "issues"
+	SectionTests    = "tests"
+	SectionReports  = "reports"
+	SectionUsage    = "usage"
+	SectionAlerts   = "alerts"
+)
+
+const (
+	// Time range considered for pass/fail tables and top failing tests
+	resultRange = 7 * 24 * time.Hour
+
+	// Time range considered for plots and usage
+	plotRange = 14 * 24 * time.Hour
+
+	// Maximum number of runs, per environment, listed in overview
+	maxOverviewRuns = 15
+
+	// Number of top failing tests, per environment, listed
+	topFailingTests = 10
+
+	// Maximum number of pods listed in usage section. Memory usage is
+	// plotted for the first usagePlots of those.
+	maxUsagePods = 25
+	usagePlots   = 6
+
+	// Page margin and height of a row containing a plot, in mm
+	margin     = 10
+	plotHeight = 115
+)
+
+// Table is a table in a section
+type Table struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+	// gridSizes are the column widths. They must sum up to 12.
+	gridSizes []uint
+}
+
+// Section is the content of a section of the summary document
+type Section struct {
+	Name  string
+	Title string
+	// Text lines shown at the beginning of the section
+	Text   []string
+	Tables []Table
+	// Images are plots shown at the end of the section
+	Images []string
+	// page is where the section starts
+	page int
+}
+
+// sectionTitles contains, per section, its title in the document
+var sectionTitles = map[string]string{
+	SectionOverview: "Pass/fail per environment",
+	SectionFailures: "Top failing tests",
+	SectionIssues:   "Open issues",
+	SectionTests:    "Test durations",
+	SectionReports:  "Report durations",
+	SectionUsage:    "Memory usage",
+	SectionAlerts:   "Alert history",
+}
+
+// GetSections returns all sections, in the order they appear in the document
+func GetSections() []string {
+	return []string{SectionOverview, SectionFailures, SectionIssues, SectionTests, SectionReports, SectionUsage, SectionAlerts}
+}
+
+// ParseSections returns the sections requested in args. If args is empty, all
+// sections are returned.
+func ParseSections(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return GetSections(), nil
+	}
+
+	requested := make(map[string]bool)
+	for i := range args {
+		name := strings.ToLower(args[i])
+		if _, ok := sectionTitles[name]; !ok {
+			return nil, fmt.Errorf("unknown section %q. Valid ones are %s", args[i], strings.Join(GetSections(), ", "))
+		}
+		requested[name] = true
+	}
+
+	// Sections always appear in the same order, no matter the order they were requested in
+	sections := make([]string, 0)
+	for _, name := range GetSections() {
+		if requested[name] {
+			sections = append(sections, name)
+		}
+	}
+
+	return sections, nil
+}
+
+// Generate creates, in ws, a PDF document with a cover page, a table of contents and
+// the requested sections. Returns the document location.
+func Generate(ctx context.Context, ws *artifacts.Workspace, jiraClient *jira.Client,
+	sectionNames []string, logger logr.Logger) (string, error) {
+	vcsRun, err := utils.GetLastRun(ctx, true, logger)
+	if err != nil {
+		return "", err
+	}
+
+	ucsRun, err := utils.GetLastRun(ctx, false, logger)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	sections := Collect(ctx, ws, jiraClient, sectionNames, logger)
+
+	// Pages sections start at are only known once document is rendered. First pass
+	// collects those, second one renders table of contents with correct page numbers.
+	_ = render(sections, vcsRun, ucsRun, now)
+	m := render(sections, vcsRun, ucsRun, now)
+
+	fileName := ws.Path("summary.pdf")
+	if err := m.OutputFileAndClose(fileName); err != nil {
+		logger.Info(fmt.Sprintf("Failed to write summary document. Err: %v", err))
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// Collect returns the content of the requested sections. Plots are created in ws.
+// Failing to collect data for a section does not fail the others: the error is
+// reported in the section itself.
+func Collect(ctx context.Context, ws *artifacts.Workspace, jiraClient *jira.Client,
+	sectionNames []string, logger logr.Logger) []*Section {
+	now := time.Now()
+	sections := make([]*Section, len(sectionNames))
+	for i := range sectionNames {
+		s := &Section{Name: sectionNames[i], Title: sectionTitles[sectionNames[i]]}
+		var err error
+		switch s.Name {
+		case SectionOverview:
+			err = addOverview(s, now, logger)
+		case SectionFailures:
+			err = addFailures(s, now, logger)
+		case SectionIssues:
+			err = addIssues(ctx, s, jiraClient, logger)
+		case SectionTests:
+			err = addTestPlots(s, ws, now, logger)
+		case SectionReports:
+			err = addReportPlots(s, ws, now, logger)
+		case SectionUsage:
+			err = addUsage(s, ws, now, logger)
+		case SectionAlerts:
+			err = addAlerts(s, logger)
+		default:
+			err = fmt.Errorf("unknown section %q", s.Name)
+		}
+		if err != nil {
+			s.Text = append(s.Text, fmt.Sprintf("Failed to collect data for this section. Err: %v", err))
+		}
+		sections[i] = s
+	}
+
+	return sections
+}
+
+// render returns the summary document. Page each section starts at is stored in the section.
+func render(sections []*Section, vcsRun, ucsRun int64, now time.Time) pdf.Maroto {
+	m := pdf.NewMaroto(consts.Portrait, consts.A4)
+	m.SetPageMargins(margin, margin, margin)
+
+	m.RegisterHeader(func() {
+		m.Row(10, func() {
+			m.Col(12, func() {
+				m.Text("Prepared for you by cloudstack e2e assistant.", props.Text{
+					Top:   0,
+					Style: consts.Bold,
+					Align: consts.Center,
+				})
+				m.Text(fmt.Sprintf("Last UCS run: %d. Last VCS run: %d", ucsRun, vcsRun),
+					props.Text{
+						Top:   6,
+						Style: consts.Bold,
+						Align: consts.Center,
+					})
+			})
+		})
+	})
+
+	m.RegisterFooter(func() {
+		m.Row(10, func() {
+			m.Col(12, func() {
+				m.Text("For any feedback, please reach out to mgianluc@cisco.com", props.Text{
+					Top:   13,
+					Style: consts.BoldItalic,
+					Size:  8,
+					Align: consts.Center,
+				})
+			})
+		})
+	})
+
+	// Cover page
+	m.Row(80, func() {
+		m.ColSpace(12)
+	})
+	m.Row(20, func() {
+		m.Col(12, func() {
+			m.Text("E2E summary", props.Text{Style: consts.Bold, Size: 28, Align: consts.Center})
+		})
+	})
+	m.Row(10, func() {
+		m.Col(12, func() {
+			m.Text(now.Format("Monday, January 2 2006 15:04 MST"), props.Text{Size: 12, Align: consts.Center})
+		})
+	})
+	m.Row(10, func() {
+		m.Col(12, func() {
+			m.Text(fmt.Sprintf("Last UCS run: %d", ucsRun), props.Text{Size: 12, Align: consts.Center})
+		})
+	})
+	m.Row(10, func() {
+		m.Col(12, func() {
+			m.Text(fmt.Sprintf("Last VCS run: %d", vcsRun), props.Text{Size: 12, Align: consts.Center})
+		})
+	})
+
+	// Table of contents
+	m.AddPage()
+	addTitle(m, "Table of contents")
+	for i := range sections {
+		s := sections[i]
+		m.Row(8, func() {
+			m.Col(10, func() {
+				m.Text(fmt.Sprintf("%d. %s", i+1, s.Title), props.Text{Size: 11})
+			})
+			m.Col(2, func() {
+				m.Text(fmt.Sprintf("%d", s.page), props.Text{Size: 11, Align: consts.Right})
+			})
+		})
+	}
+
+	for i := range sections {
+		m.AddPage()
+		addTitle(m, fmt.Sprintf("%d. %s", i+1, sections[i].Title))
+		// Pages are numbered from zero
+		sections[i].page = m.GetCurrentPage() + 1
+		renderSection(m, sections[i])
+	}
+
+	return m
+}
+
+// addTitle adds a row with a section title
+func addTitle(m pdf.Maroto, title string) {
+	m.Row(14, func() {
+		m.Col(12, func() {
+			m.Text(title, props.Text{Top: 3, Style: consts.Bold, Size: 16})
+		})
+	})
+}
+
+// renderSection adds section text, tables and plots to the document
+func renderSection(m pdf.Maroto, s *Section) {
+	for i := range s.Text {
+		text := s.Text[i]
+		m.Row(7, func() {
+			m.Col(12, func() {
+				m.Text(text, props.Text{Size: 10})
+			})
+		})
+	}
+
+	for i := range s.Tables {
+		t := &s.Tables[i]
+		m.Row(10, func() {
+			m.Col(12, func() {
+				m.Text(t.Title, props.Text{Top: 3, Style: consts.Bold, Size: 12})
+			})
+		})
+		if len(t.Rows) == 0 {
+			m.Row(7, func() {
+				m.Col(12, func() {
+					m.Text("No data", props.Text{Size: 10, Style: consts.Italic})
+				})
+			})
+			continue
+		}
+		m.TableList(t.Header, t.Rows, props.TableList{
+			HeaderProp:  props.TableListContent{Size: 9, Style: consts.Bold, GridSizes: t.gridSizes},
+			ContentProp: props.TableListContent{Size: 8, GridSizes: t.gridSizes},
+			Align:       consts.Left,
+			Line:        true,
+		})
+	}
+
+	for i := range s.Images {
+		image := s.Images[i]
+		m.Row(plotHeight, func() {
+			m.Col(12, func() {
+				// An image which cannot be added is simply left out
+				_ = m.FileImage(image, props.Rect{Center: true, Percent: 95})
+			})
+		})
+	}
+}
+
+// addOverview adds to s, per environment, a table with the runs in the last week
+func addOverview(s *Section, now time.Time, logger logr.Logger) error {
+	for _, env := range []string{"ucs", "vcs"} {
+		runs, err := history.GetRuns(env, now.Add(-resultRange), now, logger)
+		if err != nil {
+			return err
+		}
+
+		failedRuns := 0
+		var passed, total int
+		for i := range runs {
+			if runs[i].Failed > 0 {
+				failedRuns++
+			}
+			passed += runs[i].Passed
+			total += runs[i].Passed + runs[i].Failed
+		}
+		text := fmt.Sprintf("%s: %d runs in the last week, %d with failures.", strings.ToUpper(env), len(runs), failedRuns)
+		if total > 0 {
+			text += fmt.Sprintf(" Pass rate %.1f%%.", 100*float64(passed)/float64(total))
+		}
+		s.Text = append(s.Text, text)
+
+		// Most recent runs first
+		sort.Slice(runs, func(i, j int) bool { return runs[i].Run > runs[j].Run })
+		if len(runs) > maxOverviewRuns {
+			runs = runs[:maxOverviewRuns]
+		}
+
+		t := Table{
+			Title:     fmt.Sprintf("%s runs", strings.ToUpper(env)),
+			Header:    []string{"Run", "Started", "Passed", "Failed", "Skipped", "Duration (min)"},
+			gridSizes: []uint{2, 3, 2, 2, 1, 2},
+		}
+		for i := range runs {
+			t.Rows = append(t.Rows, []string{
+				fmt.Sprintf("%d", runs[i].Run),
+				runs[i].StartTime.Format("Jan 02 15:04"),
+				fmt.Sprintf("%d", runs[i].Passed),
+				fmt.Sprintf("%d", runs[i].Failed),
+				fmt.Sprintf("%d", runs[i].Skipped),
+				fmt.Sprintf("%.0f", runs[i].DurationInMinutes),
+			})
+		}
+		s.Tables = append(s.Tables, t)
+	}
+
+	return nil
+}
+
+// addFailures adds to s, per environment, a table with the tests which failed the most in the last week
+func addFailures(s *Section, now time.Time, logger logr.Logger) error {
+	for _, env := range []string{"ucs", "vcs"} {
+		results, err := history.GetResults(env, "", now.Add(-resultRange), now, logger)
+		if err != nil {
+			return err
+		}
+
+		failed := make(map[string]int)
+		passed := make(map[string]int)
+		maintainers := make(map[string]string)
+		for i := range results {
+			switch results[i].Result {
+			case "failed":
+				failed[results[i].Name]++
+			case "passed":
+				passed[results[i].Name]++
+			}
+			if results[i].Maintainer != "" {
+				maintainers[results[i].Name] = results[i].Maintainer
+			}
+		}
+
+		names := make([]string, 0, len(failed))
+		for name := range failed {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if failed[names[i]] != failed[names[j]] {
+				return failed[names[i]] > failed[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		if len(names) > topFailingTests {
+			names = names[:topFailingTests]
+		}
+
+		t := Table{
+			Title:     fmt.Sprintf("%s tests which failed the most in the last week", strings.ToUpper(env)),
+			Header:    []string{"Test", "Failed", "Passed", "Maintainer"},
+			gridSizes: []uint{6, 1, 1, 4},
+		}
+		for _, name := range names {
+			t.Rows = append(t.Rows, []string{name, fmt.Sprintf("%d", failed[name]),
+				fmt.Sprintf("%d", passed[name]), maintainers[name]})
+		}
+		s.Tables = append(s.Tables, t)
+	}
+
+	return nil
+}
+
+// addIssues adds to s a table with the open issues filed during e2e sanity
+func addIssues(ctx context.Context, s *Section, jiraClient *jira.Client, logger logr.Logger) error {
+	issues, err := utils.GetOpenIssues(ctx, jiraClient, logger)
+	if err != nil {
+		return err
+	}
+
+	s.Text = append(s.Text, fmt.Sprintf("%d open issues.", len(issues)))
+	t := Table{
+		Title:     "Issues",
+		Header:    []string{"Key", "Summary", "Status", "Assignee", "Age (days)"},
+		gridSizes: []uint{2, 5, 2, 2, 1},
+	}
+	for i := range issues {
+		status := ""
+		if issues[i].Fields.Status != nil {
+			status = issues[i].Fields.Status.Name
+		}
+		assignee := "none"
+		if issues[i].Fields.Assignee != nil {
+			assignee = issues[i].Fields.Assignee.Name
+		}
+		age := int(time.Since(time.Time(issues[i].Fields.Created)).Hours() / 24)
+		t.Rows = append(t.Rows, []string{issues[i].Key, issues[i].Fields.Summary, status, assignee,
+			fmt.Sprintf("%d", age)})
+	}
+	s.Tables = append(s.Tables, t)
+
+	return nil
+}
+
+// addTestPlots adds to s, per test, a plot overlaying durations in vcs and ucs
+func addTestPlots(s *Section, ws *artifacts.Workspace, now time.Time, logger logr.Logger) error {
+	series := make(map[string][]analyze.Series)
+	for _, env := range []string{"vcs", "ucs"} {
+		results, err := history.GetResults(env, "", now.Add(-plotRange), now, logger)
+		if err != nil {
+			return err
+		}
+
+		byTest := make(map[string][]es_utils.Result)
+		for i := range results {
+			byTest[results[i].Name] = append(byTest[results[i].Name], results[i])
+		}
+		for name := range byTest {
+			series[name] = append(series[name], analyze.Series{Environment: env, Samples: analyze.GetTestSamples(byTest[name])})
+		}
+	}
+
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if file := analyze.CreateDurationPlot(ws, name, series[name], logger); file != "" {
+			s.Images = append(s.Images, file)
+		}
+	}
+	s.Text = append(s.Text, fmt.Sprintf("Duration of %d tests in the last two weeks.", len(s.Images)))
+
+	return nil
+}
+
+// addReportPlots adds to s, per UCS report type and subtype, a duration plot
+func addReportPlots(s *Section, ws *artifacts.Workspace, now time.Time, logger logr.Logger) error {
+	reports, err := history.GetReports("ucs", "", now.Add(-plotRange), now, logger)
+	if err != nil {
+		return err
+	}
+
+	byType := make(map[string][]es_utils.Report)
+	for i := range reports {
+		reportType := reports[i].Type
+		if reports[i].SubType != "" {
+			reportType += utils.ReportTypeSeparator + reports[i].SubType
+		}
+		byType[reportType] = append(byType[reportType], reports[i])
+	}
+
+	reportTypes := make([]string, 0, len(byType))
+	for reportType := range byType {
+		reportTypes = append(reportTypes, reportType)
+	}
+	sort.Strings(reportTypes)
+	for _, reportType := range reportTypes {
+		series := []analyze.Series{{Environment: "ucs", Samples: analyze.GetReportSamples(byType[reportType])}}
+		if file := analyze.CreateDurationPlot(ws, reportType, series, logger); file != "" {
+			s.Images = append(s.Images, file)
+		}
+	}
+	s.Text = append(s.Text, fmt.Sprintf("Duration of %d UCS reports in the last two weeks.", len(s.Images)))
+
+	return nil
+}
+
+// addUsage adds to s a table with the UCS pods using the most memory, relative to their
+// limit when one is set, and plots memory usage of the first ones
+func addUsage(s *Section, ws *artifacts.Workspace, now time.Time, logger logr.Logger) error {
+	reports, err := history.GetUsageReports("ucs", "", now.Add(-plotRange), now, logger)
+	if err != nil {
+		return err
+	}
+
+	type podUsage struct {
+		peak    int64
+		limit   int64
+		reports []es_utils.UsageReport
+	}
+	pods := make(map[string]*podUsage)
+	for i := range reports {
+		p, ok := pods[reports[i].Name]
+		if !ok {
+			p = &podUsage{}
+			pods[reports[i].Name] = p
+		}
+		if reports[i].Memory > p.peak {
+			p.peak = reports[i].Memory
+		}
+		if reports[i].MemoryLimit != 0 {
+			p.limit = reports[i].MemoryLimit
+		}
+		p.reports = append(p.reports, reports[i])
+	}
+
+	// Pods closest to their limit first, then pods with no limit by peak usage
+	names := make([]string, 0, len(pods))
+	for name := range pods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := pods[names[i]], pods[names[j]]
+		if (a.limit != 0) != (b.limit != 0) {
+			return a.limit != 0
+		}
+		if a.limit != 0 {
+			return float64(a.peak)/float64(a.limit) > float64(b.peak)/float64(b.limit)
+		}
+		return a.peak > b.peak
+	})
+	if len(names) > maxUsagePods {
+		names = names[:maxUsagePods]
+	}
+
+	s.Text = append(s.Text, fmt.Sprintf("Peak memory usage in the last two weeks. %d pods considered.", len(pods)))
+	t := Table{
+		Title:     "Pods",
+		Header:    []string{"Pod", "Peak (Mi)", "Limit (Mi)", "Peak/limit"},
+		gridSizes: []uint{7, 2, 2, 1},
+	}
+	for i, name := range names {
+		p := pods[name]
+		limit, ratio := "none", ""
+		if p.limit != 0 {
+			limit = fmt.Sprintf("%d", p.limit/1024)
+			ratio = fmt.Sprintf("%.0f%%", 100*float64(p.peak)/float64(p.limit))
+		}
+		t.Rows = append(t.Rows, []string{name, fmt.Sprintf("%d", p.peak/1024), limit, ratio})
+
+		if i < usagePlots {
+			series := []analyze.Series{{Environment: "ucs", Samples: analyze.GetUsageSamples(p.reports, false)}}
+			if file := analyze.CreateMemoryPlot(ws, name, series, float64(p.limit), logger); file != "" {
+				s.Images = append(s.Images, file)
+			}
+		}
+	}
+	s.Tables = append(s.Tables, t)
+
+	return nil
+}
+
+// addAlerts adds to s a table with all alerts, most recently seen first
+func addAlerts(s *Section, logger logr.Logger) error {
+	all, err := alerts.GetAll(logger)
+	if err != nil {
+		return err
+	}
+
+	firing := 0
+	for i := range all {
+		if all[i].Status == alerts.Firing {
+			firing++
+		}
+	}
+	s.Text = append(s.Text, fmt.Sprintf("%d alerts, %d currently firing.", len(all), firing))
+
+	t := Table{
+		Title:     "Alerts",
+		Header:    []string{"Alert", "Status", "First seen", "Last seen", "Notes"},
+		gridSizes: []uint{5, 1, 2, 2, 2},
+	}
+	for i := range all {
+		var notes string
+		if all[i].AckedBy != "" {
+			notes = fmt.Sprintf("acked by %s", all[i].AckedBy)
+		} else if all[i].SnoozedUntil.After(time.Now()) {
+			notes = fmt.Sprintf("snoozed till %s", all[i].SnoozedUntil.Format("Jan 02 15:04"))
+		}
+		// Alerts snoozed before they ever fired were never seen
+		firstSeen, lastSeen := "never", "never"
+		if !all[i].FirstSeen.IsZero() {
+			firstSeen = all[i].FirstSeen.Format("Jan 02 15:04")
+			lastSeen = all[i].LastSeen.Format("Jan 02 15:04")
+		}
+		t.Rows = append(t.Rows, []string{all[i].ID(), string(all[i].Status), firstSeen, lastSeen, notes})
+	}
+	s.Tables = append(s.Tables, t)
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package summary
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSections(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		expected    []string
+		expectedErr bool
+	}{
+		{name: "all sections", expected: GetSections()},
+		{name: "single section", args: []string{"Issues"}, expected: []string{SectionIssues}},
+		{
+			name:     "sections in canonical order",
+			args:     []string{SectionAlerts, SectionOverview, SectionUsage},
+			expected: []string{SectionOverview, SectionUsage, SectionAlerts},
+		},
+		{name: "duplicated section", args: []string{SectionTests, SectionTests}, expected: []string{SectionTests}},
+		{name: "unknown section", args: []string{SectionTests, "logs"}, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSections(tt.args)
+			if tt.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+
+	jira_utils "github.com/gianlucam76/jira_utils/jira"
+
+	"github.com/gianlucam76/webex_bot/metrics"
+)
+
+const (
+	// jiraBaseURLEnv is the env variable containing jira base url
+	jiraBaseURLEnv     = "JIRA_BASE_URL"
+	defaultJiraBaseURL = "https://jira-eng-sjc10.cisco.com/jira"
+
+	// jiraQueriesFileEnv is the env variable containing the path of the jira configuration file
+	jiraQueriesFileEnv = "E2E_JIRA_QUERIES_FILE"
+
+	// OpenIssuesQuery is the name of the query returning open issues filed by reporter
+	OpenIssuesQuery = "open"
+	// ResolvedIssuesQuery is the name of the query returning resolved issues filed by reporter
+	ResolvedIssuesQuery = "resolved"
+	// TrendIssuesQuery is the name of the query returning issues, filed by reporter, created
+	// or resolved in the last six months
+	TrendIssuesQuery = "trend"
+
+	// maxQueryResults is the maximum number of issues returned by a named query
+	maxQueryResults = 500
+	// queryPageSize is the number of issues requested to jira at a time
+	queryPageSize = 100
+)
+
+// defaultQueries are always available. Configuration file can override them.
+var defaultQueries = map[string]string{
+	OpenIssuesQuery:     "Status NOT IN (Resolved,Closed) and reporter = {{.Reporter}} and project IN ({{.Projects}})",
+	ResolvedIssuesQuery: "Status IN (Resolved) and reporter = {{.Reporter}} and project IN ({{.Projects}})",
+	"recent":            "reporter = {{.Reporter}} and project IN ({{.Projects}}) and created >= -7d ORDER BY created DESC",
+	"unassigned":        "Status NOT IN (Resolved,Closed) and reporter = {{.Reporter}} and project IN ({{.Projects}}) and assignee IS EMPTY",
+	TrendIssuesQuery:    "reporter = {{.Reporter}} and project IN ({{.Projects}}) and (created >= -26w or resolved >= -26w)",
+}
+
+// JiraProject is a jira project issues are looked for in
+type JiraProject struct {
+	// Key is the project key
+	Key string `json:"key"`
+	// Board is the board new issues are added to
+	Board string `json:"board,omitempty"`
+}
+
+// JiraConfig contains jira query configuration. It is loaded from the file
+// pointed by E2E_JIRA_QUERIES_FILE. Example:
+//
+//	{
+//	  "reporter": "atom-ci.gen",
+//	  "projects": [{"key": "CSP", "board": "CloudStack - LCS"}],
+//	  "queries": {"p1": "priority = P1 and reporter = {{.Reporter}} and project IN ({{.Projects}})"}
+//	}
+//
+// Queries are go templates. Available fields are Reporter, Project (first project)
+// and Projects (all projects, comma separated).
+type JiraConfig struct {
+	// Reporter is the user filing issues for e2e failures. Default is atom-ci.gen
+	Reporter string `json:"reporter,omitempty"`
+	// Projects contains the projects issues are looked for in. First project is where new
+	// issues are filed. Default is the project in JIRA_PROJECT with board CloudStack - LCS.
+	Projects []JiraProject `json:"projects,omitempty"`
+	// Queries contains named JQL templates
+	Queries map[string]string `json:"queries,omitempty"`
+}
+
+// queryData is passed to JQL templates
+type queryData struct {
+	Reporter string
+	Project  string
+	Projects string
+}
+
+// GetJiraBaseURL returns jira base url
+func GetJiraBaseURL() string {
+	if baseURL, ok := os.LookupEnv(jiraBaseURLEnv); ok && baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return defaultJiraBaseURL
+}
+
+// GetIssueURL returns the url to browse a jira issue
+func GetIssueURL(key string) string {
+	return fmt.Sprintf("%s/browse/%s", GetJiraBaseURL(), key)
+}
+
+// GetIssueLink returns the markdown link to a jira issue
+func GetIssueLink(key string) string {
+	return fmt.Sprintf("[%s](%s)", key, GetIssueURL(key))
+}
+
+// GetJiraConfig returns jira query configuration. File is read every time so that
+// changes are picked up with no restart. Missing values are set to defaults.
+func GetJiraConfig(ctx context.Context, jiraClient *jira.Client, logger logr.Logger) (*JiraConfig, error) {
+	config := &JiraConfig{}
+
+	if fileName, ok := os.LookupEnv(jiraQueriesFileEnv); ok && fileName != "" {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to read jira configuration file %s. Err: %v", fileName, err))
+		} else if err := json.Unmarshal(content, config); err != nil {
+			logger.Info(fmt.Sprintf("Failed to parse jira configuration file %s. Err: %v", fileName, err))
+			config = &JiraConfig{}
+		}
+	}
+
+	if config.Reporter == "" {
+		config.Reporter = AtomUser
+	}
+
+	if len(config.Projects) == 0 {
+		project, err := jira_utils.GetJiraProject(ctx, jiraClient, "", logger)
+		if err != nil || project == nil {
+			logger.Info(fmt.Sprintf("Failed to get jira project. Err: %v", err))
+			metrics.DependencyError(metrics.Jira)
+			return nil, fmt.Errorf("failed to get jira project: %v", err)
+		}
+		config.Projects = []JiraProject{{Key: project.Key}}
+	}
+	for i := range config.Projects {
+		if config.Projects[i].Board == "" {
+			config.Projects[i].Board = LCSBoardName
+		}
+	}
+
+	queries := make(map[string]string)
+	for k, v := range defaultQueries {
+		queries[k] = v
+	}
+	for k, v := range config.Queries {
+		queries[k] = v
+	}
+	config.Queries = queries
+
+	return config, nil
+}
+
+// GetQueryNames returns the names of all available JQL queries, sorted
+func GetQueryNames(ctx context.Context, jiraClient *jira.Client, logger logr.Logger) ([]string, error) {
+	config, err := GetJiraConfig(ctx, jiraClient, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config.Queries))
+	for k := range config.Queries {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// GetJQL returns the JQL of the query with passed name
+func GetJQL(ctx context.Context, jiraClient *jira.Client, name string, logger logr.Logger) (string, error) {
+	config, err := GetJiraConfig(ctx, jiraClient, logger)
+	if err != nil {
+		return "", err
+	}
+
+	text, ok := config.Queries[name]
+	if !ok {
+		return "", fmt.Errorf("query %s not found", name)
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to parse query %s. Err: %v", name, err))
+		return "", err
+	}
+
+	projects := make([]string, len(config.Projects))
+	for i := range config.Projects {
+		projects[i] = fmt.Sprintf("%q", config.Projects[i].Key)
+	}
+
+	data := queryData{
+		Reporter: config.Reporter,
+		Project:  projects[0],
+		Projects: strings.Join(projects, ","),
+	}
+
+	var jql bytes.Buffer
+	if err := tmpl.Execute(&jql, data); err != nil {
+		logger.Info(fmt.Sprintf("Failed to instantiate query %s. Err: %v", name, err))
+		return "", err
+	}
+
+	return jql.String(), nil
+}
+
+// RunQuery runs the query with passed name and returns matching issues
+func RunQuery(ctx context.Context, jiraClient *jira.Client, name string, logger logr.Logger) ([]jira.Issue, error) {
+	jql, err := GetJQL(ctx, jiraClient, name, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchIssues(ctx, jiraClient, jql, false, logger)
+}
+
+// searchIssues returns issues matching jql, up to maxQueryResults. Truncation is logged.
+// If withComments is set, issues contain comments, rendered as well.
+func searchIssues(ctx context.Context, jiraClient *jira.Client, jql string, withComments bool,
+	logger logr.Logger) ([]jira.Issue, error) {
+	result := make([]jira.Issue, 0)
+	total := 0
+	for len(result) < maxQueryResults {
+		options := &jira.SearchOptions{
+			StartAt:    len(result),
+			MaxResults: queryPageSize,
+		}
+		if withComments {
+			options.Expand = "renderedFields"
+			options.Fields = []string{"*navigable", "comment"}
+		}
+		issues, resp, err := jiraClient.Issue.SearchWithContext(ctx, jql, options)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to get all issues matching jql:%s. Error: %v", jql, err))
+			metrics.DependencyError(metrics.Jira)
+			return nil, err
+		}
+
+		result = append(result, issues...)
+		if resp != nil {
+			total = resp.Total
+		}
+		if len(issues) == 0 || resp == nil || len(result) >= resp.Total {
+			break
+		}
+	}
+
+	if total > len(result) {
+		logger.Info(fmt.Sprintf("Query matched %d issues, only first %d returned. jql:%s",
+			total, len(result), jql))
+	}
+
+	return result, nil
+}
+
+// addSprintFilter restricts jql to sprint. Original query is parenthesised so that any
+// OR clause does not escape the filter. Ordering, if any, is kept at the end.
+func addSprintFilter(jql string, sprint int) string {
+	order := ""
+	if index := strings.Index(strings.ToUpper(jql), " ORDER BY "); index != -1 {
+		jql, order = jql[:index], jql[index:]
+	}
+
+	return fmt.Sprintf("(%s) and sprint = %d%s", jql, sprint, order)
+}
+
+// GetActiveSprintIssues returns the active sprint of the first configured project and the open
+// issues, filed by reporter, in such sprint. Issues include their comments.
+func GetActiveSprintIssues(ctx context.Context, jiraClient *jira.Client,
+	logger logr.Logger) (*jira.Sprint, []jira.Issue, error) {
+	_, activeSprint, err := getJiraProjectAndActiveSprint(ctx, jiraClient, logger)
+	if err != nil || activeSprint == nil {
+		return nil, nil, fmt.Errorf("failed to get active sprint: %v", err)
+	}
+
+	jql, err := GetJQL(ctx, jiraClient, OpenIssuesQuery, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jql = addSprintFilter(jql, activeSprint.ID)
+
+	issues, err := searchIssues(ctx, jiraClient, jql, true, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return activeSprint, issues, nil
+}
@@ -6,21 +6,47 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andygrunwald/go-jira"
 	"github.com/go-logr/logr"
 
 	"github.com/gianlucam76/cs-e2e-result/es_utils"
 	jira_utils "github.com/gianlucam76/jira_utils/jira"
+
+	"github.com/gianlucam76/webex_bot/metrics"
 )
 
 const (
 	ReportTypeSeparator        = "---"
 	AtomUser            string = "atom-ci.gen"
 	LCSBoardName        string = "CloudStack - LCS"
+	VCSLink                    = "https://cs-aci-jenkins.cisco.com:8443/job/Production/job/Cloudstack/job/Cloudstack-Virtual-Sanity/"
+	UCSLink                    = "https://cs-aci-jenkins.cisco.com:8443/job/Production/job/Cloudstack/job/Cloudstack-UCS-Sanity/"
 )
 
+// Elastic DB and indexes es_utils stores results, reports and usage reports in.
+// es_utils does not export them. Used to run queries es_utils has no helper for.
+const (
+	ElasticURL   = "http://172.31.165.56:9200"
+	ResultsIndex = "cs_e2e"
+	ReportsIndex = "cs_e2e_entries"
+	UsageIndex   = "cs_e2e_usage_entries"
+)
+
+// GetRunLink returns the link to the jenkins job for run.
+// vcs bool controls whether that is going to be for a VCS run or UCS run
+func GetRunLink(vcs bool, run int64) string {
+	if vcs {
+		return fmt.Sprintf("%s/%d", VCSLink, run)
+	}
+	return fmt.Sprintf("%s/%d", UCSLink, run)
+}
+
 // BuildUCSTests creates:
 // - a slice containing all test names
 func BuildUCSTests(ctx context.Context, logger logr.Logger) ([]string, error) {
@@ -45,6 +71,7 @@ func BuildUCSTests(ctx context.Context, logger logr.Logger) ([]string, error) {
 		)
 		if err != nil {
 			logger.Info(fmt.Sprintf("Failed to get failed test in ucs from elastic DB. Err: %v", err))
+			metrics.DependencyError(metrics.Elastic)
 			continue
 		}
 
@@ -86,6 +113,7 @@ func BuildVCSTests(ctx context.Context, logger logr.Logger) ([]string, error) {
 		)
 		if err != nil {
 			logger.Info(fmt.Sprintf("Failed to get failed test in ucs from elastic DB. Err: %v", err))
+			metrics.DependencyError(metrics.Elastic)
 			continue
 		}
 
@@ -127,6 +155,7 @@ func BuildUCSReports(ctx context.Context, logger logr.Logger) ([]string, error)
 		)
 		if err != nil {
 			logger.Info(fmt.Sprintf("Failed to get failed reports in ucs from elastic DB. Err: %v", err))
+			metrics.DependencyError(metrics.Elastic)
 			continue
 		}
 
@@ -171,6 +200,7 @@ func BuildUCSUsageReports(ctx context.Context, logger logr.Logger) ([]string, er
 		)
 		if err != nil {
 			logger.Info(fmt.Sprintf("Failed to get failed usage reports in ucs from elastic DB. Err: %v", err))
+			metrics.DependencyError(metrics.Elastic)
 			continue
 		}
 
@@ -199,6 +229,7 @@ func GetLastRun(ctx context.Context, vcs bool, logger logr.Logger) (int64, error
 	b, err := es_utils.GetAvailableRuns(ctx, match, 10, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to get available %s runs from elastic DB. Err: %v", match, err))
+		metrics.DependencyError(metrics.Elastic)
 		return 0, err
 	}
 
@@ -214,6 +245,96 @@ func GetLastRun(ctx context.Context, vcs bool, logger logr.Logger) (int64, error
 	return lastRun, nil
 }
 
+// GetLastRunFailures returns last run ID and the tests which failed in it.
+// vcs bool controls whether that is going to be for last VCS run or UCS run.
+// Run ID is zero if no run is available.
+func GetLastRunFailures(ctx context.Context, vcs bool, logger logr.Logger) (int64, []string, error) {
+	env := "ucs"
+	if vcs {
+		env = "vcs"
+	}
+
+	lastRun, err := GetLastRun(ctx, vcs, logger)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get last run ID. Err: %v", err))
+		return 0, nil, err
+	}
+
+	failedTests := make([]string, 0)
+	if lastRun == 0 {
+		return 0, failedTests, nil
+	}
+
+	results, err := es_utils.GetResults(ctx, logger,
+		fmt.Sprintf("%d", lastRun), // from this run
+		"",                         // no specific test
+		vcs,                        // from vcs
+		!vcs,                       // from ucs
+		false,                      // no passed
+		true,                       // get failed tests
+		false,                      // no skipped
+		200,
+	)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get failed test in %s run %d from elastic DB. Err: %v", env, lastRun, err))
+		metrics.DependencyError(metrics.Elastic)
+		return 0, nil, err
+	}
+
+	var rtyp es_utils.Result
+	for _, item := range results.Each(reflect.TypeOf(rtyp)) {
+		r := item.(es_utils.Result)
+		failedTests = append(failedTests, r.Name)
+	}
+
+	return lastRun, failedTests, nil
+}
+
+// TestHistory contains the results of a test in the most recent runs of an environment
+type TestHistory struct {
+	Environment string `json:"environment"`
+	// Passed, Failed and Skipped are the runs where test passed, failed or was skipped
+	Passed  []int `json:"passed"`
+	Failed  []int `json:"failed"`
+	Skipped []int `json:"skipped"`
+	// Results contains all results, last one first
+	Results []es_utils.Result `json:"results"`
+}
+
+// GetTestHistory returns the results of testName in the last runs.
+// vcs bool controls whether that is going to be for VCS runs or UCS runs
+func GetTestHistory(ctx context.Context, testName string, vcs bool, runs int,
+	logger logr.Logger) (*TestHistory, error) {
+	history := &TestHistory{Environment: "ucs", Passed: make([]int, 0), Failed: make([]int, 0),
+		Skipped: make([]int, 0), Results: make([]es_utils.Result, 0)}
+	if vcs {
+		history.Environment = "vcs"
+	}
+
+	results, err := es_utils.GetResults(ctx, logger, "", testName, vcs, !vcs, false, false, false, runs)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get results for test %q. Error %v", testName, err))
+		metrics.DependencyError(metrics.Elastic)
+		return nil, err
+	}
+
+	var rtyp es_utils.Result
+	for _, item := range results.Each(reflect.TypeOf(rtyp)) {
+		r := item.(es_utils.Result)
+		switch r.Result {
+		case "passed":
+			history.Passed = append(history.Passed, r.Run)
+		case "failed":
+			history.Failed = append(history.Failed, r.Run)
+		case "skipped":
+			history.Skipped = append(history.Skipped, r.Run)
+		}
+		history.Results = append(history.Results, r)
+	}
+
+	return history, nil
+}
+
 // GetLastNRuns returns the last N run
 // vcs bool controls whether that is going to be for last VCS run or UCS run
 func GetLastNRuns(ctx context.Context, vcs bool, runs int, logger logr.Logger) ([]int64, error) {
@@ -225,6 +346,7 @@ func GetLastNRuns(ctx context.Context, vcs bool, runs int, logger logr.Logger) (
 	b, err := es_utils.GetAvailableRuns(ctx, match, runs, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to get available %s runs from elastic DB. Err: %v", match, err))
+		metrics.DependencyError(metrics.Elastic)
 		return nil, err
 	}
 
@@ -238,17 +360,15 @@ func GetLastNRuns(ctx context.Context, vcs bool, runs int, logger logr.Logger) (
 	return lastRuns, nil
 }
 
-// GetOpenIssues returns open issues filed by atom user during e2e tagging sanity
+// GetOpenIssues returns open issues filed by atom user during e2e tagging sanity.
+// Issues contain comments, rendered as well.
 func GetOpenIssues(ctx context.Context, jiraClient *jira.Client, logger logr.Logger) ([]jira.Issue, error) {
-	project, err := jira_utils.GetJiraProject(ctx, jiraClient, "", logger)
-	if err != nil || project == nil {
-		logger.Info(fmt.Sprintf("Failed to get jira project. Err: %v", err))
+	jql, err := GetJQL(ctx, jiraClient, OpenIssuesQuery, logger)
+	if err != nil {
 		return nil, err
 	}
 
-	jql := fmt.Sprintf("Status NOT IN (Resolved,Closed) and reporter = atom-ci.gen and project = %s",
-		project.Name)
-	issues, err := jira_utils.GetJiraIssues(ctx, jiraClient, jql, logger)
+	issues, err := searchIssues(ctx, jiraClient, jql, true, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to get open issues. Err: %v", err))
 		return nil, err
@@ -274,12 +394,13 @@ func SplitIssue(ctx context.Context, jiraClient *jira.Client, issueToSplit *jira
 	// Build a map:
 	// - key: failure
 	// - value: issue
-	existingFailureMap := buildFailureMap(ctx, jiraClient, openIssues, logger)
+	existingFailureMap := buildFailureMap(openIssues, logger)
 
 	options := &jira.GetQueryOptions{Expand: "renderedFields"}
 	u, _, err := jiraClient.Issue.Get(issueToSplit.Key, options)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to query renderedFields. Error: %v\n", err))
+		metrics.DependencyError(metrics.Jira)
 		return nil, err
 	}
 
@@ -314,11 +435,13 @@ func SplitIssue(ctx context.Context, jiraClient *jira.Client, issueToSplit *jira
 					if _, resp, err := jiraClient.Issue.AddCommentWithContext(ctx, v.ID, newComment); err != nil {
 						body, _ := io.ReadAll(resp.Body)
 						logger.Info(fmt.Sprintf("Failed to add new comment to issue %s. Err: %v. Body: %s", v.Key, err, string(body)))
+						metrics.DependencyError(metrics.Jira)
 						continue
 					}
 					// Remove comment from issue
 					if err := jiraClient.Issue.DeleteCommentWithContext(ctx, issueToSplit.ID, c.ID); err != nil {
 						logger.Info(fmt.Sprintf("Failed to delete comment from issue %s. Err %v", issueToSplit.Key, err))
+						metrics.DependencyError(metrics.Jira)
 						continue
 					}
 				} else {
@@ -326,7 +449,7 @@ func SplitIssue(ctx context.Context, jiraClient *jira.Client, issueToSplit *jira
 					// current failure, use such an issue. Otherwise create new issue.
 					// Then move comment.
 					if newIssue, err := useExistingOrCreateNewIssue(ctx, jiraClient, project, activeSprint,
-						issueToSplit.Fields.Assignee.Name, issueToSplit.Fields.Summary, failureLocation, existingFailureMap, logger); err != nil {
+						issueToSplit.Fields.Assignee.Name, "", issueToSplit.Fields.Summary, failureLocation, existingFailureMap, logger); err != nil {
 						logger.Info(fmt.Sprintf("Failed to create new issue. Err: %v", err))
 						continue
 					} else {
@@ -334,11 +457,13 @@ func SplitIssue(ctx context.Context, jiraClient *jira.Client, issueToSplit *jira
 						if _, resp, err := jiraClient.Issue.AddCommentWithContext(ctx, newIssue.ID, newComment); err != nil {
 							body, _ := io.ReadAll(resp.Body)
 							logger.Info(fmt.Sprintf("Failed to add new comment to issue %s. Err: %v. Body: %s", newIssue.ID, err, string(body)))
+							metrics.DependencyError(metrics.Jira)
 							continue
 						}
 						// Remove comment from issue
 						if err := jiraClient.Issue.DeleteCommentWithContext(ctx, issueToSplit.ID, c.ID); err != nil {
 							logger.Info(fmt.Sprintf("Failed to delete comment from issue %s. Err: %v", issueToSplit.Key, err))
+							metrics.DependencyError(metrics.Jira)
 							continue
 						}
 					}
@@ -355,6 +480,131 @@ func SplitIssue(ctx context.Context, jiraClient *jira.Client, issueToSplit *jira
 	return result, nil
 }
 
+// GetIssuesForTests returns, per test, the open issue filed by atom user tracking
+// its failure. An issue tracks a test when its summary or description mentions the test.
+// Otherwise failure signature (see GetFunctionName) of the comments, added by atom user,
+// mentioning the test is used to find the issue tracking such failure (see buildFailureMap).
+// Tests with no tracked issue are not present in the returned map.
+func GetIssuesForTests(ctx context.Context, jiraClient *jira.Client, testNames []string,
+	logger logr.Logger) (map[string]*jira.Issue, error) {
+	if len(testNames) == 0 {
+		return make(map[string]*jira.Issue), nil
+	}
+
+	openIssues, err := GetOpenIssues(ctx, jiraClient, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	failureMap := buildFailureMap(openIssues, logger)
+
+	result := make(map[string]*jira.Issue)
+	for i := range testNames {
+		if issue, _ := getIssueForTest(testNames[i], openIssues, failureMap, logger); issue != nil {
+			result[testNames[i]] = issue
+		}
+	}
+
+	return result, nil
+}
+
+// getIssueForTest returns the open issue tracking testName failure, if any, and the
+// failure signature last reported for testName by atom user, if any.
+// failureMap is built by buildFailureMap from openIssues.
+func getIssueForTest(testName string, openIssues []jira.Issue, failureMap map[string]*jira.Issue,
+	logger logr.Logger) (*jira.Issue, string) {
+	// First look at summary and description
+	for j := range openIssues {
+		if openIssues[j].Fields == nil {
+			continue
+		}
+		if mentionsTest(openIssues[j].Fields.Summary, testName) ||
+			mentionsTest(openIssues[j].Fields.Description, testName) {
+			return &openIssues[j], ""
+		}
+	}
+
+	// Then look at failures reported by atom user in comments. Issue tracking the
+	// failure signature is preferred to the issue the comment was added to.
+	var commented *jira.Issue
+	var signature string
+	for j := range openIssues {
+		for _, c := range GetAtomComments(&openIssues[j], true) {
+			if !mentionsTest(c.Body, testName) {
+				continue
+			}
+			if commented == nil {
+				commented = &openIssues[j]
+			}
+			if failureLocation, err := GetFunctionName(c, logger); err == nil && failureLocation != "" {
+				signature = failureLocation
+				if issue, ok := failureMap[failureLocation]; ok {
+					return issue, signature
+				}
+			}
+		}
+	}
+
+	return commented, signature
+}
+
+// GetAtomComments returns the comments added by atom user to issue, oldest first.
+// Each one is a failure occurrence. If rendered is set, comments are taken from
+// rendered fields: body is HTML, which failure location parsing expects, but creation
+// time is for display only. Otherwise comments are taken from fields.
+func GetAtomComments(issue *jira.Issue, rendered bool) []*jira.Comment {
+	var all *jira.Comments
+	if rendered && issue.RenderedFields != nil {
+		all = issue.RenderedFields.Comments
+	} else if !rendered && issue.Fields != nil {
+		all = issue.Fields.Comments
+	}
+
+	comments := make([]*jira.Comment, 0)
+	if all == nil {
+		return comments
+	}
+
+	for _, c := range all.Comments {
+		if c.Author.Name == AtomUser {
+			comments = append(comments, c)
+		}
+	}
+
+	if !rendered {
+		sort.SliceStable(comments, func(i, j int) bool { return comments[i].Created < comments[j].Created })
+	}
+	return comments
+}
+
+// mentionsTest returns true if text contains testName. Test name must not be
+// part of a longer word (i.e. test_upgrade is not mentioned by test_upgrade_vcs).
+func mentionsTest(text, testName string) bool {
+	if testName == "" {
+		return false
+	}
+
+	isWordChar := func(r byte) bool {
+		return r == '_' || r == '-' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+	}
+
+	for start := 0; start < len(text); {
+		index := strings.Index(text[start:], testName)
+		if index == -1 {
+			return false
+		}
+		index += start
+		end := index + len(testName)
+		if (index == 0 || !isWordChar(text[index-1])) && (end == len(text) || !isWordChar(text[end])) {
+			return true
+		}
+		start = index + 1
+	}
+
+	return false
+}
+
 // GetFunctionName returns the name of the function where failure happened.
 // When Jira issue is filed for an e2e tagging sanity, comment contains:
 // - Failure Location: <line where failure happened>
@@ -380,6 +630,46 @@ func GetFunctionName(c *jira.Comment, logger logr.Logger) (string, error) {
 	return "", nil
 }
 
+var (
+	commentEnvironmentRegexp = regexp.MustCompile(`(?i)\b(ucs|vcs)\b`)
+	commentRunRegexp         = regexp.MustCompile(`(?i)\brun(?:\s*id)?\s*[:#=]?\s*(\d+)`)
+)
+
+// GetRunFromComment returns environment (ucs or vcs) and run ID of the failure reported
+// in a comment added by atom user. Empty strings are returned for information that is not found.
+func GetRunFromComment(body string) (environment, run string) {
+	if m := commentEnvironmentRegexp.FindStringSubmatch(body); m != nil {
+		environment = strings.ToLower(m[1])
+	}
+	if m := commentRunRegexp.FindStringSubmatch(body); m != nil {
+		run = m[1]
+	}
+	return environment, run
+}
+
+// ParseDuration parses a positive duration. On top of what time.ParseDuration
+// accepts, it accepts days (i.e "7d").
+func ParseDuration(value string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q. It must be positive", value)
+	}
+	return d, nil
+}
+
 func Reverse(s []float64) {
 	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
 		s[i], s[j] = s[j], s[i]
@@ -389,41 +679,30 @@ func Reverse(s []float64) {
 // buildFailureMap considers all open issues and builds a map: <failure location>: <jira issue>
 // consideri all open issues, excluding:
 // - any issue with multiple failures.
-func buildFailureMap(ctx context.Context, jiraClient *jira.Client, openIssues []jira.Issue,
-	logger logr.Logger) map[string]*jira.Issue {
+// openIssues must contain rendered comments (see GetOpenIssues).
+func buildFailureMap(openIssues []jira.Issue, logger logr.Logger) map[string]*jira.Issue {
 	failureMap := make(map[string]*jira.Issue)
 
-	options := &jira.GetQueryOptions{Expand: "renderedFields"}
-
-	// For every open issue filed by Atom user, get comments.
 	for i := range openIssues {
-		u, _, err := jiraClient.Issue.Get(openIssues[i].Key, options)
-		if err != nil {
-			logger.Info(fmt.Sprintf("Failed to query renderedFields for issue %s. Error: %v\n", openIssues[i].Key, err))
-			continue
-		}
-
 		// Walk all comments added by Atom user to this specific issue.
 		// Any comment is a failure (different run for sure, possibly different method as well).
 		// If an issue contains comment(s) representing a single issue, add it to failureMap.
 		// Otherwise an issue with different type of failures is ignored.
 		ignore := false
 		var firstDetectedFailureLocation string
-		for _, c := range u.RenderedFields.Comments.Comments {
-			if c.Author.Name == AtomUser { // Consider only comment added by Atom user
-				if failureLocation, err := GetFunctionName(c, logger); err == nil {
-					if failureLocation == "" {
-						// Nothing to do. We were not able to identify in which method issue failed
-						// when this comment was added
-						continue
-					} else if firstDetectedFailureLocation == "" || failureLocation == firstDetectedFailureLocation {
-						// First issue or a comment added for a different run. But the method were failure happened
-						// matches first failure reported in this issue.
-						firstDetectedFailureLocation = failureLocation
-					} else {
-						// This issue contains multiple different failires. Ignore it
-						ignore = true
-					}
+		for _, c := range GetAtomComments(&openIssues[i], true) {
+			if failureLocation, err := GetFunctionName(c, logger); err == nil {
+				if failureLocation == "" {
+					// Nothing to do. We were not able to identify in which method issue failed
+					// when this comment was added
+					continue
+				} else if firstDetectedFailureLocation == "" || failureLocation == firstDetectedFailureLocation {
+					// First issue or a comment added for a different run. But the method were failure happened
+					// matches first failure reported in this issue.
+					firstDetectedFailureLocation = failureLocation
+				} else {
+					// This issue contains multiple different failires. Ignore it
+					ignore = true
 				}
 			}
 		}
@@ -436,10 +715,11 @@ func buildFailureMap(ctx context.Context, jiraClient *jira.Client, openIssues []
 }
 
 // Looking at already existing issues, if one exists matching current failure, use such issue.
-// If no existing issue is found matching current failure, create a new one.
+// If no existing issue is found matching current failure, create a new one in the active sprint.
+// testName, if set, is the test that failed.
 func useExistingOrCreateNewIssue(ctx context.Context, jiraClient *jira.Client,
 	project *jira.Project, activeSprint *jira.Sprint,
-	assignee, summary, failureLocation string,
+	assignee, testName, summary, failureLocation string,
 	existingFailureMap map[string]*jira.Issue,
 	logger logr.Logger) (*jira.Issue, error) {
 	// Look at existing open failures.If one matches failureLocation, use that jira Issue
@@ -454,31 +734,94 @@ func useExistingOrCreateNewIssue(ctx context.Context, jiraClient *jira.Client,
 
 	// This comment is referencing a failure never seen so far. So first create new issue then move comment.
 	newIssue, err := jira_utils.CreateIssue(ctx, jiraClient, activeSprint, &priority, project.Key, "e2e",
-		assignee, "", summary, logger)
+		assignee, testName, summary, logger)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Failed to create new issue. Err: %v", err))
+		metrics.DependencyError(metrics.Jira)
 		return nil, err
 	}
 
+	if err := jira_utils.MoveIssueToSprint(ctx, jiraClient, activeSprint.ID, newIssue.ID, logger); err != nil {
+		logger.Info(fmt.Sprintf("Failed to move issue %s to sprint %s. Err: %v", newIssue.Key, activeSprint.Name, err))
+		metrics.DependencyError(metrics.Jira)
+	}
+
 	return newIssue, nil
 }
 
+// FileTestFailure records a test failure in jira. If an open issue already tracks the test
+// failure (see GetIssuesForTests), an occurrence comment is added to it. Otherwise a new issue,
+// assigned to assignee, is created in the active sprint.
+// Returns the issue and whether it was created.
+func FileTestFailure(ctx context.Context, jiraClient *jira.Client, result *es_utils.Result,
+	assignee, requestor string, logger logr.Logger) (*jira.Issue, bool, error) {
+	comment := fmt.Sprintf("Test %s failed in %s run %d (%s)\n", result.Name, result.Environment,
+		result.Run, GetRunLink(result.Environment == "vcs", int64(result.Run)))
+	comment += fmt.Sprintf("Start time: %s. Duration: %.2f minutes\n",
+		result.StartTime.Format(time.RFC3339), result.DurationInMinutes)
+	if result.Description != "" {
+		comment += fmt.Sprintf("Test description: %s\n", result.Description)
+	}
+	comment += fmt.Sprintf("Reported by %s from webex", requestor)
+
+	openIssues, err := GetOpenIssues(ctx, jiraClient, logger)
+	if err != nil {
+		return nil, false, err
+	}
+
+	failureMap := buildFailureMap(openIssues, logger)
+
+	issue, failureLocation := getIssueForTest(result.Name, openIssues, failureMap, logger)
+	created := false
+	if issue == nil {
+		project, activeSprint, err := getJiraProjectAndActiveSprint(ctx, jiraClient, logger)
+		if err != nil || project == nil || activeSprint == nil {
+			logger.Info(fmt.Sprintf("Failed to get project or active sprint. Err: %v", err))
+			return nil, false, fmt.Errorf("failed to get project or active sprint: %v", err)
+		}
+
+		issue, err = useExistingOrCreateNewIssue(ctx, jiraClient, project, activeSprint, assignee, result.Name,
+			fmt.Sprintf("E2E test %s failed", result.Name), failureLocation, failureMap, logger)
+		if err != nil {
+			return nil, false, err
+		}
+		_, existing := failureMap[failureLocation]
+		created = !existing
+	}
+
+	if err := jira_utils.AddCommentToIssue(ctx, jiraClient, issue.ID, comment, logger); err != nil {
+		metrics.DependencyError(metrics.Jira)
+		return issue, created, err
+	}
+
+	return issue, created, nil
+}
+
 func getJiraProjectAndActiveSprint(ctx context.Context, jiraClient *jira.Client, logger logr.Logger) (*jira.Project, *jira.Sprint, error) {
-	project, err := jira_utils.GetJiraProject(ctx, jiraClient, "", logger)
+	config, err := GetJiraConfig(ctx, jiraClient, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// New issues are filed in first configured project
+	project, err := jira_utils.GetJiraProject(ctx, jiraClient, config.Projects[0].Key, logger)
 	if err != nil || project == nil {
 		logger.Info(fmt.Sprintf("Failed to get jira project. Err: %v", err))
+		metrics.DependencyError(metrics.Jira)
 		return nil, nil, err
 	}
 
-	board, err := jira_utils.GetJiraBoard(ctx, jiraClient, project.Key, LCSBoardName, logger)
+	board, err := jira_utils.GetJiraBoard(ctx, jiraClient, project.Key, config.Projects[0].Board, logger)
 	if err != nil || board == nil {
 		logger.Info(fmt.Sprintf("Failed to get jira board. Err %v", err))
+		metrics.DependencyError(metrics.Jira)
 		return nil, nil, err
 	}
 
 	activeSprint, err := jira_utils.GetJiraActiveSprint(ctx, jiraClient, fmt.Sprintf("%d", board.ID), logger)
 	if err != nil || activeSprint == nil {
 		logger.Info(fmt.Sprintf("Failed to get active sprint. Err: %v", err))
+		metrics.DependencyError(metrics.Jira)
 		return nil, nil, err
 	}
 
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-logr/logr"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{value: "7d", expected: 7 * 24 * time.Hour},
+		{value: "0d", expectError: true},
+		{value: "-2d", expectError: true},
+		{value: "-1h", expectError: true},
+		{value: "0s", expectError: true},
+		{value: "12h", expected: 12 * time.Hour},
+		{value: "1h30m", expected: 90 * time.Minute},
+		{value: "d", expectError: true},
+		{value: "1.5d", expectError: true},
+		{value: "week", expectError: true},
+		{value: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ParseDuration(%q) = %v, expected error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDuration(%q) unexpected error: %v", tt.value, err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseDuration(%q) = %v, expected %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMentionsTest(t *testing.T) {
+	tests := []struct {
+		text     string
+		testName string
+		expected bool
+	}{
+		{text: "test_upgrade failed", testName: "test_upgrade", expected: true},
+		{text: "Test <b>test_upgrade</b> failed", testName: "test_upgrade", expected: true},
+		{text: "failure in test_upgrade", testName: "test_upgrade", expected: true},
+		{text: "test_upgrade_vcs failed", testName: "test_upgrade"},
+		{text: "pre-test_upgrade failed", testName: "test_upgrade"},
+		{text: "test_upgrade_vcs and test_upgrade failed", testName: "test_upgrade", expected: true},
+		{text: "test_upgrade failed", testName: ""},
+		{text: "", testName: "test_upgrade"},
+	}
+
+	for _, tt := range tests {
+		if got := mentionsTest(tt.text, tt.testName); got != tt.expected {
+			t.Errorf("mentionsTest(%q, %q) = %v, expected %v", tt.text, tt.testName, got, tt.expected)
+		}
+	}
+}
+
+// getIssue returns an issue with passed summary and comments added by atom user
+func getIssue(key, summary string, comments ...string) jira.Issue {
+	issue := jira.Issue{
+		Key:            key,
+		Fields:         &jira.IssueFields{Summary: summary},
+		RenderedFields: &jira.IssueRenderedFields{Comments: &jira.Comments{}},
+	}
+	for i := range comments {
+		issue.RenderedFields.Comments.Comments = append(issue.RenderedFields.Comments.Comments,
+			&jira.Comment{Author: jira.User{Name: AtomUser}, Body: comments[i]})
+	}
+	return issue
+}
+
+func TestGetIssueForTest(t *testing.T) {
+	openIssues := []jira.Issue{
+		getIssue("E2E-1", "E2E test test_upgrade failed"),
+		// Tracks failure in funcA only
+		getIssue("E2E-2", "Cluster creation fails",
+			"Test test_create failed\nFull Stack Trace e2e.funcA()\n0x1234"),
+		// Contains multiple failures. Not in failure map.
+		getIssue("E2E-3", "Multiple failures",
+			"Test test_delete failed\nFull Stack Trace e2e.funcA()\n0x1234",
+			"Test test_scale failed\nFull Stack Trace e2e.funcB()\n0x1234"),
+		getIssue("E2E-4", "No stack trace", "Test test_backup failed"),
+	}
+	// Comment added by someone else is ignored
+	openIssues[3].RenderedFields.Comments.Comments = append(openIssues[3].RenderedFields.Comments.Comments,
+		&jira.Comment{Author: jira.User{Name: "someone"}, Body: "test_restore failed"})
+
+	failureMap := buildFailureMap(openIssues, logr.Discard())
+	if len(failureMap) != 1 || failureMap["Full Stack Trace e2e.funcA()"] == nil ||
+		failureMap["Full Stack Trace e2e.funcA()"].Key != "E2E-2" {
+		t.Fatalf("unexpected failure map %v", failureMap)
+	}
+
+	tests := []struct {
+		testName          string
+		expectedKey       string
+		expectedSignature string
+	}{
+		{testName: "test_upgrade", expectedKey: "E2E-1"},
+		{testName: "test_create", expectedKey: "E2E-2", expectedSignature: "Full Stack Trace e2e.funcA()"},
+		// Same failure signature as test_create: issue tracking such failure is returned
+		{testName: "test_delete", expectedKey: "E2E-2", expectedSignature: "Full Stack Trace e2e.funcA()"},
+		{testName: "test_scale", expectedKey: "E2E-3", expectedSignature: "Full Stack Trace e2e.funcB()"},
+		{testName: "test_backup", expectedKey: "E2E-4"},
+		{testName: "test_restore"},
+		{testName: "test_unknown"},
+	}
+
+	for _, tt := range tests {
+		issue, signature := getIssueForTest(tt.testName, openIssues, failureMap, logr.Discard())
+		key := ""
+		if issue != nil {
+			key = issue.Key
+		}
+		if key != tt.expectedKey || signature != tt.expectedSignature {
+			t.Errorf("getIssueForTest(%q) = (%q, %q), expected (%q, %q)", tt.testName, key, signature,
+				tt.expectedKey, tt.expectedSignature)
+		}
+	}
+}
+
+func TestGetRunFromComment(t *testing.T) {
+	tests := []struct {
+		body                string
+		expectedEnvironment string
+		expectedRun         string
+	}{
+		{body: "Test test_upgrade failed in UCS run 1234", expectedEnvironment: "ucs", expectedRun: "1234"},
+		{body: "Environment: vcs<br/>Run ID: 42", expectedEnvironment: "vcs", expectedRun: "42"},
+		{body: "sanity run#77 on ucs", expectedEnvironment: "ucs", expectedRun: "77"},
+		{body: "Run=5", expectedRun: "5"},
+		{body: "Failure in vcs", expectedEnvironment: "vcs"},
+		{body: "ucsd running 12 tests"},
+		{body: ""},
+	}
+
+	for _, tt := range tests {
+		environment, run := GetRunFromComment(tt.body)
+		if environment != tt.expectedEnvironment || run != tt.expectedRun {
+			t.Errorf("GetRunFromComment(%q) = (%q, %q), expected (%q, %q)", tt.body, environment, run,
+				tt.expectedEnvironment, tt.expectedRun)
+		}
+	}
+}
+
+func TestAddSprintFilter(t *testing.T) {
+	tests := []struct {
+		jql      string
+		expected string
+	}{
+		{jql: "project = E2E", expected: "(project = E2E) and sprint = 7"},
+		{jql: "reporter = atom or labels = e2e order by created DESC",
+			expected: "(reporter = atom or labels = e2e) and sprint = 7 order by created DESC"},
+	}
+
+	for _, tt := range tests {
+		if got := addSprintFilter(tt.jql, 7); got != tt.expected {
+			t.Errorf("addSprintFilter(%q) = %q, expected %q", tt.jql, got, tt.expected)
+		}
+	}
+}
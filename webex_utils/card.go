@@ -97,6 +97,83 @@ var card = `{
                             "weight": "Lighter",
                             "color": "Light",
                             "spacing": "padding"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Right size:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Suppress:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Alerts:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Issue:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Jira queries:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "File issue:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Workload:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Trends:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Export:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Summary:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "Jobs:",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small"
                         }
                     ]
                 },
@@ -136,7 +213,7 @@ var card = `{
                         },
                         {
                             "type": "TextBlock",
-                            "text": "\"charts\" to send test duration pie chart",
+                            "text": "\"charts [html]\" to send test duration pie chart (html adds the interactive version)",
                             "weight": "Lighter",
                             "color": "Light",
                             "spacing": "Small"
@@ -155,6 +232,94 @@ var card = `{
                             "color": "Light",
                             "spacing": "Small",
                             "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"rightsize <namespace>\" to send recommended requests and limits for pods in the namespace",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"suppress <pod> [duration]\" to acknowledge usage variance alerts for a pod (default 14d)",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"ack <alert ID>\" to acknowledge an alert, \"snooze <alert ID> <duration>\" to mute it",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"issue <key>\" to send the occurrence timeline of a jira issue",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"jql <name>\" to list issues matching a saved jira query",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"file-issue <test> [run]\" to file a jira issue, or add an occurrence to the open one, for a test failure",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"workload\" to send open e2e issues per assignee in the active sprint",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"trends\" to send pass rate, failed runs, issue flow and time to resolution trends",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"export <results|durations|reports|usage> [filter] [30d] [csv|json]\" sends the data as a file",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"summary [overview|failures|issues|tests|reports|usage|alerts]...\" sends a PDF with the selected sections (default all)",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
+                        },
+                        {
+                            "type": "TextBlock",
+                            "text": "\"jobs\" scheduled jobs with last and next run. \"jobs run|pause|resume <name>\" (admins only)",
+                            "weight": "Lighter",
+                            "color": "Light",
+                            "spacing": "Small",
+                            "wrap": true
                         }
                     ]
                 }
@@ -1,15 +1,23 @@
 package webex_utils
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-logr/logr"
 	webexteams "github.com/jbogarin/go-cisco-webex-teams/sdk"
+
+	"github.com/gianlucam76/webex_bot/metrics"
 )
 
+// botName is the display name of the bot, as mentioned in messages
+var botName string
+
 // GetClient returns a Webex client
 func GetClient(logger logr.Logger) *webexteams.Client {
 	c := webexteams.NewClient()
@@ -23,6 +31,7 @@ func GetClient(logger logr.Logger) *webexteams.Client {
 	}
 
 	logger.Info(fmt.Sprintf("I am %s -- %s.", me.DisplayName, me.ID))
+	botName = me.DisplayName
 
 	return c
 }
@@ -107,6 +116,24 @@ func GetUser(c *webexteams.Client, username string, logger logr.Logger) (*webext
 	return &people.Items[0], nil
 }
 
+// TrimMention removes from text the leading bot mention, present in messages sent
+// in group rooms. Mention can be shortened by sender to the first name only.
+func TrimMention(text string) string {
+	text = strings.TrimSpace(text)
+	names := strings.Fields(botName)
+	if len(names) == 0 {
+		return text
+	}
+
+	for _, name := range []string{botName, names[0]} {
+		if strings.HasPrefix(text, name) {
+			return strings.TrimSpace(strings.TrimPrefix(text, name))
+		}
+	}
+
+	return text
+}
+
 // GetMessages returns the last N messages posted in the Webex room
 func GetMessages(c *webexteams.Client, roomID string, logger logr.Logger) (*webexteams.Messages, error) {
 	// GET messages
@@ -119,17 +146,75 @@ func GetMessages(c *webexteams.Client, roomID string, logger logr.Logger) (*webe
 	messages, _, err := c.Messages.ListMessages(messageQueryParams)
 	if err != nil {
 		logger.Info(fmt.Sprintf("%v", err))
+		metrics.DependencyError(metrics.Webex)
 		return nil, err
 	}
 
 	return messages, nil
 }
 
+// localOutputDir, when set, makes messages be printed to stdout and attached files
+// be written to this directory instead of being sent to Webex
+var localOutputDir string
+
+// SetLocalOutput makes messages be printed to stdout, and attached files be written
+// to dir, instead of being sent to Webex. Used to run bot commands locally.
+func SetLocalOutput(dir string, logger logr.Logger) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Info(fmt.Sprintf("Failed to create directory %s. Err: %v", dir, err))
+		return err
+	}
+	localOutputDir = dir
+	return nil
+}
+
+// writeLocalMessage prints message to stdout and writes its files to localOutputDir.
+// An existing file is never overwritten: a numeric suffix is added to the name.
+func writeLocalMessage(message *webexteams.MessageCreateRequest, logger logr.Logger) error {
+	to := message.RoomID
+	if message.ToPersonEmail != "" {
+		to = message.ToPersonEmail
+	}
+	fmt.Printf("----- message to %s -----\n%s\n", to, message.Markdown)
+	if len(message.Attachments) > 0 {
+		fmt.Println("[card attached]")
+	}
+
+	for i := range message.Files {
+		name := filepath.Base(message.Files[i].Name)
+		ext := filepath.Ext(name)
+		path := filepath.Join(localOutputDir, name)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		for n := 2; os.IsExist(err); n++ {
+			path = filepath.Join(localOutputDir, fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), n, ext))
+			file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		}
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to create file %s. Err: %v", path, err))
+			return err
+		}
+		_, err = io.Copy(file, message.Files[i].Reader)
+		file.Close()
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to write file %s. Err: %v", path, err))
+			return err
+		}
+		fmt.Printf("[attachment written to %s]\n", path)
+	}
+
+	return nil
+}
+
 func sendMessage(c *webexteams.Client, message *webexteams.MessageCreateRequest,
 	logger logr.Logger) error {
+	if localOutputDir != "" {
+		return writeLocalMessage(message, logger)
+	}
+
 	msg, resp, err := c.Messages.CreateMessage(message)
 	if err != nil {
 		logger.Info(fmt.Sprintf("%v", err))
+		metrics.DependencyError(metrics.Webex)
 		return err
 	}
 
@@ -170,6 +255,67 @@ func SendMessageWithGraphs(c *webexteams.Client, roomID, text string, paths []st
 		RoomID:   roomID,
 	}
 
+	return sendMessageWithFiles(c, message, paths, logger)
+}
+
+// SendDirectMessageWithGraphs sends a direct message to the person with email
+// toPersonEmail with graph attached
+func SendDirectMessageWithGraphs(c *webexteams.Client, toPersonEmail, text string, paths []string,
+	logger logr.Logger) error {
+
+	message := &webexteams.MessageCreateRequest{
+		Markdown:      text,
+		ToPersonEmail: toPersonEmail,
+	}
+
+	return sendMessageWithFiles(c, message, paths, logger)
+}
+
+// Attachment is a file, held in memory, attached to a message
+type Attachment struct {
+	// Name is the file name shown in Webex. Its extension determines the content type.
+	Name string
+	// Content is the file content
+	Content []byte
+}
+
+// SendMessageWithAttachments sends message to roomID with in-memory files attached.
+// Nothing is written to disk.
+func SendMessageWithAttachments(c *webexteams.Client, roomID, text string, attachments []Attachment,
+	logger logr.Logger) error {
+	message := &webexteams.MessageCreateRequest{
+		Markdown: text,
+		RoomID:   roomID,
+	}
+
+	for i := range attachments {
+		webexFile := webexteams.File{
+			Name:   attachments[i].Name,
+			Reader: bytes.NewReader(attachments[i].Content),
+		}
+		if contentType, ok := contentTypes[filepath.Ext(attachments[i].Name)]; ok {
+			webexFile.ContentType = contentType
+		}
+		message.Files = append(message.Files, webexFile)
+	}
+
+	return sendMessage(c, message, logger)
+}
+
+// contentTypes contains, per file extension, the content type of files attached to messages
+var contentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".pdf":  "application/pdf",
+	".csv":  "text/csv",
+	".json": "application/json",
+	".txt":  "text/plain",
+	".html": "text/html",
+	".yaml": "application/yaml",
+}
+
+func sendMessageWithFiles(c *webexteams.Client, message *webexteams.MessageCreateRequest, paths []string,
+	logger logr.Logger) error {
 	for i := range paths {
 		filename := filepath.Base(paths[i])
 		file, err := os.Open(paths[i])
@@ -180,11 +326,8 @@ func SendMessageWithGraphs(c *webexteams.Client, roomID, text string, paths []st
 				Name:   filename,
 				Reader: file,
 			}
-			ext := filepath.Ext(filename)
-			if ext == ".png" {
-				webexFile.ContentType = "image/png"
-			} else if ext == ".pdf" {
-				webexFile.ContentType = "application/pdf"
+			if contentType, ok := contentTypes[filepath.Ext(filename)]; ok {
+				webexFile.ContentType = contentType
 			}
 			message.Files = append(message.Files, webexFile)
 		}